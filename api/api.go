@@ -7,8 +7,10 @@ import (
 	"Message-Generator/print"
 	"Message-Generator/stats"
 	"encoding/json"
+	"errors"
 	"net/http"
 	_ "net/http/pprof"
+	"strconv"
 	"strings"
 
 	"Message-Generator/markov"
@@ -25,7 +27,12 @@ func HandleRequests() {
 	mux.HandleFunc("/data", websiteHomePage)
 	mux.HandleFunc("/emotes", emotes)
 	mux.HandleFunc("/get-sentence", getSentence)
+	mux.HandleFunc("/guess-channel", guessChannel)
+	mux.HandleFunc("/autocomplete", autocomplete)
+	mux.HandleFunc("/chains/", chainStats)
+	mux.HandleFunc("/graph", graph)
 	mux.HandleFunc("/server-stats", serverStats)
+	mux.HandleFunc("/inspect", inspect)
 
 	//handler := cors.AllowAll().Handler(mux)
 	http.ListenAndServe(":10000", mux)
@@ -48,11 +55,15 @@ func apiHomePage(w http.ResponseWriter, r *http.Request) {
 				Discord string `json:"discord"`
 				GitHub  string `json:"github"`
 			} `json:"socials"`
-			ChannelsEndpoint string `json:"tracked_channels_endpoint"`
-			EmotesEndpoint   string `json:"emotes_endpoint"`
+			ChannelsEndpoint     string `json:"tracked_channels_endpoint"`
+			EmotesEndpoint       string `json:"emotes_endpoint"`
+			GuessEndpoint        string `json:"guess_channel_endpoint"`
+			AutocompleteEndpoint string `json:"autocomplete_endpoint"`
+			ChainStatsEndpoint   string `json:"chain_stats_endpoint"`
+			GraphEndpoint        string `json:"graph_endpoint"`
 		}{}
 		welcome.Welcome = "Welcome to the HomePage!"
-		welcome.Usage = "Start using this API by going to /getsentence and ?channel=[channel]"
+		welcome.Usage = "Start using this API by going to /getsentence and ?channel=[channel]. Optionally add &temperature=, &top_k=, &top_p=, &greedy= or &seed= to change how words are picked, and &count= to get up to " + strconv.Itoa(maxCount) + " different sentences at once."
 		welcome.Example = "https://actuallygiggles.localtonet.com/get-sentence?channel=39daph"
 		welcome.PS = "Not every channel is being tracked! If you have a suggestion on which channel should be tracked, @ me on Twitter or join the Discord!"
 		welcome.Socials.Website = "https://actuallygiggles.github.io/Message-Generator/"
@@ -61,6 +72,10 @@ func apiHomePage(w http.ResponseWriter, r *http.Request) {
 		welcome.Socials.GitHub = "https://github.com/ActuallyGiggles/Message-Generator"
 		welcome.ChannelsEndpoint = "/data"
 		welcome.EmotesEndpoint = "/emotes"
+		welcome.GuessEndpoint = "/guess-channel?message=[message]"
+		welcome.AutocompleteEndpoint = "/autocomplete?channel=[channel]&prefix=[prefix]"
+		welcome.ChainStatsEndpoint = "/chains/[channel]/stats"
+		welcome.GraphEndpoint = "/graph?channel=[channel]&word=[word]&depth=[1-4]&format=[json or dot]"
 		json.NewEncoder(w).Encode(welcome)
 	} else {
 		err := struct {
@@ -159,7 +174,21 @@ func getSentence(w http.ResponseWriter, r *http.Request) {
 
 	var apiResponse APIResponse
 
-	output, success := handlers.CreateAPISentence(channel)
+	sampling, err := parseSampling(r)
+	if err != nil {
+		apiResponse.Error = err.Error()
+		json.NewEncoder(w).Encode(apiResponse)
+		return
+	}
+
+	count, err := parseCount(r)
+	if err != nil {
+		apiResponse.Error = err.Error()
+		json.NewEncoder(w).Encode(apiResponse)
+		return
+	}
+
+	outputs, success := handlers.CreateAPISentences(channel, sampling, count)
 
 	if !success {
 		apiResponse.Error = "Something went wrong with the generator! Try again..."
@@ -167,11 +196,209 @@ func getSentence(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	apiResponse.MarkovSentence = output
+	apiResponse.MarkovSentence = outputs[0]
+	if count > 1 {
+		apiResponse.MarkovSentences = outputs
+	}
 
 	json.NewEncoder(w).Encode(apiResponse)
 }
 
+func guessChannel(w http.ResponseWriter, r *http.Request) {
+	print.Info("Hit Guess Channel Endpoint")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	var guessResponse GuessResponse
+
+	if !limitEndpoint(5, "guessChannel") {
+		guessResponse.Error = "Endpoint Limiter: Try again in 5 seconds"
+		json.NewEncoder(w).Encode(guessResponse)
+		return
+	}
+
+	message := r.URL.Query().Get("message")
+	if message == "" {
+		guessResponse.Error = "Add ?message=[message] to guess which channel it is from."
+		json.NewEncoder(w).Encode(guessResponse)
+		return
+	}
+
+	scores, err := markov.Classify(message)
+	if err != nil {
+		guessResponse.Error = "Something went wrong with the guesser! Try again..."
+		json.NewEncoder(w).Encode(guessResponse)
+		return
+	}
+
+	for i, score := range scores {
+		if i == maxGuesses {
+			break
+		}
+
+		guessResponse.Guesses = append(guessResponse.Guesses, Guess{
+			Channel:    score.Chain,
+			Perplexity: score.Perplexity,
+		})
+	}
+
+	json.NewEncoder(w).Encode(guessResponse)
+}
+
+func autocomplete(w http.ResponseWriter, r *http.Request) {
+	print.Info("Hit Autocomplete Endpoint")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	var autocompleteResponse AutocompleteResponse
+
+	// Autocomplete is hit as people type, so it is limited per client instead of for everyone.
+	if !limitEndpoint(1, "autocomplete "+clientAddress(r, global.TrustedProxies)) {
+		autocompleteResponse.Error = "Endpoint Limiter: Try again in a second"
+		json.NewEncoder(w).Encode(autocompleteResponse)
+		return
+	}
+
+	channel := strings.ToLower(r.URL.Query().Get("channel"))
+	prefix := strings.Join(strings.Fields(r.URL.Query().Get("prefix")), " ")
+
+	continuations, err := markov.Next(channel, prefix)
+	if err != nil {
+		switch {
+		case errors.Is(err, markov.ErrChainNotFound):
+			autocompleteResponse.Error = "Channel is not tracked!"
+		case errors.Is(err, markov.ErrUnknownState):
+			autocompleteResponse.Error = "Chat has never said anything like that!"
+		default:
+			autocompleteResponse.Error = "Something went wrong with the autocomplete! Try again..."
+		}
+		json.NewEncoder(w).Encode(autocompleteResponse)
+		return
+	}
+
+	for i, c := range continuations {
+		if i == maxSuggestions {
+			break
+		}
+
+		suggestion := Suggestion{
+			Message:     strings.TrimSpace(prefix + " " + c.Text),
+			Ends:        c.Edge,
+			Probability: c.Probability,
+		}
+		autocompleteResponse.Suggestions = append(autocompleteResponse.Suggestions, suggestion)
+	}
+
+	json.NewEncoder(w).Encode(autocompleteResponse)
+}
+
+// chainStats serves /chains/{name}/stats.
+func chainStats(w http.ResponseWriter, r *http.Request) {
+	print.Info("Hit Chain Stats Endpoint")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	var chainStatsResponse ChainStatsResponse
+
+	channel, found := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/chains/"), "/stats")
+	if !found || channel == "" || strings.Contains(channel, "/") {
+		w.WriteHeader(http.StatusNotFound)
+		chainStatsResponse.Error = "Use /chains/[channel]/stats"
+		json.NewEncoder(w).Encode(chainStatsResponse)
+		return
+	}
+
+	if !limitEndpoint(5, "chainStats") {
+		chainStatsResponse.Error = "Endpoint Limiter: Try again in 5 seconds"
+		json.NewEncoder(w).Encode(chainStatsResponse)
+		return
+	}
+
+	stats, err := markov.ChainStats(strings.ToLower(channel))
+	if err != nil {
+		switch {
+		case errors.Is(err, markov.ErrChainNotFound):
+			chainStatsResponse.Error = "Channel is not tracked!"
+		case errors.Is(err, markov.ErrChainBusy):
+			chainStatsResponse.Error = "Channel is busy! Try again..."
+		default:
+			chainStatsResponse.Error = "Something went wrong with the stats! Try again..."
+		}
+		json.NewEncoder(w).Encode(chainStatsResponse)
+		return
+	}
+
+	chainStatsResponse.Stats = &stats
+	json.NewEncoder(w).Encode(chainStatsResponse)
+}
+
+// graph returns the graph around a word in a channel's chain, as JSON for the website or as DOT for Graphviz.
+func graph(w http.ResponseWriter, r *http.Request) {
+	print.Info("Hit Graph Endpoint")
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	var graphResponse GraphResponse
+
+	fail := func(message string) {
+		w.Header().Set("Content-Type", "application/json")
+		graphResponse.Error = message
+		json.NewEncoder(w).Encode(graphResponse)
+	}
+
+	if !limitEndpoint(5, "graph") {
+		fail("Endpoint Limiter: Try again in 5 seconds")
+		return
+	}
+
+	query := r.URL.Query()
+	channel := strings.ToLower(query.Get("channel"))
+	word := query.Get("word")
+	format := query.Get("format")
+	if format != "" && format != "json" && format != "dot" {
+		fail("format is not json or dot")
+		return
+	}
+
+	depth := 1
+	if v := query.Get("depth"); v != "" {
+		var err error
+		if depth, err = strconv.Atoi(v); err != nil {
+			fail("depth is not a whole number")
+			return
+		}
+	}
+
+	g, err := markov.ExportGraph(channel, word, depth)
+	if err != nil {
+		switch {
+		case errors.Is(err, markov.ErrChainNotFound):
+			fail("Channel is not tracked!")
+		case errors.Is(err, markov.ErrEmptyTarget):
+			fail("Add &word=[word] to graph.")
+		case errors.Is(err, markov.ErrNoMatchingTarget):
+			fail("Chat has never said that!")
+		default:
+			fail("Something went wrong with the graph! Try again...")
+		}
+		return
+	}
+
+	if format == "dot" {
+		w.Header().Set("Content-Type", "text/vnd.graphviz")
+		w.Header().Set("Content-Disposition", "attachment; filename=\""+channel+".dot\"")
+		w.Write([]byte(g.DOT()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	graphResponse.Graph = &g
+	json.NewEncoder(w).Encode(graphResponse)
+}
+
 func serverStats(w http.ResponseWriter, r *http.Request) {
 	// if limitEndpoint(60, "serverStats notification") {
 	// 	print.Info("Hit Stats Endpoint")
@@ -183,7 +410,7 @@ func serverStats(w http.ResponseWriter, r *http.Request) {
 	if limitEndpoint(1, "serverStats") {
 		access := r.URL.Query().Get("access")
 
-		if access != "security-omegalul" {
+		if access != adminAccess {
 			err := struct {
 				Error string
 			}{}
@@ -206,3 +433,37 @@ func serverStats(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(err)
 	}
 }
+
+// inspect returns every parent of a channel's chain that has the word in it, for admins to see where an output came from.
+func inspect(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var inspectResponse InspectResponse
+
+	if !limitEndpoint(1, "inspect") {
+		inspectResponse.Error = "Endpoint Limiter: Try again in 1 second"
+		json.NewEncoder(w).Encode(inspectResponse)
+		return
+	}
+
+	if r.URL.Query().Get("access") != adminAccess {
+		inspectResponse.Error = "Incorrect security code lol"
+		json.NewEncoder(w).Encode(inspectResponse)
+		return
+	}
+
+	print.Info("Hit Inspect Endpoint")
+
+	channel := strings.ToLower(r.URL.Query().Get("channel"))
+	word := r.URL.Query().Get("word")
+
+	parents, err := markov.Inspect(channel, word)
+	if err != nil {
+		inspectResponse.Error = err.Error()
+		json.NewEncoder(w).Encode(inspectResponse)
+		return
+	}
+
+	inspectResponse.Parents = parents
+	json.NewEncoder(w).Encode(inspectResponse)
+}
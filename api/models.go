@@ -1,12 +1,64 @@
 package api
 
 import (
+	"Message-Generator/markov"
 	"Message-Generator/platform/twitch"
 )
 
+// maxCount is the most sentences the sentence endpoint makes at once.
+const maxCount = 20
+
 type APIResponse struct {
-	MarkovSentence string `json:"markov_sentence"`
-	Error          string `json:"error"`
+	MarkovSentence  string   `json:"markov_sentence"`
+	MarkovSentences []string `json:"markov_sentences,omitempty"`
+	Error           string   `json:"error"`
+}
+
+// maxGuesses is how many channels the guess channel endpoint returns.
+const maxGuesses = 5
+
+type GuessResponse struct {
+	Guesses []Guess `json:"guesses"`
+	Error   string  `json:"error"`
+}
+
+// Guess is a channel a message could be from. Lower perplexity is more likely.
+type Guess struct {
+	Channel    string  `json:"channel"`
+	Perplexity float64 `json:"perplexity"`
+}
+
+// maxSuggestions is how many suggestions the autocomplete endpoint returns.
+const maxSuggestions = 10
+
+type AutocompleteResponse struct {
+	Suggestions []Suggestion `json:"suggestions"`
+	Error       string       `json:"error"`
+}
+
+// Suggestion is the prefix followed by what chat is likely to say next. Ends is whether chat is likely to stop there instead.
+type Suggestion struct {
+	Message     string  `json:"message"`
+	Ends        bool    `json:"ends"`
+	Probability float64 `json:"probability"`
+}
+
+// adminAccess is the security code for admin endpoints.
+const adminAccess = "security-omegalul"
+
+type InspectResponse struct {
+	Parents []markov.Parent `json:"parents"`
+	Error   string          `json:"error"`
+}
+
+type ChainStatsResponse struct {
+	Stats *markov.ChainStatistics `json:"stats,omitempty"`
+	Error string                  `json:"error"`
+}
+
+type GraphResponse struct {
+	Graph *markov.Graph `json:"graph,omitempty"`
+	Error string        `json:"error"`
 }
 
 type DataSend struct {
@@ -1,6 +1,13 @@
 package api
 
 import (
+	"Message-Generator/markov"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -27,7 +34,101 @@ func limitEndpoint(timer int, endpoint string) bool {
 		time.Sleep(time.Duration(timer * 1e9))
 		limitMx.Lock()
 		limit[endpoint] -= 1
+		if limit[endpoint] <= 0 {
+			delete(limit, endpoint)
+		}
 		limitMx.Unlock()
 	}(timer)
 	return true
 }
+
+// clientAddress returns the address a request came from, without its port, for limiting endpoints per client.
+// X-Forwarded-For is only believed when the request came through trusted proxies, in which case the client is
+// the last address in it that is not a trusted proxy, as anything before that could have been made up by the client.
+func clientAddress(r *http.Request, trusted []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if !isTrustedProxy(host, trusted) {
+		return host
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		address := strings.TrimSpace(forwarded[i])
+		if address == "" {
+			continue
+		}
+		if !isTrustedProxy(address, trusted) {
+			return address
+		}
+		host = address
+	}
+
+	return host
+}
+
+func isTrustedProxy(address string, trusted []*net.IPNet) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSampling reads the optional temperature, top_k, top_p, greedy and seed query parameters.
+func parseSampling(r *http.Request) (sampling markov.Sampling, err error) {
+	query := r.URL.Query()
+
+	if v := query.Get("temperature"); v != "" {
+		if sampling.Temperature, err = strconv.ParseFloat(v, 64); err != nil {
+			return sampling, errors.New("temperature is not a number")
+		}
+	}
+	if v := query.Get("top_k"); v != "" {
+		if sampling.TopK, err = strconv.Atoi(v); err != nil {
+			return sampling, errors.New("top_k is not a whole number")
+		}
+	}
+	if v := query.Get("top_p"); v != "" {
+		if sampling.TopP, err = strconv.ParseFloat(v, 64); err != nil {
+			return sampling, errors.New("top_p is not a number")
+		}
+	}
+	if v := query.Get("greedy"); v != "" {
+		if sampling.Greedy, err = strconv.ParseBool(v); err != nil {
+			return sampling, errors.New("greedy is not true or false")
+		}
+	}
+	if v := query.Get("seed"); v != "" {
+		if sampling.Seed, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return sampling, errors.New("seed is not a whole number")
+		}
+		sampling.Seeded = true
+	}
+
+	return sampling, nil
+}
+
+// parseCount reads the optional count query parameter, which is 1 if left out.
+func parseCount(r *http.Request) (count int, err error) {
+	v := r.URL.Query().Get("count")
+	if v == "" {
+		return 1, nil
+	}
+
+	count, err = strconv.Atoi(v)
+	if err != nil || count < 1 || count > maxCount {
+		return 0, fmt.Errorf("count is not a whole number from 1 to %d", maxCount)
+	}
+
+	return count, nil
+}
@@ -5,7 +5,9 @@ import (
 	"Message-Generator/markov"
 	"Message-Generator/platform/twitch"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -47,6 +49,22 @@ func commandsHandler(message IncomingMessage) {
 		// Misc
 	case "cleanse":
 		cleanse(message.ChannelID, message.MessageID, message.Args)
+	case "defluff":
+		defluff(message.ChannelID, message.MessageID)
+	case "inspect":
+		inspect(message.ChannelID, message.MessageID, message.Args)
+	case "chainstats":
+		chainStats(message.ChannelID, message.MessageID, message.Args)
+	case "graph":
+		graph(message.ChannelID, message.MessageID, message.Args)
+	case "mergechains":
+		mergeChains(message.ChannelID, message.MessageID, message.Args)
+	case "showaliases":
+		showAliases(message.ChannelID, message.MessageID)
+	case "addalias":
+		addAlias(message.ChannelID, message.MessageID, message.Args)
+	case "removealias":
+		removeAlias(message.ChannelID, message.MessageID, message.Args)
 	case "help":
 		help(message.ChannelID, message.MessageID)
 	}
@@ -198,7 +216,7 @@ getTheSettingsToSet:
 	}
 
 getWhatChannelToUse:
-	conversationIDs.add(SayByID(channelID, "What chains will this channel use to post with?\n\nAll (1)     All except self (2)     Self (3)     Custom (4)\n\nIf custom, what are the custom channels to use?").ID)
+	conversationIDs.add(SayByID(channelID, "What chains will this channel use to post with?\n\nAll (1)     All except self (2)     Self (3)     Custom (4)     Blend (5)\n\nIf custom, what are the custom channels to use?\nIf blend, what are the channels to blend, written as channel:weight?").ID)
 	responseSettings := <-dialogueChannel
 	conversationIDs.add(responseSettings.MessageID)
 	if responseSettings.Arguments[0] == "cancel" {
@@ -219,6 +237,9 @@ getWhatChannelToUse:
 	case "4", "custom", "Custom":
 		channel.Settings.WhichChannelsToUse = "custom"
 		channel.Settings.CustomChannelsToUse = customChannels
+	case "5", "blend", "Blend":
+		channel.Settings.WhichChannelsToUse = "blend"
+		channel.Settings.CustomChannelsToUse = customChannels
 	}
 
 	conversationIDs.add(SayByID(channelID, "Gathering emotes and broadcaster information...").ID)
@@ -353,7 +374,7 @@ getWhatSettingToUpdate:
 			channel.Settings.Participation.OfflineTimeToWait = timeParsed
 			conversationIDs.add(SayByID(channelID, "New minutes to wait before participation offline again: "+time.Arguments[0]).ID)
 		case "12":
-			conversationIDs.add(SayByID(channelID, "What chains will this channel use to post with?\n\nAll (1)     All except self (2)     Self (3)     Custom (4)\n\nIf custom, what are the custom channels to use?").ID)
+			conversationIDs.add(SayByID(channelID, "What chains will this channel use to post with?\n\nAll (1)     All except self (2)     Self (3)     Custom (4)     Blend (5)\n\nIf custom, what are the custom channels to use?\nIf blend, what are the channels to blend, written as channel:weight?").ID)
 			responseSettings := <-dialogueChannel
 			conversationIDs.add(responseSettings.MessageID)
 			if responseSettings.Arguments[0] == "cancel" {
@@ -371,8 +392,31 @@ getWhatSettingToUpdate:
 			case "4", "custom", "Custom":
 				channel.Settings.WhichChannelsToUse = "custom"
 				channel.Settings.CustomChannelsToUse = customChannels
+			case "5", "blend", "Blend":
+				channel.Settings.WhichChannelsToUse = "blend"
+				channel.Settings.CustomChannelsToUse = customChannels
 			}
 			conversationIDs.add(SayByID(channelID, "Participation offline: "+strings.Join(channel.Settings.CustomChannelsToUse, " ")).ID)
+		case "13":
+			conversationIDs.add(SayByID(channelID, "New reply temperature? Below 1 is tamer, above 1 is wilder and 0 is the default.").ID)
+			temperature := <-dialogueChannel
+			conversationIDs.add(temperature.MessageID)
+			temperatureParsed, success := parseTemperature(channelID, temperature.Arguments)
+			if !success {
+				goto getWhatSettingToUpdate
+			}
+			channel.Settings.Reply.Temperature = temperatureParsed
+			conversationIDs.add(SayByID(channelID, "New reply temperature: "+temperature.Arguments[0]).ID)
+		case "14":
+			conversationIDs.add(SayByID(channelID, "New participation temperature? Below 1 is tamer, above 1 is wilder and 0 is the default.").ID)
+			temperature := <-dialogueChannel
+			conversationIDs.add(temperature.MessageID)
+			temperatureParsed, success := parseTemperature(channelID, temperature.Arguments)
+			if !success {
+				goto getWhatSettingToUpdate
+			}
+			channel.Settings.Participation.Temperature = temperatureParsed
+			conversationIDs.add(SayByID(channelID, "New participation temperature: "+temperature.Arguments[0]).ID)
 		}
 	}
 	goto getWhatSettingToUpdate
@@ -571,12 +615,184 @@ func cleanse(channelID string, messageID string, args []string) {
 	}()
 
 	conversationIDs.add(messageID)
+	if len(args) < 1 {
+		SayByIDAndDelete(channelID, "Specify word to cleanse, optionally followed by literal, insensitive, regex or emote.")
+		return
+	}
+
+	// How to match the word, literal if not given.
+	matching := ""
+	if len(args) > 1 {
+		matching = args[1]
+	}
+
 	conversationIDs.add(SayByID(channelID, "Cleansing chains of the word: "+args[0]).ID)
-	cleansedNumber := markov.Cleanse(args[0])
+	cleansedNumber, err := markov.Cleanse(args[0], matching)
+	if errors.Is(err, markov.ErrInvalidTarget) || errors.Is(err, markov.ErrInvalidMatching) {
+		SayByID(channelID, "Could not cleanse:\n"+err.Error())
+		return
+	}
 	SayByID(channelID, "Cleansed a total of "+strconv.Itoa(cleansedNumber)+" entries matching ["+args[0]+"]")
+	if err != nil {
+		SayByID(channelID, "Some chains could not be cleansed:\n"+err.Error())
+	}
+}
+
+func defluff(channelID string, messageID string) {
+	var conversationIDs MessageIDs
+
+	defer func() {
+		conversationIDs.delete(channelID)
+		dialogueChannel = nil
+	}()
+
+	conversationIDs.add(messageID)
+	conversationIDs.add(SayByID(channelID, "Defluffing chains...").ID)
+	r, err := markov.Defluff()
+	SayByID(channelID, fmt.Sprintf("Defluffed %d chains: removed %d children, %d grandparents and %d parents", r.Chains, r.Children, r.Grandparents, r.Parents))
+	if err != nil {
+		SayByID(channelID, "Some chains could not be defluffed:\n"+err.Error())
+	}
+}
+
+func inspect(channelID string, messageID string, args []string) {
+	defer DeleteDiscordMessage(channelID, messageID)
+	if len(args) < 2 {
+		SayByIDAndDelete(channelID, "Specify channel and word to inspect.")
+		return
+	}
+
+	word := strings.Join(args[1:], " ")
+	parents, err := markov.Inspect(args[0], word)
+	if err != nil {
+		SayByIDAndDelete(channelID, "Could not inspect:\n"+err.Error())
+		return
+	}
+	if len(parents) == 0 {
+		SayByIDAndDelete(channelID, "No parents in "+args[0]+" have ["+word+"] in them.")
+		return
+	}
+
+	SayByID(channelID, renderParents(args[0], word, parents))
+}
+
+func chainStats(channelID string, messageID string, args []string) {
+	defer DeleteDiscordMessage(channelID, messageID)
+	if len(args) < 1 {
+		SayByIDAndDelete(channelID, "Specify channel!")
+		return
+	}
+
+	stats, err := markov.ChainStats(args[0])
+	if err != nil {
+		SayByIDAndDelete(channelID, "Could not get chain stats:\n"+err.Error())
+		return
+	}
+
+	SayByID(channelID, renderChainStats(stats))
+}
+
+func graph(channelID string, messageID string, args []string) {
+	defer DeleteDiscordMessage(channelID, messageID)
+	if len(args) < 2 {
+		SayByIDAndDelete(channelID, "Specify channel and word to graph, optionally followed by how many hops deep (1-4).")
+		return
+	}
+
+	// The word can be more than one word, so the depth is only taken from the end when there is a word before it.
+	words, depth := args[1:], 1
+	if len(words) > 1 {
+		if d, err := strconv.Atoi(words[len(words)-1]); err == nil {
+			words, depth = words[:len(words)-1], d
+		}
+	}
+	word := strings.Join(words, " ")
+
+	g, err := markov.ExportGraph(args[0], word, depth)
+	if err != nil {
+		SayByIDAndDelete(channelID, "Could not graph:\n"+err.Error())
+		return
+	}
+
+	_, err = discord.ChannelFileSend(channelID, args[0]+"-"+strings.Join(words, "_")+".dot", strings.NewReader(g.DOT()))
+	if err != nil {
+		SayByIDAndDelete(channelID, "Could not send graph:\n"+err.Error())
+	}
+}
+
+func mergeChains(channelID string, messageID string, args []string) {
+	var conversationIDs MessageIDs
+
+	defer func() {
+		conversationIDs.delete(channelID)
+		dialogueChannel = nil
+	}()
+
+	conversationIDs.add(messageID)
+	if len(args) < 2 {
+		SayByIDAndDelete(channelID, "Specify the chain to merge into, followed by the chains to merge.")
+		return
+	}
+
+	conversationIDs.add(SayByID(channelID, "Merging "+strings.Join(args[1:], ", ")+" into "+args[0]+"...").ID)
+	if err := markov.Merge(args[0], args[1:]...); err != nil {
+		SayByID(channelID, "Could not merge:\n"+err.Error())
+		return
+	}
+	SayByID(channelID, "Merged "+strings.Join(args[1:], ", ")+" into "+args[0]+".")
+}
+
+func showAliases(channelID string, messageID string) {
+	defer DeleteDiscordMessage(channelID, messageID)
+
+	aliases := markov.Aliases()
+	if len(aliases) == 0 {
+		SayByIDAndDelete(channelID, "No aliases.")
+		return
+	}
+
+	var names []string
+	for name := range aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	s := "Aliases:"
+	for _, name := range names {
+		s += "\n" + name + " -> " + aliases[name]
+	}
+	SayByID(channelID, s)
+}
+
+func addAlias(channelID string, messageID string, args []string) {
+	defer DeleteDiscordMessage(channelID, messageID)
+	if len(args) < 2 {
+		SayByIDAndDelete(channelID, "Specify the alias, followed by the chain it stands for.")
+		return
+	}
+
+	if err := markov.Alias(args[0], args[1]); err != nil {
+		SayByIDAndDelete(channelID, "Could not add alias:\n"+err.Error())
+		return
+	}
+	go SayByIDAndDelete(channelID, args[0]+" now stands for "+args[1]+".")
+}
+
+func removeAlias(channelID string, messageID string, args []string) {
+	defer DeleteDiscordMessage(channelID, messageID)
+	if len(args) < 1 {
+		SayByIDAndDelete(channelID, "Specify alias to remove.")
+		return
+	}
+
+	if err := markov.RemoveAlias(args[0]); err != nil {
+		SayByIDAndDelete(channelID, "Could not remove alias:\n"+err.Error())
+		return
+	}
+	go SayByIDAndDelete(channelID, "Removed alias "+args[0]+".")
 }
 
 func help(channelID string, messageID string) {
 	defer DeleteDiscordMessage(channelID, messageID)
-	SayByIDAndDelete(channelID, fmt.Sprintf("Commands:\n[%s]\n[%s]\n[%s]\n[%s]\n[%s]\n[%s]\n[%s]\n[%s]\n[%s]\n[%s]\n[%s]\n[%s]\n[%s]", "showchannels", "showchanneldetailed", "addchannel", "updatechannel", "removechannel", "showregex", "addregex", "removeregex", "showbannedusers", "addbanneduser", "removebanneduser", "cleanse", "help"))
+	SayByIDAndDelete(channelID, fmt.Sprintf("Commands:\n[%s]\n[%s]\n[%s]\n[%s]\n[%s]\n[%s]\n[%s]\n[%s]\n[%s]\n[%s]\n[%s]\n[%s]\n[%s]\n[%s]\n[%s]\n[%s]\n[%s]\n[%s]\n[%s]\n[%s]\n[%s]", "showchannels", "showchanneldetailed", "addchannel", "updatechannel", "removechannel", "showregex", "addregex", "removeregex", "showbannedusers", "addbanneduser", "removebanneduser", "cleanse", "defluff", "inspect", "chainstats", "graph", "mergechains", "showaliases", "addalias", "removealias", "help"))
 }
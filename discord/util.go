@@ -2,11 +2,14 @@ package discord
 
 import (
 	"Message-Generator/global"
+	"Message-Generator/markov"
 	"Message-Generator/platform/twitch"
 	"Message-Generator/print"
 	"Message-Generator/twitter"
+	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 )
@@ -16,6 +19,77 @@ func WrapInCodeBlock(message string) string {
 	return "```" + message + "```"
 }
 
+// renderParents lists inspected parents with their most recorded children and grandparents, cut short to fit in a Discord message.
+func renderParents(channel string, word string, parents []markov.Parent) string {
+	const maxNeighbours = 5
+	const maxLength = 1900
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("%d parents in %s have [%s] in them.\n", len(parents), channel, word))
+
+	for i, p := range parents {
+		var entry strings.Builder
+		entry.WriteString("\n" + p.Word + "\n")
+
+		entry.WriteString("  Next:")
+		for j, c := range p.Children {
+			if j == maxNeighbours {
+				entry.WriteString(fmt.Sprintf(" and %d more", len(p.Children)-maxNeighbours))
+				break
+			}
+			entry.WriteString(fmt.Sprintf(" [%s] %d", c.Word, c.Value))
+		}
+
+		entry.WriteString("\n  Previous:")
+		for j, g := range p.Grandparents {
+			if j == maxNeighbours {
+				entry.WriteString(fmt.Sprintf(" and %d more", len(p.Grandparents)-maxNeighbours))
+				break
+			}
+			entry.WriteString(fmt.Sprintf(" [%s] %d", g.Word, g.Value))
+		}
+		entry.WriteString("\n")
+
+		if b.Len()+entry.Len() > maxLength {
+			b.WriteString(fmt.Sprintf("\n...and %d more parents.", len(parents)-i))
+			break
+		}
+		b.WriteString(entry.String())
+	}
+
+	return b.String()
+}
+
+// renderChainStats lists a chain's stats.
+func renderChainStats(stats markov.ChainStatistics) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("Chain: %s\n", stats.Chain))
+	b.WriteString(fmt.Sprintf("Parents: %d\n", stats.Parents))
+	b.WriteString(fmt.Sprintf("Edge weight: %d\n", stats.EdgeWeight))
+	b.WriteString(fmt.Sprintf("Words: %d\n", stats.Words))
+	b.WriteString(fmt.Sprintf("Branching entropy: %.2f bits\n", stats.BranchingEntropy))
+	b.WriteString(fmt.Sprintf("Size: %s\n", markov.ByteCountSI(stats.Size)))
+	if !stats.LastWrite.IsZero() {
+		b.WriteString(fmt.Sprintf("Last write: %s\n", stats.LastWrite.Format(time.RFC822)))
+	}
+
+	for _, list := range []struct {
+		name        string
+		frequencies []markov.Frequency
+	}{
+		{"Top words", stats.TopWords},
+		{"Top phrases", stats.TopPhrases},
+		{"Top emotes", stats.TopEmotes},
+	} {
+		b.WriteString("\n" + list.name + ":")
+		for _, f := range list.frequencies {
+			b.WriteString(fmt.Sprintf(" [%s] %d", f.Text, f.Count))
+		}
+	}
+
+	return b.String()
+}
+
 func manuallyTweet(r *discordgo.MessageReactionAdd) {
 	// If message was sent by bot
 	messageInfo, err := discord.ChannelMessage(r.ChannelID, r.MessageID)
@@ -130,6 +204,19 @@ func parseTimeToWait(channelID string, args []string) (time int, success bool) {
 	return time, true
 }
 
+func parseTemperature(channelID string, args []string) (temperature float64, success bool) {
+	if len(args) > 1 || len(args) < 1 {
+		SayByIDAndDelete(channelID, "Please only provide one number.")
+		return temperature, false
+	}
+	temperature, err := strconv.ParseFloat(args[0], 64)
+	if err != nil || temperature < 0 {
+		SayByIDAndDelete(channelID, "Not a positive number.")
+		return temperature, false
+	}
+	return temperature, true
+}
+
 func spiel(channel *global.Directive) (s string) {
 	s = "Which do you want to update?\n"
 	s = s + "\n1. Collecting messages for Markov chains? Currently: " + strconv.FormatBool(channel.Settings.IsCollectingMessages)
@@ -144,6 +231,8 @@ func spiel(channel *global.Directive) (s string) {
 	s = s + "\n10. Allowing participation offline? Currently: " + strconv.FormatBool(channel.Settings.Participation.IsAllowedWhenOffline)
 	s = s + "\n11. Change participation offline wait time? Currently: " + strconv.Itoa(channel.Settings.Participation.OfflineTimeToWait)
 	s = s + "\n12. What chains to use when posting to chat? Currently: " + channel.Settings.WhichChannelsToUse
+	s = s + "\n13. Change reply temperature? Currently: " + strconv.FormatFloat(channel.Settings.Reply.Temperature, 'g', -1, 64)
+	s = s + "\n14. Change participation temperature? Currently: " + strconv.FormatFloat(channel.Settings.Participation.Temperature, 'g', -1, 64)
 	s = s + "\n\nType [cancel] or [done] if you want to cancel or you are done."
 
 	return s
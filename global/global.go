@@ -1,6 +1,7 @@
 package global
 
 import (
+	"net"
 	"os"
 	"regexp"
 	"sync"
@@ -55,6 +56,12 @@ var (
 	BannedUsers []string
 	RegexList   []string
 	Regex       *regexp.Regexp
+
+	// TrustedProxies are the proxies whose X-Forwarded-For header the API believes
+	TrustedProxies []*net.IPNet
+
+	// ChainStore is where markov keeps chains: "json" or blank for a JSON file per chain, or "bolt" for a single bbolt database
+	ChainStore string
 )
 
 func Start() {
@@ -80,6 +87,12 @@ func Start() {
 	TwitterAccessToken = os.Getenv("TWITTER_ACCESS_TOKEN")
 	TwitterAccessTokenSecret = os.Getenv("TWITTER_ACCESS_TOKEN_SECRET")
 
+	// API
+	TrustedProxies = ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+
+	// Markov
+	ChainStore = os.Getenv("CHAIN_STORE")
+
 	LoadChannels()
 	LoadRegex()
 	LoadBannedUsers()
@@ -27,6 +27,7 @@ type PostConditions struct {
 	OnlineTimeToWait     int
 	IsAllowedWhenOffline bool
 	OfflineTimeToWait    int
+	Temperature          float64
 }
 
 type Resource struct {
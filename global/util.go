@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math/big"
+	"net"
 	"os"
 	"regexp"
 	"strings"
@@ -153,3 +154,36 @@ func SaveBannedUsers() error {
 	}
 	return err
 }
+
+// ParseTrustedProxies reads a comma separated list of addresses and CIDR ranges. Entries that are neither are skipped.
+func ParseTrustedProxies(list string) (proxies []*net.IPNet) {
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				fmt.Println("Skipping trusted proxy that is not an address:", entry)
+				continue
+			}
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			fmt.Println("Skipping trusted proxy that is not a range:", entry)
+			continue
+		}
+		proxies = append(proxies, network)
+	}
+
+	return proxies
+}
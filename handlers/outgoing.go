@@ -8,6 +8,7 @@ import (
 	"Message-Generator/platform/twitch"
 	"Message-Generator/print"
 	"Message-Generator/twitter"
+	"errors"
 	"strings"
 	"sync"
 )
@@ -25,9 +26,13 @@ var (
 )
 
 func OutgoingHandler(origin string, sendBackToChannel string, triggerSentence string, oi markov.OutputInstructions, message string, mention string) {
-	// Say message into discord all channel and respective discord channel.
-	discord.Say("all", "Channel: "+oi.Chain+"\nMessage: "+message)
-	discord.Say(oi.Chain, message)
+	chain := chainLabel(oi)
+
+	// Say message into discord all channel and respective discord channel. A blend has no channel of its own.
+	discord.Say("all", "Channel: "+chain+"\nMessage: "+message)
+	if len(oi.Blend) == 0 {
+		discord.Say(oi.Chain, message)
+	}
 
 	// If message is three words or longer, add to potential tweets.
 	// continue
@@ -46,7 +51,7 @@ func OutgoingHandler(origin string, sendBackToChannel string, triggerSentence st
 	// stop
 	if origin == "participation" {
 		twitch.Say(sendBackToChannel, message)
-		discord.Say("participation", "Channel Sent To: "+sendBackToChannel+"\nChannel Used: "+oi.Chain+"\nMethod: "+oi.Method+"\nTarget: "+oi.Target+"\nTrigger Sentence: "+triggerSentence+"\nMessage: "+message)
+		discord.Say("participation", "Channel Sent To: "+sendBackToChannel+"\nChannel Used: "+chain+"\nMethod: "+oi.Method+"\nTarget: "+oi.Target+"\nTrigger Sentence: "+triggerSentence+"\nMessage: "+message)
 		return
 	}
 
@@ -54,7 +59,7 @@ func OutgoingHandler(origin string, sendBackToChannel string, triggerSentence st
 	// stop
 	if origin == "reply" {
 		twitch.Say(sendBackToChannel, "@"+mention+" "+message)
-		discord.Say("reply", "Channel Sent To: "+sendBackToChannel+"\nChannel Used: "+oi.Chain+"\nMethod: "+oi.Method+"\nTarget: "+oi.Target+"\nTrigger Sentence: "+triggerSentence+"\nMessage: @"+mention+" "+message)
+		discord.Say("reply", "Channel Sent To: "+sendBackToChannel+"\nChannel Used: "+chain+"\nMethod: "+oi.Method+"\nTarget: "+strings.TrimSpace(oi.Target+" "+oi.BridgeTarget)+"\nTrigger Sentence: "+triggerSentence+"\nMessage: @"+mention+" "+message)
 		return
 	}
 }
@@ -71,105 +76,89 @@ func CreateDefaultSentence(msg platform.Message) {
 		return
 	}
 
-	var recursionLimit = 5
-	var timesRecursed = 0
+	// Try a few targets, as the one picked might not be in the chain.
+	var oi markov.OutputInstructions
+	var output string
+	var err error
+	for tries := 0; tries < 3; tries++ {
+		target := removeDeterminers(msg.Content)
+		if target == "" {
+			return
+		}
 
-recurse:
-	target := removeDeterminers(msg.Content)
-	if target == "" {
-		return
-	}
+		oi = markov.OutputInstructions{
+			Chain:       msg.ChannelName,
+			Method:      "TargetedMiddle",
+			Target:      target,
+			BackOff:     true,
+			MaxAttempts: 5,
+			Forbidden:   []string{global.BotName},
+			Originality: 6,
+			Accept:      isSentenceLongEnough,
+		}
 
-	oi := markov.OutputInstructions{
-		Chain:  msg.ChannelName,
-		Method: "TargetedMiddle",
-		Target: target,
+		// Get output.
+		output, err = markov.Out(oi)
+		if !errors.Is(err, markov.ErrNoMatchingTarget) {
+			break
+		}
 	}
 
-	// Get output.
-	output, err := markov.Out(oi)
-
 	if err != nil {
-		if timesRecursed > recursionLimit {
-			// If simply not found in chain or chain is too small, ignore error.
-			if strings.Contains(err.Error(), "does not exist in chain") || strings.Contains(err.Error(), "does not contain parents that match") || strings.Contains(err.Error(), "is not found in directory") {
-				return
-			}
-
-			// Report if too many errors.
-			print.Warning("Could not create default sentence.\nError: " + err.Error())
+		switch {
+		// If simply not found in chain or chain is too small, ignore error.
+		case isExpectedOutputError(err), errors.Is(err, markov.ErrEmptyTarget), errors.Is(err, markov.ErrInvalidMethod):
 			return
 		}
 
-		// Recurse.
-		timesRecursed++
-		goto recurse
-	}
-
-	if isSentenceTooShort(output) {
-		// Recurse.
-		timesRecursed++
-		goto recurse
-	}
-
-	if containsOwnName(output) {
-		// Recurse.
-		timesRecursed++
-		goto recurse
+		// Report if too many errors.
+		print.Warning("Could not create default sentence.\nError: " + err.Error())
+		return
 	}
 
 	OutgoingHandler("default", msg.ChannelName, "", oi, output, "")
 }
 
-// CreateAPISentence outputs a likely sentence for the API.
-func CreateAPISentence(channel string) (output string, success bool) {
+// CreateAPISentences outputs up to count different likely sentences for the API.
+func CreateAPISentences(channel string, sampling markov.Sampling, count int) (outputs []string, success bool) {
 	// Allow passage if not currently timed out.
 	if !lockAPI(1, channel) {
-		return "", false
+		return nil, false
 	}
 
-	var recursionLimit = 500
-	var timesRecursed = 0
-
-recurse:
 	oi := markov.OutputInstructions{
-		Chain:  channel,
-		Method: "RandomMiddle",
-	}
-
-	// Get output.
-	output, err := markov.Out(oi)
-
+		Chain:       channel,
+		Method:      "RandomMiddle",
+		BackOff:     true,
+		Sampling:    sampling,
+		MaxAttempts: 50,
+		Forbidden:   []string{global.BotName},
+		Originality: 6,
+		Accept:      isSentenceLongEnough,
+	}
+
+	// Get outputs.
+	outputs, err := markov.OutMany(oi, count)
 	if err != nil {
-		if timesRecursed > recursionLimit {
-			// If simply not found in chain or chain is too small, ignore error.
-			if strings.Contains(err.Error(), "does not exist in chain") || strings.Contains(err.Error(), "does not contain parents that match") || strings.Contains(err.Error(), "is not found in directory") {
-				return
-			}
-
-			// Report if too many errors.
-			print.Warning("Could not create API sentence.\nError: " + err.Error())
-			return "", false
+		switch {
+		// If simply not found in chain or chain is too small, ignore error.
+		case isExpectedOutputError(err), errors.Is(err, markov.ErrInvalidMethod), errors.Is(err, markov.ErrInvalidSampling):
+			return nil, false
 		}
 
-		// Recurse.
-		timesRecursed++
-		goto recurse
-	}
-
-	if isSentenceTooShort(output) {
-		timesRecursed++
-		goto recurse
+		// Report if too many errors.
+		print.Warning("Could not create API sentences.\nError: " + err.Error())
+		return nil, false
 	}
 
-	if containsOwnName(output) {
-		timesRecursed++
-		goto recurse
+	// A batch is reported once, so one request cannot flood Discord or the potential tweets.
+	if len(outputs) == 1 {
+		OutgoingHandler("api", channel, "", oi, outputs[0], "")
+	} else {
+		discord.Say("website-results", batchReport(oi.Chain, outputs))
 	}
 
-	OutgoingHandler("api", channel, "", oi, output, "")
-
-	return output, true
+	return outputs, len(outputs) > 0
 }
 
 // CreateParticipationSentence takes in a message and outputs a targeted sentence without reply a user.
@@ -207,56 +196,52 @@ func CreateParticipationSentence(msg platform.Message, directive global.Directiv
 		}
 	}
 
-	// Try each chain at least 2 times
-	recursionLimit := len(markov.CurrentWorkers())
-	timesRecursed := 0
-
-recurse:
-	target := removeDeterminers(msg.Content)
-	if target == "" {
-		return
-	}
-
-	oi := markov.OutputInstructions{
-		Chain:  decideWhichChannelToUse(directive),
-		Method: "TargetedMiddle",
-		Target: target,
-	}
-
-	// Get output.
-	output, err := markov.Out(oi)
-
-	// Handle error.
-	if err != nil {
-		if strings.Contains(err.Error(), "Target is empty") {
+	// Try up to one chain and target per chain there is, with a couple of attempts each.
+	var oi markov.OutputInstructions
+	var output string
+	var err error
+	for tries := 0; tries <= len(markov.CurrentWorkers()); tries++ {
+		target := removeDeterminers(msg.Content)
+		if target == "" {
 			return
 		}
 
-		// Stop if too much recursing.
-		if timesRecursed > recursionLimit {
-			// If simply not found in chain or chain is too small, ignore error.
-			if strings.Contains(err.Error(), "does not exist in chain") || strings.Contains(err.Error(), "does not contain parents that match") || strings.Contains(err.Error(), "is not found in directory") {
-				return
-			}
+		chain, blend := decideWhichChannelToUse(directive)
+		oi = markov.OutputInstructions{
+			Chain:       chain,
+			Blend:       blend,
+			Method:      "TargetedMiddle",
+			Target:      target,
+			BackOff:     true,
+			Sampling:    markov.Sampling{Temperature: directive.Settings.Participation.Temperature},
+			MaxAttempts: 2,
+			Forbidden:   []string{global.BotName},
+			Originality: 6,
+			Accept:      isSentenceLongEnough,
+		}
 
-			// Report if too many errors.
-			print.Warning("Could not create participation sentence.\nTrigger Message: " + msg.Content + "\n" + "Error: " + err.Error())
-			return
+		// Get output.
+		output, err = markov.Out(oi)
+		if err == nil {
+			break
 		}
 
-		// Recurse.
-		timesRecursed++
-		goto recurse
+		// Retrying will not help, even with another chain.
+		if errors.Is(err, markov.ErrEmptyTarget) || errors.Is(err, markov.ErrInvalidMethod) {
+			return
+		}
 	}
 
-	if isSentenceTooShort(output) {
-		timesRecursed++
-		goto recurse
-	}
+	// Handle error.
+	if err != nil {
+		// If simply not found in chain or chain is too small, ignore error.
+		if isExpectedOutputError(err) {
+			return
+		}
 
-	if containsOwnName(output) {
-		timesRecursed++
-		goto recurse
+		// Report if too many errors.
+		print.Warning("Could not create participation sentence.\nTrigger Message: " + msg.Content + "\n" + "Error: " + err.Error())
+		return
 	}
 
 	// Handle output.
@@ -293,65 +278,67 @@ func CreateReplySentence(msg platform.Message, directive global.Directive) {
 		}
 	}
 
-	// Try each chain at least 2 times
-	recursionLimit := len(markov.CurrentWorkers())
-	timesRecursed := 0
-
-recurse:
+	// Try up to one chain and target per chain there is, with a couple of attempts each.
 	var oi markov.OutputInstructions
+	var output string
+	var err error
+	for tries := 0; tries <= len(markov.CurrentWorkers()); tries++ {
+		chain, blend := decideWhichChannelToUse(directive)
+		questionType := questionType(msg.Content)
+		if questionType == "yes no question" {
+			oi = markov.OutputInstructions{
+				Method: "TargetedBeginning",
+				Chain:  chain,
+				Blend:  blend,
+				Target: global.PickRandomFromSlice([]string{"yes", "no", "maybe", "absolutely", "absolutely", "never", "always"}),
+			}
 
-	questionType := questionType(msg.Content)
-	if questionType == "yes no question" {
-		oi = markov.OutputInstructions{
-			Method: "TargetedBeginning",
-			Chain:  decideWhichChannelToUse(directive),
-			Target: global.PickRandomFromSlice([]string{"yes", "no", "maybe", "absolutely", "absolutely", "never", "always"}),
+			// Answer with the topic of the question somewhere after the answer, if it has one.
+			if topic := removeDeterminers(msg.Content); topic != "" {
+				oi.Method = "TargetedBridge"
+				oi.BridgeTarget = topic
+			}
+		} else {
+			target := removeDeterminers(msg.Content)
+			if target == "" {
+				return
+			}
+
+			oi = markov.OutputInstructions{
+				Method: "TargetedMiddle",
+				Chain:  chain,
+				Blend:  blend,
+				Target: target,
+			}
 		}
-	} else {
-		target := removeDeterminers(msg.Content)
-		if target == "" {
-			return
+		oi.BackOff = true
+		oi.Sampling = markov.Sampling{Temperature: directive.Settings.Reply.Temperature}
+		oi.MaxAttempts = 2
+		oi.Forbidden = []string{global.BotName}
+		oi.Originality = 6
+		oi.Accept = isSentenceLongEnough
+
+		output, err = markov.Out(oi)
+		if err == nil {
+			break
 		}
 
-		oi = markov.OutputInstructions{
-			Method: "TargetedMiddle",
-			Chain:  decideWhichChannelToUse(directive),
-			Target: target,
+		// Retrying will not help, even with another chain.
+		if errors.Is(err, markov.ErrEmptyTarget) || errors.Is(err, markov.ErrInvalidMethod) {
+			return
 		}
 	}
 
-	output, err := markov.Out(oi)
-
 	// Handle error.
 	if err != nil {
-		if strings.Contains(err.Error(), "Target is empty") {
+		// If simply not found in chain or chain is too small, ignore error.
+		if isExpectedOutputError(err) {
 			return
 		}
 
-		if timesRecursed > recursionLimit {
-			// If simply not found in chain or chain is too small, ignore error.
-			if strings.Contains(err.Error(), "does not exist in chain") || strings.Contains(err.Error(), "does not contain parents that match") || strings.Contains(err.Error(), "is not found in directory") {
-				return
-			}
-
-			// Report if too many errors.
-			print.Warning("Could not create reply sentence.\nTrigger Message: " + msg.Content + "\n" + "Error: " + err.Error())
-			return
-		}
-
-		// Recurse.
-		timesRecursed++
-		goto recurse
-	}
-
-	if isSentenceTooShort(output) {
-		timesRecursed++
-		goto recurse
-	}
-
-	if containsOwnName(output) {
-		timesRecursed++
-		goto recurse
+		// Report if too many errors.
+		print.Warning("Could not create reply sentence.\nTrigger Message: " + msg.Content + "\n" + "Error: " + err.Error())
+		return
 	}
 
 	// Handle output.
@@ -3,7 +3,9 @@ package handlers
 import (
 	"Message-Generator/global"
 	"Message-Generator/platform"
+	"errors"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -32,47 +34,50 @@ func removeMentions(message string) (processed string) {
 	return processed
 }
 
-// lowercaseIfNotEmote takes channel and string and returns the string with everything lowercase except any emotes from that channel.
-func lowercaseIfNotEmote(channel string, message string) string {
+// IsEmote returns whether a word is a global emote or an emote of the channel.
+func IsEmote(channel string, word string) bool {
 	global.EmotesMx.Lock()
 	defer global.EmotesMx.Unlock()
-	var new []string
-	slice := strings.Split(message, " ")
-	for _, word := range slice {
-		match := false
-		for _, emote := range global.GlobalEmotes {
-			if word == emote.Name {
-				match = true
-				new = append(new, word)
-				break
-			}
+	return isEmote(channel, word)
+}
+
+// isEmote is IsEmote for when global.EmotesMx is already locked.
+func isEmote(channel string, word string) bool {
+	for _, emote := range global.GlobalEmotes {
+		if word == emote.Name {
+			return true
 		}
+	}
 
-		if !match {
-			for _, emote := range global.TwitchChannelEmotes {
-				if word == emote.Name {
-					match = true
-					new = append(new, word)
-					break
-				}
-			}
+	for _, emote := range global.TwitchChannelEmotes {
+		if word == emote.Name {
+			return true
 		}
+	}
 
-		if !match {
-			for _, c := range global.ThirdPartyChannelEmotes {
-				if c.Name == channel {
-					for _, emote := range c.Emotes {
-						if word == emote.Name {
-							match = true
-							new = append(new, word)
-							break
-						}
-					}
+	for _, c := range global.ThirdPartyChannelEmotes {
+		if c.Name == channel {
+			for _, emote := range c.Emotes {
+				if word == emote.Name {
+					return true
 				}
 			}
 		}
+	}
+
+	return false
+}
 
-		if !match {
+// lowercaseIfNotEmote takes channel and string and returns the string with everything lowercase except any emotes from that channel.
+func lowercaseIfNotEmote(channel string, message string) string {
+	global.EmotesMx.Lock()
+	defer global.EmotesMx.Unlock()
+	var new []string
+	slice := strings.Split(message, " ")
+	for _, word := range slice {
+		if isEmote(channel, word) {
+			new = append(new, word)
+		} else {
 			new = append(new, strings.ToLower(word))
 		}
 	}
@@ -257,18 +262,32 @@ func unlockReply(timer int, channel string) {
 	replyLocks[channel] = false
 	replyLocksMx.Unlock()
 }
-func isSentenceTooShort(sentence string) bool {
+
+// isSentenceLongEnough passes sentences of three words or more, and sentences of one or two words 5% of the time.
+func isSentenceLongEnough(sentence string) bool {
 	// Split sentence into words
 	s := strings.Split(sentence, " ")
 
 	// If there are one to two words, 5% chance to pass
-	if 0 < len(s) && len(s) < 3 {
-		n := global.RandomNumber(0, 100)
-		if n <= 5 {
-			return true
-		}
+	if len(s) < 3 {
+		return global.RandomNumber(0, 100) < 5
 	}
 
+	return true
+}
+
+// isExpectedOutputError returns if an error from markov.Out only means the chain could not make a sentence this time.
+func isExpectedOutputError(err error) bool {
+	switch {
+	case errors.Is(err, markov.ErrDeadEnd),
+		errors.Is(err, markov.ErrNoEnd),
+		errors.Is(err, markov.ErrRejected),
+		errors.Is(err, markov.ErrNoMatchingTarget),
+		errors.Is(err, markov.ErrChainNotFound),
+		errors.Is(err, markov.ErrChainBusy),
+		errors.Is(err, markov.ErrEmptyChain):
+		return true
+	}
 	return false
 }
 
@@ -336,17 +355,23 @@ func questionType(content string) (questionType string) {
 	return "not a question"
 }
 
-func decideWhichChannelToUse(directive global.Directive) string {
+// decideWhichChannelToUse picks the chain to post with, or the chains to blend if the channel blends its custom channels.
+func decideWhichChannelToUse(directive global.Directive) (chain string, blend []markov.BlendChain) {
 	if directive.Settings.WhichChannelsToUse == "self" && directive.Settings.IsCollectingMessages {
-		return directive.ChannelName
+		return directive.ChannelName, nil
+	}
+
+	if directive.Settings.WhichChannelsToUse == "blend" && len(directive.Settings.CustomChannelsToUse) > 0 {
+		blend = parseBlend(directive.Settings.CustomChannelsToUse)
+		return blend[0].Chain, blend
 	}
 
 	if directive.Settings.WhichChannelsToUse == "custom" && len(directive.Settings.CustomChannelsToUse) > 0 {
-		return global.PickRandomFromSlice(directive.Settings.CustomChannelsToUse)
+		return global.PickRandomFromSlice(directive.Settings.CustomChannelsToUse), nil
 	}
 
 	if directive.Settings.WhichChannelsToUse == "all" {
-		return global.PickRandomFromSlice(markov.Chains())
+		return global.PickRandomFromSlice(markov.Chains()), nil
 	}
 
 	// At this point, "directive.Settings.WhichChannelsToUse" will be except self
@@ -357,5 +382,48 @@ func decideWhichChannelToUse(directive global.Directive) string {
 		}
 		s = append(s, chain)
 	}
-	return global.PickRandomFromSlice(s)
+	return global.PickRandomFromSlice(s), nil
+}
+
+// parseBlend reads custom channels written as "channel" or "channel:weight". A channel without a weight, or with one that is not a number, has a weight of 1.
+func parseBlend(channels []string) []markov.BlendChain {
+	var blend []markov.BlendChain
+	for _, channel := range channels {
+		name, weight, found := strings.Cut(channel, ":")
+		w, err := strconv.ParseFloat(weight, 64)
+		if !found || err != nil || w <= 0 {
+			w = 1
+		}
+		blend = append(blend, markov.BlendChain{Chain: name, Weight: w})
+	}
+	return blend
+}
+
+// chainLabel is the name of the chain an output came from, or the names of the chains it was blended from.
+func chainLabel(oi markov.OutputInstructions) string {
+	if len(oi.Blend) == 0 {
+		return oi.Chain
+	}
+
+	var names []string
+	for _, chain := range oi.Blend {
+		names = append(names, chain.Chain)
+	}
+	return strings.Join(names, " + ")
+}
+
+// batchReport lists several outputs in one Discord message, leaving out what does not fit.
+func batchReport(chain string, outputs []string) string {
+	const maxLength = 1900
+
+	report := "Channel: " + chain + "\nMessages:"
+	for i, output := range outputs {
+		line := "\n- " + output
+		if len(report)+len(line) > maxLength {
+			report += "\n...and " + strconv.Itoa(len(outputs)-i) + " more"
+			break
+		}
+		report += line
+	}
+	return report
 }
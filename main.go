@@ -12,6 +12,9 @@ import (
 	"Message-Generator/temp"
 	"Message-Generator/twitter"
 	"context"
+	"fmt"
+	"os"
+	"path/filepath"
 	"time"
 
 	"os/signal"
@@ -40,17 +43,16 @@ func main() {
 	<-ctx.Done()
 	print.Page("Exiting")
 
-	noted := false
-	for {
-		if markov.IsMarkovBusy() {
-			if !noted {
-				print.Info("Markov is busy.")
-				noted = true
-			}
-			time.Sleep(1 * time.Second)
-			continue
-		}
-		break
+	if markov.IsMarkovBusy() {
+		print.Info("Markov is busy.")
+	}
+
+	// Give markov time to finish what it is doing and write what it has not written yet.
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancelShutdown()
+
+	if err := markov.Shutdown(shutdownCtx); err != nil {
+		print.Info("Markov did not finish writing: " + err.Error())
 	}
 
 	print.Page("Exited")
@@ -71,14 +73,27 @@ func Start() {
 	go discord.Start(discordErrorChannel)
 
 	go markovToPrintErrorMessages(printErrorChannel)
-	markov.Start(markov.StartInstructions{
+	store, err := openChainStore()
+	if err != nil {
+		print.Error("Markov could not start: " + err.Error())
+		os.Exit(1)
+	}
+	err = markov.Start(markov.StartInstructions{
 		SeparationKey:       " ",
 		StartKey:            "b5G(n1$I!4g",
 		EndKey:              "e1$D(n7",
 		ShouldZip:           false,
 		DefluffTriggerValue: 15,
+		ShouldDefluff:       false,
 		ErrorChannel:        printErrorChannel,
+		IsEmote:             handlers.IsEmote,
+		Store:               store,
 	})
+	// Files markov can do without are quarantined and reported as it starts, so what is left cannot be recovered from.
+	if err != nil {
+		print.Error("Markov could not start: " + err.Error())
+		os.Exit(1)
+	}
 
 	twitch.GatherEmotes(debug)
 	go twitch.Start(incomingMessages, debug)
@@ -95,3 +110,19 @@ func markovToPrintErrorMessages(printErrorChannel chan error) {
 		print.Error(err.Error())
 	}
 }
+
+// openChainStore opens the store set by CHAIN_STORE. A nil store keeps chains as JSON files.
+func openChainStore() (markov.ChainStore, error) {
+	switch global.ChainStore {
+	case "", "json":
+		return nil, nil
+	case "bolt":
+		store, err := markov.NewBoltStore(filepath.Join("markov-chains", "chains.db"))
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unknown chain store %q, use json or bolt", global.ChainStore)
+	}
+}
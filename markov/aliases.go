@@ -0,0 +1,129 @@
+package markov
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// aliasesPath is kept out of the chain directory itself, where every JSON file is taken for a chain.
+func (e *Engine) aliasesPath() string {
+	return e.path("stats", "aliases.json")
+}
+
+// Alias makes name another name for a chain, so input and outputs for name use the chain instead,
+// such as when a Twitch login is renamed and should keep its history. Aliasing an alias points at the same chain.
+// The chain, or blend, has to exist.
+func (e *Engine) Alias(name, chainName string) error {
+	chainName = e.resolve(chainName)
+
+	switch {
+	case name == "" || chainName == "":
+		return fmt.Errorf("%w: names cannot be empty", ErrInvalidAlias)
+	case name == chainName:
+		return fmt.Errorf("%w: %s cannot be an alias of itself", ErrInvalidAlias, name)
+	case e.chainExists(name):
+		return fmt.Errorf("%w: %s is already a chain", ErrInvalidAlias, name)
+	}
+
+	if _, isBlend := e.blendOf(chainName); !isBlend && !e.chainExists(chainName) {
+		return fmt.Errorf("%w: chain [%s] is not found in directory", ErrChainNotFound, chainName)
+	}
+
+	e.aliasesMx.Lock()
+	defer e.aliasesMx.Unlock()
+
+	e.aliases[name] = chainName
+	if err := e.saveAliases(); err != nil {
+		delete(e.aliases, name)
+		return err
+	}
+
+	return nil
+}
+
+// RemoveAlias stops name being another name for a chain.
+func (e *Engine) RemoveAlias(name string) error {
+	e.aliasesMx.Lock()
+	defer e.aliasesMx.Unlock()
+
+	chainName, exists := e.aliases[name]
+	if !exists {
+		return fmt.Errorf("%w: %s is not an alias", ErrInvalidAlias, name)
+	}
+
+	delete(e.aliases, name)
+	if err := e.saveAliases(); err != nil {
+		e.aliases[name] = chainName
+		return err
+	}
+
+	return nil
+}
+
+// Aliases returns every alias and the chain it is another name for.
+func (e *Engine) Aliases() map[string]string {
+	e.aliasesMx.Lock()
+	defer e.aliasesMx.Unlock()
+
+	aliases := make(map[string]string, len(e.aliases))
+	for name, chainName := range e.aliases {
+		aliases[name] = chainName
+	}
+	return aliases
+}
+
+// resolve returns the chain a name is an alias of, or the name if it is not an alias.
+func (e *Engine) resolve(name string) string {
+	e.aliasesMx.Lock()
+	defer e.aliasesMx.Unlock()
+
+	if chainName, exists := e.aliases[name]; exists {
+		return chainName
+	}
+	return name
+}
+
+// saveAliases writes the aliases to a new file that replaces the old one. aliasesMx has to be locked.
+func (e *Engine) saveAliases() error {
+	data, err := json.MarshalIndent(e.aliases, "", " ")
+	if err != nil {
+		return err
+	}
+
+	newPath := e.path("stats", "aliases_new.json")
+	if err := os.WriteFile(newPath, data, 0666); err != nil {
+		return err
+	}
+
+	return removeAndRename(e.aliasesPath(), newPath)
+}
+
+func (e *Engine) loadAliases() error {
+	e.aliasesMx.Lock()
+	defer e.aliasesMx.Unlock()
+
+	e.aliases = make(map[string]string)
+
+	data, err := os.ReadFile(e.aliasesPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Aliases that cannot be read are set aside, so markov starts without them instead of not starting.
+	if err := json.Unmarshal(data, &e.aliases); err != nil {
+		e.aliases = make(map[string]string)
+
+		path, qErr := e.quarantineFile(e.aliasesPath())
+		if qErr != nil {
+			return errors.Join(err, qErr)
+		}
+		e.reportError(fmt.Errorf("aliases could not be read and were quarantined to %s: %w", path, err))
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package markov
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAlias(t *testing.T) {
+	e := newTestEngine(t, StartInstructions{Order: 1})
+	for _, chain := range []string{"a", "b"} {
+		e.In(chain, "hello there")
+	}
+	if err := e.TempTriggerWrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		alias     string
+		chainName string
+		want      error
+	}{
+		{"chain", "renamed", "a", nil},
+		{"alias of an alias", "renamed again", "renamed", nil},
+		{"empty", "", "a", ErrInvalidAlias},
+		{"itself", "a", "a", ErrInvalidAlias},
+		{"already a chain", "b", "a", ErrInvalidAlias},
+		{"missing chain", "new", "missing", ErrChainNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := e.Alias(tt.alias, tt.chainName); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	want := map[string]string{"renamed": "a", "renamed again": "a"}
+	if aliases := e.Aliases(); len(aliases) != len(want) || aliases["renamed"] != "a" || aliases["renamed again"] != "a" {
+		t.Errorf("aliases are %v, want %v", aliases, want)
+	}
+}
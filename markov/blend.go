@@ -0,0 +1,237 @@
+package markov
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// blendScale is what the shares of a blended parent's children and grandparents are multiplied by to make whole weights.
+const blendScale = 1 << 20
+
+// registerBlend checks a blend and returns the name it is walked under, which is the same for the same chains and weights.
+// Every blend that is registered has to be released with releaseBlend once it is no longer walked.
+func (e *Engine) registerBlend(blend []BlendChain) (name string, err error) {
+	weights := make(map[string]float64)
+	var total float64
+	for _, b := range blend {
+		if b.Weight < 0 || math.IsNaN(b.Weight) || math.IsInf(b.Weight, 0) {
+			return "", fmt.Errorf("%w: weight of chain %s is not a positive number", ErrInvalidBlend, b.Chain)
+		}
+
+		weight := b.Weight
+		if weight == 0 {
+			weight = 1
+		}
+
+		weights[e.resolve(b.Chain)] += weight
+		total += weight
+	}
+	if len(weights) == 0 {
+		return "", fmt.Errorf("%w: no chains", ErrInvalidBlend)
+	}
+
+	var normalized []BlendChain
+	var info ChainInfo
+	for chainName, weight := range weights {
+		if !e.DoesChainFileExist(chainName) {
+			return "", fmt.Errorf("%w: chain [%s] is not found in directory", ErrChainNotFound, chainName)
+		}
+
+		chainInfo, err := e.chainInfo(chainName)
+		if err != nil {
+			return "", e.handleChainError(chainName, err)
+		}
+		if len(normalized) > 0 && chainInfo != info {
+			return "", fmt.Errorf("%w: chain %s is not built the same way as chain %s", ErrIncompatibleChains, chainName, normalized[0].Chain)
+		}
+		info = chainInfo
+
+		normalized = append(normalized, BlendChain{
+			Chain:  chainName,
+			Weight: weight / total,
+		})
+	}
+
+	sort.Slice(normalized, func(i, j int) bool {
+		return normalized[i].Chain < normalized[j].Chain
+	})
+
+	var parts []string
+	for _, b := range normalized {
+		parts = append(parts, b.Chain+":"+strconv.FormatFloat(b.Weight, 'g', 4, 64))
+	}
+	name = "blend(" + strings.Join(parts, ",") + ")"
+
+	e.blendsMx.Lock()
+	e.blends[name] = normalized
+	e.blendUses[name]++
+	e.blendsMx.Unlock()
+
+	return name, nil
+}
+
+// releaseBlend forgets a blend and its index once nothing walks it anymore, so blends made for a single output do not pile up.
+func (e *Engine) releaseBlend(name string) {
+	e.blendsMx.Lock()
+	e.blendUses[name]--
+	unused := e.blendUses[name] <= 0
+	if unused {
+		delete(e.blendUses, name)
+		delete(e.blends, name)
+	}
+	e.blendsMx.Unlock()
+
+	if unused {
+		e.indexesMx.Lock()
+		delete(e.indexes, name)
+		e.indexesMx.Unlock()
+	}
+}
+
+// blendOf returns the chains of a blend, if name is one.
+func (e *Engine) blendOf(name string) (blend []BlendChain, isBlend bool) {
+	e.blendsMx.Lock()
+	defer e.blendsMx.Unlock()
+
+	blend, isBlend = e.blends[name]
+	return blend, isBlend
+}
+
+// chainsOf returns the chains that have to be read for name, which are the chains of a blend or else the chain itself.
+func (e *Engine) chainsOf(name string) []string {
+	blend, isBlend := e.blendOf(name)
+	if !isBlend {
+		return []string{name}
+	}
+
+	var chains []string
+	for _, b := range blend {
+		chains = append(chains, b.Chain)
+	}
+	return chains
+}
+
+// lockChains checks that the chains of name exist and locks their workers, so nothing is written to them while they are read.
+func (e *Engine) lockChains(name string) (workers []*worker, err error) {
+	for _, chainName := range e.chainsOf(name) {
+		if !e.DoesChainFileExist(chainName) {
+			unlockWorkers(workers)
+			return nil, fmt.Errorf("%w: chain [%s] is not found in directory", ErrChainNotFound, chainName)
+		}
+
+		exists, w := e.doesWorkerExist(chainName)
+		if !exists {
+			continue
+		}
+
+		if !w.ChainMx.TryLock() {
+			unlockWorkers(workers)
+			return nil, fmt.Errorf("%w: %s", ErrChainBusy, chainName)
+		}
+		workers = append(workers, w)
+	}
+
+	return workers, nil
+}
+
+func unlockWorkers(workers []*worker) {
+	for _, w := range workers {
+		w.ChainMx.Unlock()
+	}
+}
+
+// blendParent returns a parent with the children and grandparents of the parent in every chain of the blend.
+// Each chain's children (and grandparents) make up its weight's share of them, however many were recorded in it.
+func (e *Engine) blendParent(blend []BlendChain, word string) (p Parent, exists bool, err error) {
+	p.Word = word
+
+	children := make(map[string]int)
+	grandparents := make(map[string]int)
+	for _, b := range blend {
+		chainParent, chainExists, err := e.getParent(b.Chain, word)
+		if err != nil {
+			return p, false, e.handleChainError(b.Chain, err)
+		}
+		if !chainExists {
+			continue
+		}
+		exists = true
+
+		var childTotal, grandparentTotal int
+		for _, c := range chainParent.Children {
+			childTotal += c.Value
+		}
+		for _, g := range chainParent.Grandparents {
+			grandparentTotal += g.Value
+		}
+
+		for _, c := range chainParent.Children {
+			if _, seen := children[c.Word]; !seen {
+				p.Children = append(p.Children, Child{Word: c.Word})
+			}
+			children[c.Word] += blendWeight(b.Weight, int64(c.Value), int64(childTotal))
+		}
+		for _, g := range chainParent.Grandparents {
+			if _, seen := grandparents[g.Word]; !seen {
+				p.Grandparents = append(p.Grandparents, Grandparent{Word: g.Word})
+			}
+			grandparents[g.Word] += blendWeight(b.Weight, int64(g.Value), int64(grandparentTotal))
+		}
+	}
+
+	for i := range p.Children {
+		p.Children[i].Value = children[p.Children[i].Word]
+	}
+	for i := range p.Grandparents {
+		p.Grandparents[i].Value = grandparents[p.Grandparents[i].Word]
+	}
+
+	return p, exists, nil
+}
+
+// blendIndex builds an index of a blend out of the indexes of its chains, weighting every parent the same way as blendParent.
+func (e *Engine) blendIndex(blend []BlendChain) (*chainIndex, error) {
+	ci := newChainIndex()
+	ci.Tails = make(map[string][]string)
+	ci.Heads = make(map[string][]string)
+
+	for _, b := range blend {
+		chainIndex, err := e.getIndex(b.Chain)
+		if err != nil {
+			return nil, e.handleChainError(b.Chain, err)
+		}
+
+		var grandparentSum int64
+		for _, entry := range chainIndex.Entries {
+			grandparentSum += entry.GrandparentWeight
+		}
+
+		for _, word := range chainIndex.Order {
+			entry, exists := ci.Entries[word]
+			if !exists {
+				ci.Order = append(ci.Order, word)
+				e.addBackOffKeys(ci, word)
+			}
+
+			childWeight := int64(blendWeight(b.Weight, chainIndex.Entries[word].ChildWeight, chainIndex.Sum))
+			entry.ChildWeight += childWeight
+			entry.GrandparentWeight += int64(blendWeight(b.Weight, chainIndex.Entries[word].GrandparentWeight, grandparentSum))
+			ci.Entries[word] = entry
+			ci.Sum += childWeight
+		}
+	}
+
+	return ci, nil
+}
+
+// blendWeight returns a chain's weight share of value out of total, as a whole weight that is at least 1 if value is.
+func blendWeight(weight float64, value, total int64) int {
+	if value <= 0 || total <= 0 {
+		return 0
+	}
+
+	return max(1, int(math.Round(weight*float64(value)/float64(total)*blendScale)))
+}
@@ -0,0 +1,320 @@
+package markov
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Every chain is a bucket of its own in a BoltStore, holding its info, how many parents it has, when it was last merged
+// and a bucket of its parents keyed by word.
+var (
+	boltParents = []byte("parents")
+	boltInfo    = []byte("info")
+	boltCount   = []byte("count")
+	boltWritten = []byte("written")
+)
+
+// BoltStore keeps every chain in a single bbolt database file, so a merge only writes the parents it changed instead of rewriting the chain.
+// Every merge is a transaction of its own, so a merge that was cut off by a crash is not in the database when it is next opened.
+type BoltStore struct {
+	path string
+	db   *bolt.DB
+}
+
+// NewBoltStore opens the database file at path, creating it if it does not exist.
+func NewBoltStore(path string) (*BoltStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(path, 0666, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	return &BoltStore{
+		path: path,
+		db:   db,
+	}, nil
+}
+
+// chainError returns the error for a parent of a chain that could not be decoded.
+func (s *BoltStore) chainError(name string, err error) error {
+	return corruptChainError(s.path+": "+name, err)
+}
+
+func (s *BoltStore) Parent(name, word string) (p Parent, exists bool, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(name))
+		if c == nil {
+			return fmt.Errorf("%w: %s", ErrChainNotFound, name)
+		}
+
+		v := c.Bucket(boltParents).Get([]byte(word))
+		if v == nil {
+			return nil
+		}
+
+		if err := json.Unmarshal(v, &p); err != nil {
+			return s.chainError(name, err)
+		}
+		exists = true
+		return nil
+	})
+
+	return p, exists, err
+}
+
+func (s *BoltStore) Count(name string) (parents int, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(name))
+		if c == nil {
+			return fmt.Errorf("%w: %s", ErrChainNotFound, name)
+		}
+
+		parents = int(readUint64(c.Get(boltCount)))
+		return nil
+	})
+
+	return parents, err
+}
+
+func (s *BoltStore) Info(name string) (info ChainInfo, exists bool, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(name))
+		if c == nil {
+			return nil
+		}
+		exists = true
+
+		if v := c.Get(boltInfo); v != nil {
+			if err := json.Unmarshal(v, &info); err != nil {
+				return s.chainError(name, err)
+			}
+		}
+		return nil
+	})
+
+	return info, exists, err
+}
+
+func (s *BoltStore) Merge(name string, info ChainInfo, batch []Parent) error {
+	return s.MergeAndWatch(name, info, batch, nil)
+}
+
+// MergeAndWatch merges like Merge in a single transaction, passing every parent the batch touched to changed once it is committed.
+func (s *BoltStore) MergeAndWatch(name string, info ChainInfo, batch []Parent, changed func(old, updated Parent)) error {
+	existing := make(map[string]Parent, len(batch))
+	merged := make(map[string]Parent, len(batch))
+	var words []string
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		c, err := tx.CreateBucketIfNotExists([]byte(name))
+		if err != nil {
+			return err
+		}
+		parents, err := c.CreateBucketIfNotExists(boltParents)
+		if err != nil {
+			return err
+		}
+
+		// Merge the batch in memory first, as the same word can be in it more than once.
+		for _, p := range batch {
+			existingParent, seen := merged[p.Word]
+			if !seen {
+				words = append(words, p.Word)
+				existingParent = Parent{Word: p.Word}
+
+				if v := parents.Get([]byte(p.Word)); v != nil {
+					if err := json.Unmarshal(v, &existingParent); err != nil {
+						return s.chainError(name, err)
+					}
+				}
+				existing[p.Word] = existingParent
+			}
+
+			merged[p.Word], _ = mergeParent(existingParent, p)
+		}
+
+		count := readUint64(c.Get(boltCount))
+		for _, word := range words {
+			p := merged[word]
+			stored := parents.Get([]byte(word)) != nil
+
+			if len(p.Children) == 0 && len(p.Grandparents) == 0 {
+				if stored {
+					if err := parents.Delete([]byte(word)); err != nil {
+						return err
+					}
+					count--
+				}
+				continue
+			}
+
+			v, err := json.Marshal(p)
+			if err != nil {
+				return err
+			}
+			if err := parents.Put([]byte(word), v); err != nil {
+				return err
+			}
+			if !stored {
+				count++
+			}
+		}
+
+		v, err := json.Marshal(info)
+		if err != nil {
+			return err
+		}
+		if err := c.Put(boltInfo, v); err != nil {
+			return err
+		}
+		if err := c.Put(boltCount, uint64Bytes(count)); err != nil {
+			return err
+		}
+		return c.Put(boltWritten, uint64Bytes(uint64(time.Now().UnixNano())))
+	})
+	if err != nil {
+		return err
+	}
+
+	if changed != nil {
+		for _, word := range words {
+			changed(existing[word], merged[word])
+		}
+	}
+
+	return nil
+}
+
+// Iterate reads every parent of the chain in the order of their words, all in one read transaction.
+func (s *BoltStore) Iterate(name string, fn func(p Parent) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(name))
+		if c == nil {
+			return fmt.Errorf("%w: %s", ErrChainNotFound, name)
+		}
+
+		return c.Bucket(boltParents).ForEach(func(_, v []byte) error {
+			var p Parent
+			if err := json.Unmarshal(v, &p); err != nil {
+				return s.chainError(name, err)
+			}
+
+			return fn(p)
+		})
+	})
+}
+
+// Stat returns how many bytes the chain's parents take up in the database and when it was last merged.
+func (s *BoltStore) Stat(name string) (size int64, modTime time.Time, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(name))
+		if c == nil {
+			return fmt.Errorf("%w: %s", ErrChainNotFound, name)
+		}
+
+		stats := c.Bucket(boltParents).Stats()
+		size = int64(stats.LeafInuse + stats.BranchInuse)
+		if written := readUint64(c.Get(boltWritten)); written > 0 {
+			modTime = time.Unix(0, int64(written))
+		}
+		return nil
+	})
+
+	return size, modTime, err
+}
+
+func (s *BoltStore) Delete(name string) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket([]byte(name))
+	})
+	if errors.Is(err, bolt.ErrBucketNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Quarantine copies a chain as it is, readable or not, into a file of its own in the quarantine folder next to the database file,
+// and then removes the chain. The file has the chain info on its first line and then a parent on every line.
+func (s *BoltStore) Quarantine(name string) (path string, err error) {
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(name))
+		if c == nil {
+			return nil
+		}
+
+		var buf bytes.Buffer
+		buf.Write(c.Get(boltInfo))
+		buf.WriteByte('\n')
+		c.Bucket(boltParents).ForEach(func(_, v []byte) error {
+			buf.Write(v)
+			buf.WriteByte('\n')
+			return nil
+		})
+
+		folder := filepath.Join(filepath.Dir(s.path), "quarantine")
+		if err := os.MkdirAll(folder, 0755); err != nil {
+			return err
+		}
+		path = filepath.Join(folder, name+"_"+strconv.FormatInt(time.Now().Unix(), 10)+".jsonl")
+
+		if err := os.WriteFile(path, buf.Bytes(), 0666); err != nil {
+			os.Remove(path)
+			return err
+		}
+
+		return tx.DeleteBucket([]byte(name))
+	})
+	if err != nil {
+		if path != "" {
+			os.Remove(path)
+		}
+		return "", err
+	}
+
+	return path, nil
+}
+
+// List returns every chain that has at least one parent.
+func (s *BoltStore) List() (chains []string, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, c *bolt.Bucket) error {
+			if readUint64(c.Get(boltCount)) > 0 {
+				chains = append(chains, string(name))
+			}
+			return nil
+		})
+	})
+
+	return chains, err
+}
+
+// Close closes the database file.
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func uint64Bytes(n uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, n)
+	return b
+}
+
+// readUint64 reads a number written by uint64Bytes, or 0 if there is none.
+func readUint64(b []byte) uint64 {
+	if len(b) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
@@ -0,0 +1,97 @@
+package markov
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func openTestBoltStore(t *testing.T, path string) *BoltStore {
+	t.Helper()
+
+	s, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	return s
+}
+
+func TestBoltStoreReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chains.db")
+	s := openTestBoltStore(t, path)
+
+	for i := 0; i < 3; i++ {
+		batch := []Parent{
+			{Word: "a", Children: []Child{{Word: "b", Value: 1}}},
+			{Word: "b", Grandparents: []Grandparent{{Word: "a", Value: 1}}},
+		}
+		if err := s.Merge("c", ChainInfo{Order: 1}, batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Merge("c", ChainInfo{Order: 1}, []Parent{{Word: "b", Grandparents: []Grandparent{{Word: "a", Value: -3}}}}); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	s = openTestBoltStore(t, path)
+	if p, exists, err := s.Parent("c", "a"); err != nil || !exists || p.Children[0].Value != 3 {
+		t.Errorf("parent a is %+v, %v, %v", p, exists, err)
+	}
+	if info, exists, _ := s.Info("c"); !exists || info.Order != 1 {
+		t.Errorf("info is %+v, %v", info, exists)
+	}
+	if count, err := s.Count("c"); err != nil || count != 1 {
+		t.Errorf("count is %d, %v, want 1 after b was removed", count, err)
+	}
+	if _, modTime, err := s.Stat("c"); err != nil || modTime.IsZero() {
+		t.Errorf("last merge is %v, %v", modTime, err)
+	}
+}
+
+func TestBoltStoreQuarantine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chains.db")
+	s := openTestBoltStore(t, path)
+
+	for _, name := range []string{"c", "other"} {
+		if err := s.Merge(name, ChainInfo{Order: 1}, []Parent{{Word: "a", Children: []Child{{Word: "b", Value: 1}}}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Damage parent a of chain c.
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("c")).Bucket(boltParents).Put([]byte("a"), []byte("#damaged"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Parent("c", "a"); !errors.Is(err, ErrCorruptChain) {
+		t.Fatalf("got %v, want ErrCorruptChain", err)
+	}
+
+	quarantinePath, err := s.Quarantine("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists, _ := s.Info("c"); exists {
+		t.Error("quarantined chain is still in the store")
+	}
+	if _, exists, err := s.Parent("other", "a"); err != nil || !exists {
+		t.Errorf("other chain was affected: %v, %v", exists, err)
+	}
+
+	b, err := os.ReadFile(quarantinePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "#damaged") {
+		t.Errorf("quarantined file does not keep the damaged parent:\n%s", b)
+	}
+}
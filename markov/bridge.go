@@ -0,0 +1,188 @@
+package markov
+
+import "fmt"
+
+const (
+	// maxBridgeLength is how many parents a bridge from the target to the bridge target can go through.
+	maxBridgeLength = 8
+	// maxBridgeSearch is how many parents are read while looking for a bridge before giving up.
+	maxBridgeSearch = 2000
+	// maxBridgeTargetLength is how many words a bridge target can have, as the beginnings of it the output ends with are kept as bits.
+	maxBridgeTargetLength = 63
+	// bridgeFound is the bits of a step that finishes the bridge target. The first bit is otherwise never set, as every output ends with no words of it.
+	bridgeFound uint64 = 1
+)
+
+// targetedBridge makes an output that has the target and, somewhere after it, the bridge target.
+// It starts the same way as targetedMiddle, then finds the shortest way from the target to the whole bridge target.
+func (e *Engine) targetedBridge(oi OutputInstructions, info ChainInfo, s *sampler, t targets) (output string, err error) {
+	if oi.Target == "" || oi.BridgeTarget == "" {
+		return "", fmt.Errorf("%w for TargetedBridge, it needs a target and a bridge target", ErrEmptyTarget)
+	}
+
+	if len(t.bridgeTarget) > maxBridgeTargetLength {
+		return "", fmt.Errorf("%w: the bridge target can be at most %d words", ErrInvalidTarget, maxBridgeTargetLength)
+	}
+
+	parentWord, err := e.getParentWithPhrase(oi, s, t.target)
+	if err != nil {
+		return "", err
+	}
+
+	start, remaining, _ := matchPhraseForward(e.words(parentWord), t.target)
+	lastWord, output, err := e.walkForwardThrough(oi, info, s, parentWord, parentWord, remaining)
+	if err != nil {
+		return output, err
+	}
+
+	// The output starts with parentWord, so whatever comes after the phrase in it is already after the target,
+	// and can already have the bridge target or the start of it.
+	partial, found := t.bridgeTarget.advance(0, e.words(output)[start+len(t.target):])
+	if !found {
+		lastWord, output, err = e.bridge(oi, info, s, lastWord, output, t.bridgeTarget, partial)
+		if err != nil {
+			return output, err
+		}
+	}
+
+	output, err = e.walkForward(oi, info, s, lastWord, output)
+	if err != nil {
+		return output, err
+	}
+
+	return e.walkBackward(oi, info, s, parentWord, output)
+}
+
+// bridgeStep is where a bridge can be: at a parent, with the beginnings of the bridge target the output ends with.
+type bridgeStep struct {
+	word    string
+	partial uint64
+}
+
+// bridgeEdge is a way to reach a step from a step one parent closer to where the bridge starts.
+type bridgeEdge struct {
+	from   bridgeStep
+	weight int
+}
+
+// bridge finds the shortest ways forward from parentWord to a parent that finishes the target, and appends one of them to the output.
+// partial is the beginnings of the target the output already ends with, as worked out by advance.
+// Every way that is as short is found, and one is picked through the sampler one parent at a time from the end,
+// each parent by how often it was followed by the one after it. It returns the parent it stopped at.
+func (e *Engine) bridge(oi OutputInstructions, info ChainInfo, s *sampler, parentWord, output string, target phrase, partial uint64) (string, string, error) {
+	name := oi.Chain
+
+	start := bridgeStep{word: parentWord, partial: partial}
+	depth := map[bridgeStep]int{start: 0}
+	previous := make(map[bridgeStep][]bridgeEdge)
+	level := []bridgeStep{start}
+	read := 0
+
+	for length := 0; length < maxBridgeLength && len(level) > 0 && read < maxBridgeSearch; length++ {
+		var nextLevel []bridgeStep
+		goals := make(map[string]int)
+		var goalOrder []string
+
+		for _, step := range level {
+			if read == maxBridgeSearch {
+				break
+			}
+			read++
+
+			currentParent, exists, err := e.getParent(name, step.word)
+			if err != nil {
+				return parentWord, output, err
+			}
+			if !exists {
+				continue
+			}
+
+			for _, child := range currentParent.Children {
+				if child.Word == e.instructions.EndKey {
+					continue
+				}
+
+				partial, found := target.advance(step.partial, e.newWords(info, child.Word, true))
+				if found {
+					if _, seen := goals[child.Word]; !seen {
+						goalOrder = append(goalOrder, child.Word)
+					}
+					goals[child.Word] += child.Value
+					goalStep := bridgeStep{word: child.Word, partial: bridgeFound}
+					previous[goalStep] = append(previous[goalStep], bridgeEdge{from: step, weight: child.Value})
+					continue
+				}
+
+				next := bridgeStep{word: child.Word, partial: partial}
+				d, seen := depth[next]
+				if !seen {
+					depth[next] = length + 1
+					nextLevel = append(nextLevel, next)
+				} else if d != length+1 {
+					continue
+				}
+				previous[next] = append(previous[next], bridgeEdge{from: step, weight: child.Value})
+			}
+		}
+
+		if len(goals) > 0 {
+			choices := make([]Choice, 0, len(goals))
+			for _, word := range goalOrder {
+				choices = append(choices, Choice{Word: word, Weight: goals[word]})
+			}
+			goal, err := s.weightedRandom(choices)
+			if err != nil {
+				return parentWord, output, err
+			}
+
+			path := []string{goal}
+			step := bridgeStep{word: goal, partial: bridgeFound}
+			for {
+				step, err = pickBridgeEdge(s, previous[step])
+				if err != nil {
+					return parentWord, output, err
+				}
+				if step == start {
+					break
+				}
+				path = append(path, step.word)
+			}
+			for i := len(path) - 1; i >= 0; i-- {
+				output = e.appendParent(info, output, path[i])
+			}
+
+			return goal, output, e.acceptPartialOutput(oi, output)
+		}
+
+		level = nextLevel
+	}
+
+	return parentWord, output, fmt.Errorf("%w: %s is not followed by %s within %d parents in chain %s", ErrDeadEnd, parentWord, oi.BridgeTarget, maxBridgeLength, name)
+}
+
+// pickBridgeEdge picks the step a step was reached from through the sampler, by how often each was followed by it.
+// Steps at the same parent add up, as they add the same words to the output.
+func pickBridgeEdge(s *sampler, edges []bridgeEdge) (bridgeStep, error) {
+	weights := make(map[string]int)
+	var choices []Choice
+	for _, edge := range edges {
+		if _, seen := weights[edge.from.word]; !seen {
+			choices = append(choices, Choice{Word: edge.from.word})
+		}
+		weights[edge.from.word] += edge.weight
+	}
+	for i := range choices {
+		choices[i].Weight = weights[choices[i].Word]
+	}
+
+	word, err := s.weightedRandom(choices)
+	if err != nil {
+		return bridgeStep{}, err
+	}
+	for _, edge := range edges {
+		if edge.from.word == word {
+			return edge.from, nil
+		}
+	}
+	return bridgeStep{}, fmt.Errorf("internal error - picked a step that was not offered - pickBridgeEdge")
+}
@@ -0,0 +1,128 @@
+package markov
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPhraseAdvance(t *testing.T) {
+	e := &Engine{instructions: StartInstructions{SeparationKey: " "}}
+	p, err := e.compilePhrase("the big dog", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		partial     uint64
+		words       string
+		wantPartial uint64
+		wantFound   bool
+	}{
+		{"nothing", 0, "a cat", 0, false},
+		{"first word", 0, "a the", 1 << 1, false},
+		{"first two words", 0, "the big", 1 << 2, false},
+		{"whole phrase", 0, "see the big dog!", 0, true},
+		{"finished from before", 1 << 2, "dog", 0, true},
+		{"broken off", 1 << 2, "cat", 0, false},
+		{"started again", 1 << 1, "the", 1 << 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			partial, found := p.advance(tt.partial, strings.Fields(tt.words))
+			if partial != tt.wantPartial || found != tt.wantFound {
+				t.Errorf("got %b, %v, want %b, %v", partial, found, tt.wantPartial, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestBridgePhrase(t *testing.T) {
+	tests := []struct {
+		name     string
+		order    int
+		chunking string
+	}{
+		{"order 1", 1, ""},
+		{"order 2 chunks", 2, "chunks"},
+		{"order 2 sliding", 2, "sliding"},
+	}
+
+	// Whatever the chunking, the bridge target runs over two parents in the first message.
+	messages := []string{
+		"yes i think we had good game today",
+		"i think the stream was a good game",
+		"what a good game that was",
+		"no the game was bad today",
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEngine(t, StartInstructions{Order: tt.order, Chunking: tt.chunking})
+			for _, message := range messages {
+				e.In("c", message)
+			}
+			if err := e.TempTriggerWrite(); err != nil {
+				t.Fatal(err)
+			}
+
+			made := 0
+			for seed := int64(0); seed < 30; seed++ {
+				output, err := e.Out(OutputInstructions{Chain: "c", Method: "TargetedBridge", Target: "yes", BridgeTarget: "good game", Sampling: Sampling{Seed: seed, Seeded: true}})
+				if errors.Is(err, ErrDeadEnd) || errors.Is(err, ErrNoEnd) {
+					continue
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				made++
+
+				padded := " " + output + " "
+				target := strings.Index(padded, " yes ")
+				if target < 0 || !strings.Contains(padded[target:], " good game ") {
+					t.Errorf("%q does not have good game after yes", output)
+				}
+			}
+			if made == 0 {
+				t.Error("no output was made")
+			}
+		})
+	}
+}
+
+func TestBridgeShortestPaths(t *testing.T) {
+	e := newTestEngine(t, StartInstructions{Order: 1})
+	for _, message := range []string{"go left then home", "go right then home"} {
+		e.In("c", message)
+	}
+	if err := e.TempTriggerWrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both ways to home are as short, so both are taken.
+	outputs := make(map[string]bool)
+	for seed := int64(0); seed < 30; seed++ {
+		output, err := e.Out(OutputInstructions{Chain: "c", Method: "TargetedBridge", Target: "go", BridgeTarget: "then home", Sampling: Sampling{Seed: seed, Seeded: true}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs[output] = true
+	}
+
+	want := map[string]bool{"go left then home": true, "go right then home": true}
+	if len(outputs) != len(want) {
+		t.Errorf("outputs are %v, want %v", outputs, want)
+	}
+	for output := range outputs {
+		if !want[output] {
+			t.Errorf("unexpected output %q", output)
+		}
+	}
+
+	_, err := e.Out(OutputInstructions{Chain: "c", Method: "TargetedBridge", Target: "go", BridgeTarget: strings.Repeat("home ", maxBridgeTargetLength+1)})
+	if !errors.Is(err, ErrInvalidTarget) {
+		t.Errorf("got %v for a bridge target that is too long, want ErrInvalidTarget", err)
+	}
+}
@@ -0,0 +1,74 @@
+package markov
+
+// getParent returns the parent for word, adding it if it does not exist yet.
+func (c *chain) getParent(word string) *chainParent {
+	if p, exists := c.parents[word]; exists {
+		return p
+	}
+
+	if c.parents == nil {
+		c.parents = make(map[string]*chainParent)
+	}
+
+	p := &chainParent{
+		Parent: Parent{
+			Word: word,
+		},
+		children:     make(map[string]int),
+		grandparents: make(map[string]int),
+	}
+	c.parents[word] = p
+	c.order = append(c.order, word)
+
+	return p
+}
+
+// addChild records child after parent, seen at the Unix time seen. A seen time of 0 leaves the last seen time as it is.
+func (c *chain) addChild(parent, child string, seen int64) {
+	p := c.getParent(parent)
+
+	if i, exists := p.children[child]; exists {
+		p.Children[i].Value++
+		p.Children[i].LastSeen = max(p.Children[i].LastSeen, seen)
+		return
+	}
+
+	p.children[child] = len(p.Children)
+	p.Children = append(p.Children, Child{
+		Word:     child,
+		Value:    1,
+		LastSeen: seen,
+	})
+}
+
+// addGrandparent records grandparent before parent, seen at the Unix time seen. A seen time of 0 leaves the last seen time as it is.
+func (c *chain) addGrandparent(parent, grandparent string, seen int64) {
+	p := c.getParent(parent)
+
+	if i, exists := p.grandparents[grandparent]; exists {
+		p.Grandparents[i].Value++
+		p.Grandparents[i].LastSeen = max(p.Grandparents[i].LastSeen, seen)
+		return
+	}
+
+	p.grandparents[grandparent] = len(p.Grandparents)
+	p.Grandparents = append(p.Grandparents, Grandparent{
+		Word:     grandparent,
+		Value:    1,
+		LastSeen: seen,
+	})
+}
+
+// Parents returns every parent in the order they were first added, in the format they are stored in.
+func (c *chain) Parents() []Parent {
+	parents := make([]Parent, 0, len(c.order))
+	for _, word := range c.order {
+		parents = append(parents, c.parents[word].Parent)
+	}
+
+	return parents
+}
+
+func (c *chain) Len() int {
+	return len(c.order)
+}
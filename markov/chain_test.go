@@ -0,0 +1,172 @@
+package markov
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// sliceChain is how chains were kept in memory before they were keyed by word, searching every parent, child and grandparent
+// for every word. It is kept to compare ingestion against.
+type sliceChain struct {
+	Parents []Parent
+}
+
+func (c *sliceChain) getParent(word string) *Parent {
+	for i := range c.Parents {
+		if c.Parents[i].Word == word {
+			return &c.Parents[i]
+		}
+	}
+
+	c.Parents = append(c.Parents, Parent{Word: word})
+	return &c.Parents[len(c.Parents)-1]
+}
+
+func (c *sliceChain) addChild(parent, child string) {
+	p := c.getParent(parent)
+	for i := range p.Children {
+		if p.Children[i].Word == child {
+			p.Children[i].Value++
+			return
+		}
+	}
+	p.Children = append(p.Children, Child{Word: child, Value: 1})
+}
+
+func (c *sliceChain) addGrandparent(parent, grandparent string) {
+	p := c.getParent(parent)
+	for i := range p.Grandparents {
+		if p.Grandparents[i].Word == grandparent {
+			p.Grandparents[i].Value++
+			return
+		}
+	}
+	p.Grandparents = append(p.Grandparents, Grandparent{Word: grandparent, Value: 1})
+}
+
+func (c *sliceChain) addContent(slice []string) {
+	c.addChild(slice[0], slice[1])
+	for i := 1; i < len(slice)-1; i++ {
+		c.addChild(slice[i], slice[i+1])
+		c.addGrandparent(slice[i], slice[i-1])
+	}
+	c.addGrandparent(slice[len(slice)-1], slice[len(slice)-2])
+}
+
+// testContent returns n chat-like messages of 3 to 17 words, with words picked from a vocabulary of 20,000 the way words are used.
+func testContent(n int) []string {
+	r := rand.New(rand.NewSource(1))
+	zipf := rand.NewZipf(r, 1.1, 1, 20000)
+
+	content := make([]string, n)
+	for i := range content {
+		words := make([]string, 3+r.Intn(15))
+		for j := range words {
+			words[j] = fmt.Sprint("w", zipf.Uint64())
+		}
+		content[i] = strings.Join(words, " ")
+	}
+
+	return content
+}
+
+// testMessages returns the messages of testContent already split into parents the way In does.
+func testMessages(n int) [][]string {
+	e := &Engine{instructions: StartInstructions{SeparationKey: " ", StartKey: "b5G(n1$I!4g", EndKey: "e1$D(n7"}}
+	info := ChainInfo{Order: 3, Chunking: "chunks"}
+
+	content := testContent(n)
+	messages := make([][]string, n)
+	for i := range content {
+		messages[i] = e.prepareContentForChainProcessing(content[i], info)
+	}
+
+	return messages
+}
+
+func TestChainParents(t *testing.T) {
+	var c chain
+	var baseline sliceChain
+	for _, message := range testMessages(3000) {
+		c.addContent(message, 0)
+		baseline.addContent(message)
+	}
+
+	parents := c.Parents()
+	if c.Len() != len(baseline.Parents) {
+		t.Fatalf("chain has %d parents, want %d", c.Len(), len(baseline.Parents))
+	}
+	if !reflect.DeepEqual(parents, baseline.Parents) {
+		t.Error("chain's parents are not the same as the ones searched for word by word")
+	}
+}
+
+// BenchmarkIn measures everything an input goes through, logging and fingerprinting included, with the engine writing into a temporary directory.
+func BenchmarkIn(b *testing.B) {
+	for _, n := range []int{10000, 100000} {
+		content := testContent(n)
+
+		b.Run(fmt.Sprintf("%dk", n/1000), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				e, err := New(StartInstructions{
+					Directory:     b.TempDir(),
+					SeparationKey: " ",
+					StartKey:      "b5G(n1$I!4g",
+					EndKey:        "e1$D(n7",
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+
+				for _, message := range content {
+					if err := e.In("c", message); err != nil {
+						b.Fatal(err)
+					}
+				}
+
+				b.StopTimer()
+				e.Shutdown(context.Background())
+				b.StartTimer()
+			}
+			b.ReportMetric(float64(n*b.N)/b.Elapsed().Seconds(), "msgs/s")
+		})
+	}
+}
+
+// BenchmarkAddContent compares adding to chains keyed by word with adding to the chains that searched for every word.
+// The baseline only runs for 10k messages, as it takes minutes for 100k.
+func BenchmarkAddContent(b *testing.B) {
+	for _, n := range []int{10000, 100000} {
+		messages := testMessages(n)
+		size := fmt.Sprintf("%dk", n/1000)
+
+		b.Run("indexed/"+size, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				var c chain
+				for _, message := range messages {
+					c.addContent(message, 0)
+				}
+			}
+			b.ReportMetric(float64(n*b.N)/b.Elapsed().Seconds(), "msgs/s")
+		})
+
+		if n > 10000 {
+			continue
+		}
+		b.Run("baseline/"+size, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				var c sliceChain
+				for _, message := range messages {
+					c.addContent(message)
+				}
+			}
+			b.ReportMetric(float64(n*b.N)/b.Elapsed().Seconds(), "msgs/s")
+		})
+	}
+}
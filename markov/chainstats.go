@@ -0,0 +1,231 @@
+package markov
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// topStats is how many words, phrases and emotes chain stats list.
+	topStats = 10
+	// trackedWords is how many of the most recorded words are kept for finding the most recorded emotes.
+	trackedWords = 1000
+)
+
+// ChainStats returns analytics about a chain.
+// They are worked out while the chain's index is first built and are then kept up to date by every write to the chain.
+func (e *Engine) ChainStats(name string) (stats ChainStatistics, err error) {
+	name = e.resolve(name)
+	workers, err := e.lockChains(name)
+	if err != nil {
+		return stats, err
+	}
+	defer unlockWorkers(workers)
+
+	if _, err := e.getIndex(name); err != nil {
+		return stats, e.handleChainError(name, err)
+	}
+
+	// Building the index builds the stats if they are not kept yet.
+	b, _ := e.chainStatsOf(name)
+	stats, words, phrases := b.finish()
+	stats.Chain = name
+	stats.TopWords = topFrequencies(words, topStats)
+	stats.TopPhrases = topFrequencies(phrases, topStats)
+
+	if e.instructions.IsEmote != nil {
+		var emotes []Frequency
+		for _, f := range words {
+			if e.instructions.IsEmote(name, f.Text) {
+				emotes = append(emotes, f)
+			}
+		}
+		stats.TopEmotes = topFrequencies(emotes, topStats)
+	}
+
+	if s, ok := e.store.(sizer); ok {
+		stats.Size, stats.LastWrite, err = s.Stat(name)
+		if err != nil {
+			return stats, err
+		}
+	}
+
+	return stats, nil
+}
+
+// chainStatsBuilder works out chain stats one parent at a time. Parents can be taken out again, so it can follow a chain as it is written.
+// It is given parents as they are stored, so counts are of times recorded and do not decay.
+type chainStatsBuilder struct {
+	stats   ChainStatistics
+	words   map[string]int64
+	phrases map[string]int64
+	entropy float64
+	mx      sync.Mutex
+}
+
+func newChainStatsBuilder() *chainStatsBuilder {
+	return &chainStatsBuilder{
+		words:   make(map[string]int64),
+		phrases: make(map[string]int64),
+	}
+}
+
+func (b *chainStatsBuilder) add(e *Engine, p Parent) {
+	b.apply(e, p, 1)
+}
+
+func (b *chainStatsBuilder) remove(e *Engine, p Parent) {
+	b.apply(e, p, -1)
+}
+
+// change replaces a parent as it was with the parent as it is now.
+func (b *chainStatsBuilder) change(e *Engine, old, updated Parent) {
+	b.apply(e, old, -1)
+	b.apply(e, updated, 1)
+}
+
+// apply adds (sign 1) or takes out (sign -1) a parent. A parent without children and grandparents is not in the chain, so it changes nothing.
+func (b *chainStatsBuilder) apply(e *Engine, p Parent, sign int64) {
+	if len(p.Children) == 0 && len(p.Grandparents) == 0 {
+		return
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	var weight int64
+	for _, c := range p.Children {
+		weight += int64(c.Value)
+	}
+
+	var entropy float64
+	for _, c := range p.Children {
+		share := float64(c.Value) / float64(weight)
+		entropy -= share * math.Log2(share)
+	}
+	b.entropy += entropy * float64(weight*sign)
+
+	b.stats.EdgeWeight += weight * sign
+
+	if p.Word == e.instructions.StartKey || p.Word == e.instructions.EndKey {
+		return
+	}
+
+	b.stats.Parents += int(sign)
+	b.phrases[p.Word] += weight * sign
+	if b.phrases[p.Word] <= 0 {
+		delete(b.phrases, p.Word)
+	}
+	for _, word := range e.words(p.Word) {
+		b.words[word] += weight * sign
+		if b.words[word] <= 0 {
+			delete(b.words, word)
+		}
+	}
+}
+
+// finish returns the chain stats, the most recorded words and how many times every parent was recorded, apart from the start and end key.
+func (b *chainStatsBuilder) finish() (stats ChainStatistics, words, phrases []Frequency) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	stats = b.stats
+	stats.Words = len(b.words)
+	if stats.EdgeWeight > 0 {
+		stats.BranchingEntropy = b.entropy / float64(stats.EdgeWeight)
+	}
+
+	words = make([]Frequency, 0, len(b.words))
+	for word, count := range b.words {
+		words = append(words, Frequency{
+			Text:  word,
+			Count: count,
+		})
+	}
+
+	phrases = make([]Frequency, 0, len(b.phrases))
+	for phrase, count := range b.phrases {
+		phrases = append(phrases, Frequency{
+			Text:  phrase,
+			Count: count,
+		})
+	}
+
+	return stats, topFrequencies(words, trackedWords), phrases
+}
+
+// topFrequencies returns the n most recorded, most recorded first and then alphabetically.
+func topFrequencies(frequencies []Frequency, n int) []Frequency {
+	sorted := append([]Frequency(nil), frequencies...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Count != sorted[j].Count {
+			return sorted[i].Count > sorted[j].Count
+		}
+		return strings.Compare(sorted[i].Text, sorted[j].Text) < 0
+	})
+
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+// sizer is implemented by stores that can tell how much space a chain takes up and when it was last written.
+// A store that does not know when a chain was last written returns the zero time.
+type sizer interface {
+	Stat(chain string) (size int64, modTime time.Time, err error)
+}
+
+// chainStatsOf returns the stats builder kept for a chain, if there is one.
+func (e *Engine) chainStatsOf(name string) (b *chainStatsBuilder, exists bool) {
+	e.chainStatsMx.Lock()
+	defer e.chainStatsMx.Unlock()
+
+	b, exists = e.chainStats[name]
+	return b, exists
+}
+
+// forgetChainStats drops the stats builder of a chain, so it is built again with the chain's index.
+func (e *Engine) forgetChainStats(name string) {
+	e.chainStatsMx.Lock()
+	delete(e.chainStats, name)
+	e.chainStatsMx.Unlock()
+}
+
+// mergeIntoStore merges a batch into a chain and keeps the chain's index and stats up to date with what the merge changed.
+// The chain's worker, if it has one, has to be locked, as the index is changed in place.
+// The index and stats are built again the next time they are needed instead if the store cannot tell what a merge changed
+// or the chain has no worker to keep it from being read meanwhile. The index is also built again if the merge took a parent out of the chain,
+// while the stats are kept up to date without it.
+func (e *Engine) mergeIntoStore(name string, info ChainInfo, batch []Parent) error {
+	defer e.forgetBlendIndexes(name)
+
+	b, hasStats := e.chainStatsOf(name)
+	ci, hasIndex := e.cachedIndex(name)
+	hasWorker, _ := e.doesWorkerExist(name)
+	w, ok := e.store.(changeWatcher)
+	if !hasStats && !hasIndex || !hasWorker || !ok {
+		e.forgetChainStats(name)
+		e.forgetIndex(name)
+		return e.store.Merge(name, info, batch)
+	}
+
+	now := time.Now()
+	removed := false
+	err := w.MergeAndWatch(name, info, batch, func(old, updated Parent) {
+		if hasStats {
+			b.change(e, old, updated)
+		}
+		if hasIndex && !ci.update(e, updated, now) {
+			removed = true
+		}
+	})
+	if err != nil || removed {
+		e.forgetIndex(name)
+	}
+
+	return err
+}
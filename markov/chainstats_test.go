@@ -0,0 +1,89 @@
+package markov
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestChainStatsIncremental(t *testing.T) {
+	write := func(messages ...string) func(t *testing.T, e *Engine) {
+		return func(t *testing.T, e *Engine) {
+			for _, message := range messages {
+				e.In("c", message)
+			}
+			if err := e.TempTriggerWrite(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	tests := []struct {
+		name  string
+		steps []func(t *testing.T, e *Engine)
+	}{
+		{"written", []func(t *testing.T, e *Engine){
+			write("the cat sat down", "a dog ran off the mat"),
+		}},
+		{"written again", []func(t *testing.T, e *Engine){
+			write("the cat sat down", "the cat sat on my lap"),
+			write("hello there"),
+		}},
+		{"cleansed", []func(t *testing.T, e *Engine){
+			write("a dog ran off the mat", "the cat sat down"),
+			func(t *testing.T, e *Engine) {
+				if _, err := e.Cleanse("dog", ""); err != nil {
+					t.Fatal(err)
+				}
+			},
+		}},
+		{"defluffed", []func(t *testing.T, e *Engine){
+			write("the cat sat down", "a dog ran off the mat"),
+			func(t *testing.T, e *Engine) {
+				if _, err := e.Defluff(); err != nil {
+					t.Fatal(err)
+				}
+			},
+			write("hello there"),
+		}},
+	}
+
+	for _, store := range testStores() {
+		for _, tt := range tests {
+			t.Run(store.name+"/"+tt.name, func(t *testing.T) {
+				e := newTestEngine(t, StartInstructions{Store: store.open(t), Order: 2, DefluffTriggerValue: 2})
+
+				// Stats worked out once are kept up to date from then on.
+				write("the cat sat on the mat", "the cat sat on the mat")(t, e)
+				if _, err := e.ChainStats("c"); err != nil {
+					t.Fatal(err)
+				}
+				for _, step := range tt.steps {
+					step(t, e)
+				}
+				if _, kept := e.chainStatsOf("c"); !kept {
+					t.Fatal("stats were not kept")
+				}
+
+				got, err := e.ChainStats("c")
+				if err != nil {
+					t.Fatal(err)
+				}
+				e.forgetChainStats("c")
+				e.forgetIndex("c")
+				want, err := e.ChainStats("c")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if math.Abs(got.BranchingEntropy-want.BranchingEntropy) > 1e-9 {
+					t.Errorf("branching entropy is %v, want %v", got.BranchingEntropy, want.BranchingEntropy)
+				}
+				got.BranchingEntropy, want.BranchingEntropy = 0, 0
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("kept stats are %+v, want %+v", got, want)
+				}
+			})
+		}
+	}
+}
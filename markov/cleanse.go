@@ -1,136 +1,86 @@
 package markov
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
-	"regexp"
 )
 
 // Cleanse will go through every chain and remove any mention of the entry.
-func Cleanse(entry string) (totalCleansed int) {
-	busy.Lock()
-	defer busy.Unlock()
-	defer duration(track("cleanse duration"))
-
-	for _, chain := range Chains() {
-		if exists, w := doesWorkerExist(chain); exists {
-			w.ChainMx.Lock()
-			totalCleansed += cleanseBody(chain, entry)
-			w.ChainMx.Unlock()
-		}
-	}
-
-	debugLog("Total cleansed:", totalCleansed)
-	return totalCleansed
-}
-
-func cleanseBody(chain, entry string) (removed int) {
-	defaultPath := "./markov-chains/" + chain + ".json"
-	newPath := "./markov-chains/" + chain + "_defluffed.json"
-
-	// Open existing chain file
-	f, err := os.Open(defaultPath)
+// The entry is matched the same way as a target with the given matching, see OutputInstructions.
+// A chain that fails to be cleansed is skipped and its error is returned together with the others.
+func (e *Engine) Cleanse(entry, matching string) (totalCleansed int, err error) {
+	p, err := e.compilePhrase(entry, matching)
 	if err != nil {
-		panic(err)
+		return 0, err
 	}
 
-	// Start a new decoder
-	dec := json.NewDecoder(f)
+	e.busy.Lock()
+	defer e.busy.Unlock()
+	defer e.duration(track("cleanse duration"))
 
-	// Get beginning token
-	_, err = dec.Token()
-	if err != nil {
-		panic(err)
-	}
+	var errs []error
+	for _, chain := range e.Chains() {
+		if exists, w := e.doesWorkerExist(chain); exists {
+			w.ChainMx.Lock()
+			removed, err := e.cleanseBody(chain, p)
+			w.ChainMx.Unlock()
 
-	// Create a new chain file
-	fN, err := os.Create(newPath)
-	if err != nil {
-		panic(err)
-	}
+			if err != nil {
+				errs = append(errs, e.handleChainError(chain, fmt.Errorf("cleansing chain %s: %w", chain, err)))
+				continue
+			}
 
-	// Start the new file encoder
-	var enc encode
-	if err = StartEncoder(&enc, fN); err != nil {
-		panic(err)
+			totalCleansed += removed
+		}
 	}
 
-	// For everything in old file
-	for dec.More() {
-		var existingParent parent
-		var updatedParent parent
-
-		err := dec.Decode(&existingParent)
-		if err != nil {
-			panic(err)
-		}
+	e.debugLog("Total cleansed:", totalCleansed)
+	return totalCleansed, errors.Join(errs...)
+}
 
-		// Do for every parent except start key
-		if existingParent.Word != instructions.EndKey {
+func (e *Engine) cleanseBody(chain string, p phrase) (removed int, err error) {
+	err = e.rewriteChain(chain, func(existingParent Parent) (updatedParent Parent, keep bool) {
+		// Do for every parent except end key
+		if existingParent.Word != e.instructions.EndKey {
 			for _, eChild := range existingParent.Children {
-				if matches, _ := regexp.MatchString("\\b"+entry+"\\b", eChild.Word); matches {
+				if p.in(e.words(eChild.Word)) {
 					removed++
 					continue
 				}
 
 				// Add child into new list
-				updatedParent.Children = append(updatedParent.Children, child{
-					Word:  eChild.Word,
-					Value: eChild.Value,
+				updatedParent.Children = append(updatedParent.Children, Child{
+					Word:     eChild.Word,
+					Value:    eChild.Value,
+					LastSeen: eChild.LastSeen,
 				})
 			}
 		}
 
 		// Do for every parent except start key
-		if existingParent.Word != instructions.StartKey {
+		if existingParent.Word != e.instructions.StartKey {
 			for _, eGrandparent := range existingParent.Grandparents {
-				if matches, _ := regexp.MatchString("\\b"+entry+"\\b", eGrandparent.Word); matches {
+				if p.in(e.words(eGrandparent.Word)) {
 					removed++
 					continue
 				}
 
 				// Add grandparent into new list
-				updatedParent.Grandparents = append(updatedParent.Grandparents, grandparent{
-					Word:  eGrandparent.Word,
-					Value: eGrandparent.Value,
+				updatedParent.Grandparents = append(updatedParent.Grandparents, Grandparent{
+					Word:     eGrandparent.Word,
+					Value:    eGrandparent.Value,
+					LastSeen: eGrandparent.LastSeen,
 				})
 			}
 		}
 
-		if matches, _ := regexp.MatchString("\\b"+entry+"\\b", existingParent.Word); matches {
-			continue
+		if p.in(e.words(existingParent.Word)) {
+			return updatedParent, false
 		}
 
 		updatedParent.Word = existingParent.Word
-		err = enc.AddEntry(updatedParent)
-		if err != nil {
-			panic(err)
-		}
-
-		fmt.Println(existingParent)
-		fmt.Println(updatedParent)
-	}
-
-	// Close the new file encoder
-	if err := enc.CloseEncoder(); err != nil {
-		panic(err)
-	}
-
-	// Close new file
-	err = fN.Close()
-	if err != nil {
-		panic(err)
-	}
-
-	// Close old file
-	err = f.Close()
-	if err != nil {
-		panic(err)
-	}
-
-	// Remove the old file and rename the new file with the old file name
-	removeAndRename(defaultPath, newPath)
+		return updatedParent, true
+	})
 
-	return removed
+	return removed, err
 }
@@ -0,0 +1,89 @@
+package markov
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// checkConstraints returns an error if the output instructions' constraints can never be met.
+func checkConstraints(oi OutputInstructions) error {
+	switch {
+	case oi.MinWords < 0, oi.MaxWords < 0, oi.MaxAttempts < 0, oi.Originality < 0:
+		return fmt.Errorf("%w: MinWords, MaxWords, MaxAttempts and Originality cannot be negative", ErrInvalidConstraints)
+	case oi.MaxWords > 0 && oi.MinWords > oi.MaxWords:
+		return fmt.Errorf("%w: MinWords is more than MaxWords", ErrInvalidConstraints)
+	}
+
+	for _, forbidden := range oi.Forbidden {
+		if forbidden == "" {
+			return fmt.Errorf("%w: forbidden strings cannot be empty", ErrInvalidConstraints)
+		}
+	}
+
+	return nil
+}
+
+// acceptPartialOutput checks an output that is still being walked, so that an output that is already too long
+// or already contains a forbidden string is given up on without walking the rest of it.
+func (e *Engine) acceptPartialOutput(oi OutputInstructions, output string) error {
+	if oi.MaxWords > 0 {
+		if words := e.wordCount(output); words > oi.MaxWords {
+			return fmt.Errorf("%w: more than %d words", ErrRejected, oi.MaxWords)
+		}
+	}
+
+	for _, forbidden := range oi.Forbidden {
+		if strings.Contains(output, forbidden) {
+			return fmt.Errorf("%w: contains %q", ErrRejected, forbidden)
+		}
+	}
+
+	return nil
+}
+
+// acceptOutput checks a finished output against every constraint in the output instructions.
+func (e *Engine) acceptOutput(oi OutputInstructions, output string) error {
+	if err := e.acceptPartialOutput(oi, output); err != nil {
+		return err
+	}
+
+	if words := e.wordCount(output); words < oi.MinWords {
+		return fmt.Errorf("%w: %d words is less than %d", ErrRejected, words, oi.MinWords)
+	}
+
+	if oi.Accept != nil && !oi.Accept(output) {
+		return fmt.Errorf("%w: not accepted", ErrRejected)
+	}
+
+	return nil
+}
+
+// acceptOriginalOutput checks that an output does not copy a message any of the chains was given, if the output instructions ask for it.
+func (e *Engine) acceptOriginalOutput(oi OutputInstructions, workers []*worker, output string) error {
+	if oi.Originality <= 0 {
+		return nil
+	}
+
+	words := e.words(output)
+	for _, w := range workers {
+		if w.Fingerprints != nil && w.Fingerprints.copies(words, oi.Originality, e.instructions.SeparationKey) {
+			return fmt.Errorf("%w: copies a message of chain %s", ErrRejected, w.Name)
+		}
+	}
+
+	return nil
+}
+
+func (e *Engine) wordCount(output string) int {
+	if output == "" {
+		return 0
+	}
+
+	return strings.Count(output, e.instructions.SeparationKey) + 1
+}
+
+// isRetryable returns whether another attempt at the same output instructions could succeed.
+func isRetryable(err error) bool {
+	return errors.Is(err, ErrRejected) || errors.Is(err, ErrDeadEnd) || errors.Is(err, ErrNoEnd)
+}
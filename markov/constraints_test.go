@@ -0,0 +1,116 @@
+package markov
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCheckConstraints(t *testing.T) {
+	tests := []struct {
+		name    string
+		oi      OutputInstructions
+		wantErr bool
+	}{
+		{"none", OutputInstructions{}, false},
+		{"min and max", OutputInstructions{MinWords: 2, MaxWords: 5}, false},
+		{"min without max", OutputInstructions{MinWords: 20}, false},
+		{"min equal to max", OutputInstructions{MinWords: 3, MaxWords: 3}, false},
+		{"min more than max", OutputInstructions{MinWords: 5, MaxWords: 2}, true},
+		{"negative min", OutputInstructions{MinWords: -1}, true},
+		{"negative max", OutputInstructions{MaxWords: -1}, true},
+		{"negative attempts", OutputInstructions{MaxAttempts: -1}, true},
+		{"forbidden", OutputInstructions{Forbidden: []string{"bad"}}, false},
+		{"empty forbidden", OutputInstructions{Forbidden: []string{"bad", ""}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkConstraints(tt.oi)
+			if tt.wantErr != errors.Is(err, ErrInvalidConstraints) || !tt.wantErr && err != nil {
+				t.Errorf("got %v, want an error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAcceptOutput(t *testing.T) {
+	e := &Engine{instructions: StartInstructions{SeparationKey: " "}}
+
+	tests := []struct {
+		name        string
+		oi          OutputInstructions
+		output      string
+		wantPartial bool
+		want        bool
+	}{
+		{"no constraints", OutputInstructions{}, "hello there", true, true},
+		{"enough words", OutputInstructions{MinWords: 2}, "hello there", true, true},
+		{"too few words", OutputInstructions{MinWords: 3}, "hello there", true, false},
+		{"few enough words", OutputInstructions{MaxWords: 2}, "hello there", true, true},
+		{"too many words", OutputInstructions{MaxWords: 1}, "hello there", false, false},
+		{"forbidden string", OutputInstructions{Forbidden: []string{"ell"}}, "hello there", false, false},
+		{"forbidden string missing", OutputInstructions{Forbidden: []string{"bye"}}, "hello there", true, true},
+		{"accepted", OutputInstructions{Accept: func(string) bool { return true }}, "hello there", true, true},
+		{"not accepted", OutputInstructions{Accept: func(string) bool { return false }}, "hello there", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A partial output is only checked for what cannot get better by walking further.
+			if err := e.acceptPartialOutput(tt.oi, tt.output); (err == nil) != tt.wantPartial || err != nil && !errors.Is(err, ErrRejected) {
+				t.Errorf("partial output: got %v, want it accepted: %v", err, tt.wantPartial)
+			}
+			if err := e.acceptOutput(tt.oi, tt.output); (err == nil) != tt.want || err != nil && !errors.Is(err, ErrRejected) {
+				t.Errorf("output: got %v, want it accepted: %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutWithAttempts(t *testing.T) {
+	e := newTestEngine(t, StartInstructions{Order: 1})
+	for _, message := range []string{"the cat sat on the mat", "the dog sat on the rug", "the cat ate the fish", "hi", "ok then", "bot said hello world to everyone here today"} {
+		e.In("c", message)
+	}
+	if err := e.TempTriggerWrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		oi           OutputInstructions
+		wantErr      error
+		wantAttempts int
+	}{
+		{"met", OutputInstructions{Method: "RandomMiddle", MinWords: 3, MaxWords: 6, Forbidden: []string{"bot"}, MaxAttempts: 200}, nil, 0},
+		{"never accepted", OutputInstructions{Method: "LikelyBeginning", MaxAttempts: 7, Accept: func(string) bool { return false }}, ErrRejected, 7},
+		{"one attempt if left blank", OutputInstructions{Method: "LikelyBeginning", Accept: func(string) bool { return false }}, ErrRejected, 1},
+		{"cannot be met", OutputInstructions{Method: "LikelyBeginning", MinWords: 5, MaxWords: 2}, ErrInvalidConstraints, 0},
+		{"not retried", OutputInstructions{Method: "TargetedMiddle", Target: "zebra", MaxAttempts: 9}, ErrNoMatchingTarget, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.oi.Chain = "c"
+
+			for i := 0; i < 20; i++ {
+				output, attempts, err := e.OutWithAttempts(tt.oi)
+				if tt.wantErr != nil {
+					if !errors.Is(err, tt.wantErr) || attempts != tt.wantAttempts {
+						t.Fatalf("got %v after %d attempts, want %v after %d", err, attempts, tt.wantErr, tt.wantAttempts)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				words := len(strings.Fields(output))
+				if words < tt.oi.MinWords || words > tt.oi.MaxWords || strings.Contains(output, "bot") {
+					t.Errorf("%q does not meet the constraints", output)
+				}
+			}
+		})
+	}
+}
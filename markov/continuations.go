@@ -0,0 +1,253 @@
+package markov
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxStateParents is how many parents are added together when a state is not a parent itself.
+const maxStateParents = 100
+
+// Next returns what the chain recorded after a state, most likely first.
+// The state is the words so far, or blank for how messages begin. If the state is not a parent, what was recorded after
+// the parents that end with the same words is added together, dropping one word at a time until some are found, like BackOff.
+// A state that stops partway through a parent, taking it to start where messages start, is continued with the rest of that parent instead.
+func (e *Engine) Next(chainName, state string) (continuations []Continuation, err error) {
+	return e.continuations(chainName, state, true)
+}
+
+// Previous returns what the chain recorded before a state, most likely first.
+// The state is the words so far, or blank for how messages end. It is found the same way as in Next, using the parents that start with the same words.
+func (e *Engine) Previous(chainName, state string) (continuations []Continuation, err error) {
+	return e.continuations(chainName, state, false)
+}
+
+func (e *Engine) continuations(chainName, state string, forward bool) (continuations []Continuation, err error) {
+	chainName = e.resolve(chainName)
+	workers, err := e.lockChains(chainName)
+	if err != nil {
+		return nil, err
+	}
+	defer unlockWorkers(workers)
+
+	info, err := e.chainInfo(chainName)
+	if err != nil {
+		return nil, e.handleChainError(chainName, err)
+	}
+
+	// A state that stops partway through a parent is finished first, as no parent ends with it.
+	if forward {
+		continuations, err = e.completions(chainName, info, state)
+		if err != nil {
+			return nil, e.handleChainError(chainName, err)
+		}
+		if len(continuations) > 0 {
+			return continuations, nil
+		}
+	}
+
+	parentWords, err := e.stateParents(chainName, state, forward)
+	if err != nil {
+		return nil, e.handleChainError(chainName, err)
+	}
+
+	weights := make(map[string]int)
+	var order []string
+	var total int
+	add := func(word string, value int) {
+		if _, seen := weights[word]; !seen {
+			order = append(order, word)
+		}
+		weights[word] += value
+		total += value
+	}
+
+	for _, parentWord := range parentWords {
+		p, exists, err := e.getParent(chainName, parentWord)
+		if err != nil {
+			return nil, e.handleChainError(chainName, err)
+		}
+		if !exists {
+			continue
+		}
+
+		if forward {
+			for _, c := range p.Children {
+				add(c.Word, c.Value)
+			}
+		} else {
+			for _, g := range p.Grandparents {
+				add(g.Word, g.Value)
+			}
+		}
+	}
+
+	if total == 0 {
+		return nil, fmt.Errorf("%w: nothing recorded for [%s] in chain %s", ErrUnknownState, state, chainName)
+	}
+
+	for _, word := range order {
+		c := Continuation{
+			Word:        word,
+			Weight:      weights[word],
+			Probability: float64(weights[word]) / float64(total),
+		}
+
+		switch {
+		case word == e.instructions.StartKey || word == e.instructions.EndKey:
+			c.Edge = true
+		case state == "":
+			// The first parent of a walk adds all of its words.
+			c.Text = word
+		default:
+			c.Text = strings.Join(e.newWords(info, word, forward), e.instructions.SeparationKey)
+		}
+
+		continuations = append(continuations, c)
+	}
+
+	sort.SliceStable(continuations, func(i, j int) bool {
+		return continuations[i].Weight > continuations[j].Weight
+	})
+
+	return continuations, nil
+}
+
+// stateParents returns the parents whose continuations make up a state's, preferring the ones that share the most words with it.
+func (e *Engine) stateParents(chainName, state string, forward bool) (parentWords []string, err error) {
+	if state == "" {
+		if forward {
+			return []string{e.instructions.StartKey}, nil
+		}
+		return []string{e.instructions.EndKey}, nil
+	}
+
+	ci, err := e.getIndex(chainName)
+	if err != nil {
+		return nil, err
+	}
+
+	words := e.words(state)
+	for k := len(words); k > 0; k-- {
+		var candidates []string
+		if forward {
+			candidates = ci.Tails[strings.Join(words[len(words)-k:], e.instructions.SeparationKey)]
+		} else {
+			candidates = ci.Heads[strings.Join(words[:k], e.instructions.SeparationKey)]
+		}
+
+		weight := func(word string) int64 {
+			if forward {
+				return ci.Entries[word].ChildWeight
+			}
+			return ci.Entries[word].GrandparentWeight
+		}
+
+		parentWords = nil
+		for _, word := range candidates {
+			if weight(word) > 0 {
+				parentWords = append(parentWords, word)
+			}
+		}
+
+		if len(parentWords) == 0 {
+			continue
+		}
+
+		sort.SliceStable(parentWords, func(i, j int) bool {
+			return weight(parentWords[i]) > weight(parentWords[j])
+		})
+		if len(parentWords) > maxStateParents {
+			parentWords = parentWords[:maxStateParents]
+		}
+
+		return parentWords, nil
+	}
+
+	return nil, nil
+}
+
+// completions returns the rest of the parent a state stops partway through, most likely first, if it does.
+// States are taken to start where messages start, so in chunks the unfinished parent is whatever is left after the last whole chunk,
+// and in sliding the state is unfinished while it is shorter than a parent.
+// The parents recorded after the last whole chunk that start with the leftover words are preferred over any parent that does.
+func (e *Engine) completions(chainName string, info ChainInfo, state string) (continuations []Continuation, err error) {
+	if state == "" {
+		return nil, nil
+	}
+
+	words := e.words(state)
+	leftover := len(words) % info.Order
+	if info.Chunking == "sliding" && len(words) >= info.Order {
+		leftover = 0
+	}
+	if leftover == 0 {
+		return nil, nil
+	}
+	unfinished := strings.Join(words[len(words)-leftover:], e.instructions.SeparationKey)
+
+	startsWithUnfinished := func(parentWord string) bool {
+		parentWords := e.words(parentWord)
+		return len(parentWords) > leftover && strings.Join(parentWords[:leftover], e.instructions.SeparationKey) == unfinished
+	}
+
+	previous := e.instructions.StartKey
+	if whole := words[:len(words)-leftover]; len(whole) > 0 {
+		previous = strings.Join(whole[len(whole)-info.Order:], e.instructions.SeparationKey)
+	}
+
+	weights := make(map[string]int)
+	var order []string
+	var total int
+	add := func(word string, value int) {
+		if _, seen := weights[word]; !seen {
+			order = append(order, word)
+		}
+		weights[word] += value
+		total += value
+	}
+
+	p, exists, err := e.getParent(chainName, previous)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		for _, c := range p.Children {
+			if startsWithUnfinished(c.Word) {
+				add(c.Word, c.Value)
+			}
+		}
+	}
+
+	if total == 0 {
+		ci, err := e.getIndex(chainName)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, parentWord := range ci.Heads[unfinished] {
+			if weight := int(ci.Entries[parentWord].ChildWeight); weight > 0 && startsWithUnfinished(parentWord) {
+				add(parentWord, weight)
+			}
+		}
+	}
+
+	for _, word := range order {
+		continuations = append(continuations, Continuation{
+			Word:        word,
+			Text:        strings.Join(e.words(word)[leftover:], e.instructions.SeparationKey),
+			Weight:      weights[word],
+			Probability: float64(weights[word]) / float64(total),
+		})
+	}
+
+	sort.SliceStable(continuations, func(i, j int) bool {
+		return continuations[i].Weight > continuations[j].Weight
+	})
+	if len(continuations) > maxStateParents {
+		continuations = continuations[:maxStateParents]
+	}
+
+	return continuations, nil
+}
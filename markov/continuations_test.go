@@ -0,0 +1,115 @@
+package markov
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestContinuations(t *testing.T) {
+	type want struct {
+		text   string
+		weight int
+	}
+
+	tests := []struct {
+		name     string
+		chunking string
+		forward  bool
+		state    string
+		want     []want
+		err      error
+	}{
+		{"how messages begin", "chunks", true, "", []want{{"the cat", 3}, {"my cat", 1}}, nil},
+		{"after a parent", "chunks", true, "the cat", []want{{"sat on", 2}, {"ate the", 1}}, nil},
+		{"after the last word of parents", "chunks", true, "cat", []want{{"sat on", 2}, {"ate the", 1}, {"sat down", 1}}, nil},
+		{"after an unknown word then a known one", "chunks", true, "zebra cat", []want{{"sat on", 2}, {"ate the", 1}, {"sat down", 1}}, nil},
+		{"after an unknown word", "chunks", true, "zebra", nil, ErrUnknownState},
+		{"sliding after a parent", "sliding", true, "the cat", []want{{"sat", 2}, {"ate", 1}}, nil},
+		{"sliding after a word", "sliding", true, "cat", []want{{"sat", 3}, {"ate", 1}}, nil},
+		{"how messages end", "chunks", false, "", []want{{"the mat", 1}, {"the rug", 1}, {"fish", 1}, {"sat down", 1}}, nil},
+		{"before a message", "chunks", false, "the cat", []want{{"", 3}}, nil},
+		{"sliding before a word", "sliding", false, "cat", []want{{"the", 3}, {"my", 1}}, nil},
+		{"before an unknown word", "chunks", false, "zebra", nil, ErrUnknownState},
+	}
+
+	engines := make(map[string]*Engine)
+	for _, chunking := range []string{"chunks", "sliding"} {
+		e := newTestEngine(t, StartInstructions{Order: 2, Chunking: chunking})
+		for _, message := range []string{"the cat sat on the mat", "the cat sat on the rug", "the cat ate the fish", "my cat sat down"} {
+			e.In("c", message)
+		}
+		if err := e.TempTriggerWrite(); err != nil {
+			t.Fatal(err)
+		}
+		engines[chunking] = e
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := engines[tt.chunking]
+			next := e.Next
+			if !tt.forward {
+				next = e.Previous
+			}
+
+			continuations, err := next("c", tt.state)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+			if len(continuations) != len(tt.want) {
+				t.Fatalf("got %+v, want %+v", continuations, tt.want)
+			}
+
+			var sum float64
+			for i, c := range continuations {
+				if c.Text != tt.want[i].text || c.Weight != tt.want[i].weight {
+					t.Errorf("continuation %d is %+v, want %+v", i, c, tt.want[i])
+				}
+				if c.Edge != (c.Text == "") {
+					t.Errorf("continuation %d is %+v, want only the start and end key to be edges", i, c)
+				}
+				sum += c.Probability
+			}
+			if len(continuations) > 0 && math.Abs(sum-1) > 1e-9 {
+				t.Errorf("probabilities add up to %v", sum)
+			}
+		})
+	}
+}
+
+func TestContinuationsUnfinished(t *testing.T) {
+	e := newTestEngine(t, StartInstructions{Order: 3})
+	for _, message := range []string{"hello there general kenobi you are", "hello there general kenobi you are", "hello there friend how are you", "well hello there sir"} {
+		e.In("c", message)
+	}
+	if err := e.TempTriggerWrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A state that stops partway through a parent is finished with the rest of it.
+	tests := []struct {
+		state string
+		want  string
+	}{
+		{"hello there", "general"},
+		{"hello", "there general"},
+		{"hello there general kenobi", "you are"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.state, func(t *testing.T) {
+			continuations, err := e.Next("c", tt.state)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if continuations[0].Text != tt.want {
+				t.Errorf("most likely is %+v, want %q", continuations[0], tt.want)
+			}
+		})
+	}
+
+	if _, err := e.Next("missing", "hello"); !errors.Is(err, ErrChainNotFound) {
+		t.Errorf("got %v, want %v", err, ErrChainNotFound)
+	}
+}
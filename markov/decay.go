@@ -0,0 +1,63 @@
+package markov
+
+import (
+	"math"
+	"time"
+)
+
+// decayScale is what decayed values are multiplied by to make whole weights, so an edge that has mostly decayed still counts for less than one that has not.
+const decayScale = 1 << 10
+
+// decays returns whether edges lose weight over time.
+func (e *Engine) decays() bool {
+	return e.instructions.HalfLife > 0
+}
+
+// unitWeight is the weight a single recent sighting of an edge counts for when a chain is read.
+func (e *Engine) unitWeight() int {
+	if !e.decays() {
+		return 1
+	}
+	return decayScale
+}
+
+// decayFactor returns how much of its value an edge last seen at lastSeen still counts for.
+// Edges without a last seen time have not started decaying yet.
+func (e *Engine) decayFactor(lastSeen int64, now time.Time) float64 {
+	if !e.decays() || lastSeen <= 0 {
+		return 1
+	}
+
+	age := now.Sub(time.Unix(lastSeen, 0))
+	if age <= 0 {
+		return 1
+	}
+
+	return math.Exp2(-float64(age) / float64(e.instructions.HalfLife))
+}
+
+// decayedWeight returns the weight an edge is read with. An edge that is still in the chain always counts for something.
+func (e *Engine) decayedWeight(value int, lastSeen int64, now time.Time) int {
+	if !e.decays() || value <= 0 {
+		return value
+	}
+
+	return max(1, int(math.Round(float64(value)*e.decayFactor(lastSeen, now)*decayScale)))
+}
+
+// decayParent returns a copy of a parent with the values of its children and grandparents decayed.
+func (e *Engine) decayParent(p Parent, now time.Time) Parent {
+	if !e.decays() {
+		return p
+	}
+
+	decayed := copyParent(p)
+	for i, c := range decayed.Children {
+		decayed.Children[i].Value = e.decayedWeight(c.Value, c.LastSeen, now)
+	}
+	for i, g := range decayed.Grandparents {
+		decayed.Grandparents[i].Value = e.decayedWeight(g.Value, g.LastSeen, now)
+	}
+
+	return decayed
+}
@@ -0,0 +1,169 @@
+package markov
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDecayFactor(t *testing.T) {
+	now := time.Unix(time.Now().Unix(), 0) // Last seen times are whole seconds.
+	hoursAgo := func(hours int) int64 {
+		return now.Add(-time.Duration(hours) * time.Hour).Unix()
+	}
+
+	tests := []struct {
+		name     string
+		halfLife time.Duration
+		lastSeen int64
+		want     float64
+	}{
+		{"nothing decays", 0, hoursAgo(48), 1},
+		{"no last seen time", 24 * time.Hour, 0, 1},
+		{"just seen", 24 * time.Hour, now.Unix(), 1},
+		{"seen in the future", 24 * time.Hour, now.Add(time.Hour).Unix(), 1},
+		{"one half life", 24 * time.Hour, hoursAgo(24), 0.5},
+		{"three half lives", 24 * time.Hour, hoursAgo(72), 0.125},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Engine{instructions: StartInstructions{HalfLife: tt.halfLife}}
+			if got := e.decayFactor(tt.lastSeen, now); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecay(t *testing.T) {
+	for _, store := range testStores() {
+		t.Run(store.name, func(t *testing.T) {
+			e := newTestEngine(t, StartInstructions{
+				Store:               store.open(t),
+				Order:               1,
+				HalfLife:            24 * time.Hour,
+				DefluffTriggerValue: 2,
+			})
+
+			// old was seen 10 times three half lives ago, legacy once before last seen times existed.
+			old := time.Now().Add(-72 * time.Hour).Unix()
+			err := e.store.Merge("c", e.newChainInfo(), []Parent{
+				{Word: e.instructions.StartKey, Children: []Child{{Word: "old", Value: 10, LastSeen: old}, {Word: "legacy", Value: 1}}},
+				{Word: "old", Grandparents: []Grandparent{{Word: e.instructions.StartKey, Value: 10, LastSeen: old}}},
+				{Word: "legacy", Grandparents: []Grandparent{{Word: e.instructions.StartKey, Value: 1}}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 3; i++ {
+				e.In("c", "new")
+			}
+			if err := e.TempTriggerWrite(); err != nil {
+				t.Fatal(err)
+			}
+
+			p, _, err := e.getParent("c", e.instructions.StartKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			weights := make(map[string]int)
+			for _, c := range p.Children {
+				weights[c.Word] = c.Value
+			}
+			want := map[string]int{"new": 3 * decayScale, "old": 10 * decayScale / 8, "legacy": decayScale}
+			for word, weight := range want {
+				if weights[word] != weight {
+					t.Errorf("%s is read with weight %d, want %d", word, weights[word], weight)
+				}
+			}
+
+			// Defluffing goes by decayed values: old is down to 1.25 and legacy is at 1, both below 2.
+			if _, err := e.Defluff(); err != nil {
+				t.Fatal(err)
+			}
+			raw, _, err := e.store.Parent("c", e.instructions.StartKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(raw.Children) != 1 || raw.Children[0].Word != "new" || raw.Children[0].LastSeen == 0 {
+				t.Errorf("children after defluffing are %+v, want only new with a last seen time", raw.Children)
+			}
+			for _, word := range []string{"old", "legacy"} {
+				if _, exists, _ := e.store.Parent("c", word); exists {
+					t.Errorf("parent %s was kept", word)
+				}
+			}
+		})
+	}
+}
+
+func TestDecayLastSeen(t *testing.T) {
+	arrived := time.Now().Add(-72 * time.Hour).Unix()
+
+	tests := []struct {
+		name     string
+		halfLife time.Duration
+		log      string
+		want     int64
+	}{
+		{"nothing decays", 0, `{"Content":"hello there","Arrived":1}`, 0},
+		{"seen when it arrived", 24 * time.Hour, fmt.Sprintf(`{"Content":"hello there","Arrived":%d}`, arrived), arrived},
+		{"logged before records existed", 24 * time.Hour, `"hello there"`, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.MkdirAll(filepath.Join(dir, "logs"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, "logs", "c.log"), []byte(tt.log+"\n"), 0666); err != nil {
+				t.Fatal(err)
+			}
+
+			e := newTestEngine(t, StartInstructions{Directory: dir, Order: 1, HalfLife: tt.halfLife})
+			if err := e.TempTriggerWrite(); err != nil {
+				t.Fatal(err)
+			}
+
+			p, exists, err := e.store.Parent("c", "hello")
+			if err != nil || !exists {
+				t.Fatalf("parent hello is %+v, %v, %v", p, exists, err)
+			}
+
+			// Content on its own is seen when it is replayed.
+			got := p.Children[0].LastSeen
+			if tt.want == -1 && got < time.Now().Add(-time.Minute).Unix() {
+				t.Errorf("last seen is %d, want the time it was replayed", got)
+			}
+			if tt.want != -1 && got != tt.want {
+				t.Errorf("last seen is %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecayChainStats(t *testing.T) {
+	e := newTestEngine(t, StartInstructions{Order: 1, HalfLife: 24 * time.Hour})
+	for i := 0; i < 3; i++ {
+		e.In("c", "hello there")
+	}
+	if err := e.TempTriggerWrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Stats count times recorded, not decayed weights.
+	stats, err := e.ChainStats("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Frequency{{Text: "hello", Count: 3}, {Text: "there", Count: 3}}
+	if !reflect.DeepEqual(stats.TopPhrases, want) {
+		t.Errorf("top phrases are %+v, want %+v", stats.TopPhrases, want)
+	}
+}
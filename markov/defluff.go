@@ -0,0 +1,112 @@
+package markov
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefluffReport details how much was removed by a defluff.
+type DefluffReport struct {
+	Chains       int
+	Children     int
+	Grandparents int
+	Parents      int
+}
+
+// Defluff will go through every chain and remove any children and grandparents with a value lower than DefluffTriggerValue,
+// as well as any parents that are left without children or grandparents.
+// If edges decay, their decayed values are compared instead, and edges without a last seen time are given one so they start decaying.
+// A chain that fails to be defluffed is skipped and its error is returned together with the others.
+func (e *Engine) Defluff() (report DefluffReport, err error) {
+	if e.instructions.DefluffTriggerValue <= 0 && !e.decays() {
+		return report, nil
+	}
+
+	e.busy.Lock()
+	defer e.busy.Unlock()
+	defer e.duration(track("defluff duration"))
+
+	var errs []error
+	for _, chain := range e.Chains() {
+		exists, w := e.doesWorkerExist(chain)
+		if exists {
+			w.ChainMx.Lock()
+		}
+
+		r, err := e.defluffBody(chain)
+
+		if exists {
+			w.ChainMx.Unlock()
+		}
+
+		if err != nil {
+			errs = append(errs, e.handleChainError(chain, fmt.Errorf("defluffing chain %s: %w", chain, err)))
+			continue
+		}
+
+		report.Children += r.Children
+		report.Grandparents += r.Grandparents
+		report.Parents += r.Parents
+		report.Chains++
+	}
+
+	if e.instructions.ShouldDefluff {
+		e.statsMx.Lock()
+		e.stats.NextDefluffTime = time.Now().Add(defluffInterval)
+		e.statsMx.Unlock()
+	}
+
+	e.debugLog("Total defluffed:", report)
+	return report, errors.Join(errs...)
+}
+
+func (e *Engine) defluffBody(chain string) (report DefluffReport, err error) {
+	now := time.Now()
+	err = e.rewriteChain(chain, func(existingParent Parent) (updatedParent Parent, keep bool) {
+		updatedParent.Word = existingParent.Word
+
+		for _, eChild := range existingParent.Children {
+			if e.isFluff(eChild.Value, eChild.LastSeen, now) {
+				report.Children++
+				continue
+			}
+
+			eChild.LastSeen = e.lastSeenOrNow(eChild.LastSeen, now)
+			updatedParent.Children = append(updatedParent.Children, eChild)
+		}
+
+		for _, eGrandparent := range existingParent.Grandparents {
+			if e.isFluff(eGrandparent.Value, eGrandparent.LastSeen, now) {
+				report.Grandparents++
+				continue
+			}
+
+			eGrandparent.LastSeen = e.lastSeenOrNow(eGrandparent.LastSeen, now)
+			updatedParent.Grandparents = append(updatedParent.Grandparents, eGrandparent)
+		}
+
+		// Drop parents that no longer lead anywhere
+		if len(updatedParent.Children) == 0 && len(updatedParent.Grandparents) == 0 {
+			report.Parents++
+			return updatedParent, false
+		}
+
+		return updatedParent, true
+	})
+
+	return report, err
+}
+
+// isFluff returns whether an edge is worth too little to keep, after decaying.
+func (e *Engine) isFluff(value int, lastSeen int64, now time.Time) bool {
+	return float64(value)*e.decayFactor(lastSeen, now) < float64(e.instructions.DefluffTriggerValue)
+}
+
+// lastSeenOrNow returns now for edges without a last seen time if edges decay, so they start decaying from now on.
+func (e *Engine) lastSeenOrNow(lastSeen int64, now time.Time) int64 {
+	if lastSeen > 0 || !e.decays() {
+		return lastSeen
+	}
+	return now.Unix()
+}
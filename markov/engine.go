@@ -0,0 +1,262 @@
+package markov
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Engine is a set of chains kept in its own directory, with its own workers, write schedule and statistics.
+// Several engines can run in one process as long as they use different directories.
+type Engine struct {
+	instructions  StartInstructions
+	directory     string
+	store         ChainStore
+	writeInterval time.Duration
+
+	busy         sync.Mutex
+	errorChannel chan error
+
+	stats   Statistics
+	statsMx sync.Mutex
+
+	workerMap   map[string]*worker
+	workerMapMx sync.Mutex
+
+	indexes   map[string]*chainIndex
+	indexesMx sync.Mutex
+
+	chainStats   map[string]*chainStatsBuilder
+	chainStatsMx sync.Mutex
+
+	aliases   map[string]string
+	aliasesMx sync.Mutex
+
+	blends    map[string][]BlendChain
+	blendUses map[string]int
+	blendsMx  sync.Mutex
+
+	stopTickers     chan struct{}
+	stopTickersOnce sync.Once
+}
+
+// defaultEngine is the engine used by the package level functions.
+var defaultEngine = newEngine()
+
+func newEngine() *Engine {
+	return &Engine{
+		directory:     "./markov-chains",
+		writeInterval: 10 * time.Minute,
+		workerMap:     make(map[string]*worker),
+		indexes:       make(map[string]*chainIndex),
+		chainStats:    make(map[string]*chainStatsBuilder),
+		aliases:       make(map[string]string),
+		blends:        make(map[string][]BlendChain),
+		blendUses:     make(map[string]int),
+		stopTickers:   make(chan struct{}),
+	}
+}
+
+// New starts an engine based on instructions, loading the chains found in its directory.
+func New(sI StartInstructions) (*Engine, error) {
+	e := newEngine()
+	if err := e.start(sI); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *Engine) start(sI StartInstructions) error {
+	e.instructions = sI
+	e.errorChannel = sI.ErrorChannel
+	if sI.Directory != "" {
+		e.directory = filepath.Clean(sI.Directory)
+	}
+
+	if err := e.createFolders(); err != nil {
+		return fmt.Errorf("creating folders: %w", err)
+	}
+
+	e.store = sI.Store
+	if e.store == nil {
+		store, err := NewJSONStore(e.directory)
+		if err != nil {
+			return fmt.Errorf("opening chain files: %w", err)
+		}
+		e.store = store
+	}
+
+	e.loadStats()
+
+	if err := e.loadAliases(); err != nil {
+		return fmt.Errorf("loading aliases: %w", err)
+	}
+
+	if err := e.loadChains(); err != nil {
+		return fmt.Errorf("loading chains: %w", err)
+	}
+
+	if err := e.replayLogs(); err != nil {
+		return fmt.Errorf("replaying logs: %w", err)
+	}
+
+	go e.tickerLoops()
+
+	return nil
+}
+
+func (e *Engine) path(elem ...string) string {
+	return filepath.Join(append([]string{e.directory}, elem...)...)
+}
+
+// Start starts markov based on instructions pDuration
+func Start(sI StartInstructions) error {
+	return defaultEngine.start(sI)
+}
+
+// Shutdown calls Engine.Shutdown on the default engine.
+func Shutdown(ctx context.Context) error {
+	return defaultEngine.Shutdown(ctx)
+}
+
+func TempTriggerWrite() error {
+	return defaultEngine.TempTriggerWrite()
+}
+
+// In calls Engine.In on the default engine.
+func In(chainName string, content string) error {
+	return defaultEngine.In(chainName, content)
+}
+
+// Out calls Engine.Out on the default engine.
+func Out(oi OutputInstructions) (output string, err error) {
+	return defaultEngine.Out(oi)
+}
+
+// OutWithAttempts calls Engine.OutWithAttempts on the default engine.
+func OutWithAttempts(oi OutputInstructions) (output string, attempts int, err error) {
+	return defaultEngine.OutWithAttempts(oi)
+}
+
+// OutMany calls Engine.OutMany on the default engine.
+func OutMany(oi OutputInstructions, n int) (outputs []string, err error) {
+	return defaultEngine.OutMany(oi, n)
+}
+
+// Next calls Engine.Next on the default engine.
+func Next(chainName, state string) (continuations []Continuation, err error) {
+	return defaultEngine.Next(chainName, state)
+}
+
+// Previous calls Engine.Previous on the default engine.
+func Previous(chainName, state string) (continuations []Continuation, err error) {
+	return defaultEngine.Previous(chainName, state)
+}
+
+// Inspect calls Engine.Inspect on the default engine.
+func Inspect(chainName, word string) (parents []Parent, err error) {
+	return defaultEngine.Inspect(chainName, word)
+}
+
+// ChainStats calls Engine.ChainStats on the default engine.
+func ChainStats(name string) (stats ChainStatistics, err error) {
+	return defaultEngine.ChainStats(name)
+}
+
+// ExportGraph calls Engine.ExportGraph on the default engine.
+func ExportGraph(chainName, word string, depth int) (graph Graph, err error) {
+	return defaultEngine.ExportGraph(chainName, word, depth)
+}
+
+// Merge calls Engine.Merge on the default engine.
+func Merge(destination string, sources ...string) error {
+	return defaultEngine.Merge(destination, sources...)
+}
+
+// Alias calls Engine.Alias on the default engine.
+func Alias(name, chainName string) error {
+	return defaultEngine.Alias(name, chainName)
+}
+
+// RemoveAlias calls Engine.RemoveAlias on the default engine.
+func RemoveAlias(name string) error {
+	return defaultEngine.RemoveAlias(name)
+}
+
+// Aliases calls Engine.Aliases on the default engine.
+func Aliases() map[string]string {
+	return defaultEngine.Aliases()
+}
+
+// Score calls Engine.Score on the default engine.
+func Score(chainName, text string) (score ChainScore, err error) {
+	return defaultEngine.Score(chainName, text)
+}
+
+// Classify calls Engine.Classify on the default engine.
+func Classify(text string) (scores []ChainScore, err error) {
+	return defaultEngine.Classify(text)
+}
+
+// Cleanse calls Engine.Cleanse on the default engine.
+func Cleanse(entry, matching string) (totalCleansed int, err error) {
+	return defaultEngine.Cleanse(entry, matching)
+}
+
+// Defluff calls Engine.Defluff on the default engine.
+func Defluff() (report DefluffReport, err error) {
+	return defaultEngine.Defluff()
+}
+
+// Chains calls Engine.Chains on the default engine.
+func Chains() (chains []string) {
+	return defaultEngine.Chains()
+}
+
+func DoesChainFileExist(name string) (exists bool) {
+	return defaultEngine.DoesChainFileExist(name)
+}
+
+// CurrentWorkers calls Engine.CurrentWorkers on the default engine.
+func CurrentWorkers() []string {
+	return defaultEngine.CurrentWorkers()
+}
+
+// WorkersStats calls Engine.WorkersStats on the default engine.
+func WorkersStats() (slice []WorkerStats) {
+	return defaultEngine.WorkersStats()
+}
+
+// NextWriteTime calls Engine.NextWriteTime on the default engine.
+func NextWriteTime() time.Time {
+	return defaultEngine.NextWriteTime()
+}
+
+// PeakIntake calls Engine.PeakIntake on the default engine.
+func PeakIntake() PeakIntakeStruct {
+	return defaultEngine.PeakIntake()
+}
+
+// IsMarkovBusy calls Engine.IsBusy on the default engine.
+func IsMarkovBusy() bool {
+	return defaultEngine.IsBusy()
+}
+
+func ChainIntake(chain string) int {
+	return defaultEngine.ChainIntake(chain)
+}
+
+func IsChainBusy(chain string) bool {
+	return defaultEngine.IsChainBusy(chain)
+}
+
+// Stats calls Engine.Stats on the default engine.
+func Stats() (statistics Statistics) {
+	return defaultEngine.Stats()
+}
+
+func ReportDurations() []report {
+	return defaultEngine.ReportDurations()
+}
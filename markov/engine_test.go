@@ -0,0 +1,62 @@
+package markov
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStartRecovers(t *testing.T) {
+	long := strings.Repeat("word ", 500000)
+
+	tests := []struct {
+		name        string
+		file        string
+		content     string
+		quarantined bool
+		intake      int
+	}{
+		{"aliases that cannot be read", "stats/aliases.json", `{"new": "old"`, true, 0},
+		{"input longer than a line used to be", "logs/c.log", `"` + long + `"` + "\n" + `"hello there"` + "\n", false, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, tt.file)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(tt.content), 0666); err != nil {
+				t.Fatal(err)
+			}
+
+			errs := make(chan error, 10)
+			e := newTestEngine(t, StartInstructions{Directory: dir, Order: 1, ErrorChannel: errs})
+
+			quarantined, _ := os.ReadDir(filepath.Join(dir, "quarantine"))
+			if (len(quarantined) == 1) != tt.quarantined {
+				t.Errorf("quarantine has %d files, want the file quarantined %v", len(quarantined), tt.quarantined)
+			}
+			if tt.quarantined {
+				select {
+				case err := <-errs:
+					if !strings.Contains(err.Error(), "quarantined") {
+						t.Errorf("reported %v, want the quarantine reported", err)
+					}
+				case <-time.After(time.Second):
+					t.Error("quarantine was not reported")
+				}
+			}
+
+			if exists, w := e.doesWorkerExist("c"); tt.intake > 0 && (!exists || w.Intake != tt.intake) {
+				t.Errorf("worker exists %v with intake %d after replaying, want %d", exists, w.Intake, tt.intake)
+			}
+			if len(e.Aliases()) != 0 {
+				t.Errorf("aliases are %v, want none", e.Aliases())
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package markov
+
+import "errors"
+
+// Errors returned by the engine, wrapped with details about the chain and words involved. Use errors.Is to check for them.
+var (
+	// ErrChainNotFound means the chain is not in the store.
+	ErrChainNotFound = errors.New("chain is not found")
+	// ErrChainBusy means the chain is being written, cleansed or defluffed and cannot be used right now.
+	ErrChainBusy = errors.New("chain is busy")
+	// ErrInvalidMethod means the method in the output instructions does not exist.
+	ErrInvalidMethod = errors.New("no correct method provided")
+	// ErrEmptyTarget means a targeted method was given no target.
+	ErrEmptyTarget = errors.New("target is empty")
+	// ErrInvalidTarget means the target cannot be used by the method, such as a bridge target that is too long.
+	ErrInvalidTarget = errors.New("target is invalid")
+	// ErrInvalidSampling means the sampling in the output instructions is out of range.
+	ErrInvalidSampling = errors.New("sampling is invalid")
+	// ErrInvalidConstraints means the constraints in the output instructions can never be met, such as MinWords being more than MaxWords.
+	ErrInvalidConstraints = errors.New("constraints are invalid")
+	// ErrRejected means every attempt made an output that did not meet the constraints in the output instructions.
+	ErrRejected = errors.New("output rejected")
+	// ErrInvalidBlend means the blend in the output instructions cannot be used, such as a chain with a negative weight.
+	ErrInvalidBlend = errors.New("blend is invalid")
+	// ErrIncompatibleChains means chains that have to be walked or merged together were built differently, such as with different orders.
+	ErrIncompatibleChains = errors.New("chains are built differently")
+	// ErrInvalidAlias means the alias cannot be made or removed, such as an alias that is already the name of a chain.
+	ErrInvalidAlias = errors.New("alias is invalid")
+	// ErrInvalidMatching means the matching in the output instructions does not exist.
+	ErrInvalidMatching = errors.New("no correct matching provided")
+	// ErrEmptyText means there is no text to score.
+	ErrEmptyText = errors.New("text is empty")
+	// ErrNoMatchingTarget means nothing in the chain matches the target.
+	ErrNoMatchingTarget = errors.New("no parents match the target")
+	// ErrUnknownState means the chain recorded nothing next to the state, or to any of the words at the end (or start) of it.
+	ErrUnknownState = errors.New("state is unknown")
+	// ErrDeadEnd means the walk reached a word that the chain has nothing recorded after (or before).
+	ErrDeadEnd = errors.New("dead end")
+	// ErrNoEnd means the walk went on for too long without reaching the start or end key, such as a greedy walk going in circles.
+	ErrNoEnd = errors.New("no end reached")
+	// ErrEmptyChain means the chain has no beginnings, endings or parents to start from.
+	ErrEmptyChain = errors.New("chain is empty")
+	// ErrCorruptChain means the chain file could not be read. The chain is quarantined when this happens.
+	ErrCorruptChain = errors.New("chain file is corrupt")
+)
@@ -0,0 +1,377 @@
+package markov
+
+import (
+	"encoding/gob"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// minOriginalityWindow and maxOriginalityWindow are the shortest and longest runs of words in a message that are fingerprinted.
+	minOriginalityWindow = 4
+	maxOriginalityWindow = 8
+
+	// filterCapacity is how many fingerprints a Bloom filter holds, and maxFilters how many filters a chain keeps.
+	// Once the last filter is full a new one is started, and once there are maxFilters the oldest is dropped,
+	// so only the most recent fingerprints are known and a chain's fingerprints never take up more than a few megabytes.
+	filterCapacity = 1 << 18
+	maxFilters     = 4
+
+	// outputErrorRate is how often an output that copies nothing is rejected, for outputs of up to outputProbes words.
+	// Every run of words in an output is looked up in every filter, so the filters are sized for that many lookups rather than one.
+	outputErrorRate = 0.01
+	outputProbes    = 50
+	filterErrorRate = outputErrorRate / outputProbes / maxFilters
+)
+
+// fingerprints is a rotating window of Bloom filters of the messages a chain was given and the runs of words in them,
+// so that outputs can be checked for copying a message without keeping the messages.
+type fingerprints struct {
+	Filters []bloomFilter
+
+	// next is the number of the next filter that is started. Filters are written to files named after their number,
+	// and dropped is whether a filter was dropped since they were last written, so its file has to be removed.
+	next    int
+	dropped bool
+}
+
+// bloomFilter is saved to its own file, so only the filters that changed are written.
+type bloomFilter struct {
+	Number   int
+	Bits     []uint64
+	Hashes   int
+	Count    int
+	Capacity int
+
+	dirty bool
+}
+
+func newBloomFilter(number, capacity int, errorRate float64) bloomFilter {
+	hashes := int(math.Ceil(math.Log2(1 / errorRate)))
+	bits := int(math.Ceil(float64(capacity) * float64(hashes) / math.Ln2))
+
+	return bloomFilter{
+		Number:   number,
+		Bits:     make([]uint64, (bits+63)/64),
+		Hashes:   hashes,
+		Capacity: capacity,
+		dirty:    true,
+	}
+}
+
+// The bits of a fingerprint are found with double hashing, the i-th bit being at (h1 + i*h2) % size.
+func (b *bloomFilter) add(h uint64) {
+	size := uint64(len(b.Bits) * 64)
+	h1, h2 := h, h>>32|1
+
+	for i := 0; i < b.Hashes; i++ {
+		p := (h1 + uint64(i)*h2) % size
+		b.Bits[p/64] |= 1 << (p % 64)
+	}
+	b.Count++
+	b.dirty = true
+}
+
+func (b *bloomFilter) has(h uint64) bool {
+	size := uint64(len(b.Bits) * 64)
+	h1, h2 := h, h>>32|1
+
+	for i := 0; i < b.Hashes; i++ {
+		p := (h1 + uint64(i)*h2) % size
+		if b.Bits[p/64]&(1<<(p%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *fingerprints) add(h uint64) {
+	if f.has(h) {
+		return
+	}
+
+	if len(f.Filters) == 0 || f.Filters[len(f.Filters)-1].Count >= f.Filters[len(f.Filters)-1].Capacity {
+		f.Filters = append(f.Filters, newBloomFilter(f.next, filterCapacity, filterErrorRate))
+		f.next++
+		f.trim()
+	}
+
+	f.Filters[len(f.Filters)-1].add(h)
+}
+
+func (f *fingerprints) has(h uint64) bool {
+	for i := range f.Filters {
+		if f.Filters[i].has(h) {
+			return true
+		}
+	}
+	return false
+}
+
+// trim drops the oldest filters until there are at most maxFilters.
+func (f *fingerprints) trim() {
+	if len(f.Filters) > maxFilters {
+		f.Filters = append([]bloomFilter(nil), f.Filters[len(f.Filters)-maxFilters:]...)
+		f.dropped = true
+	}
+}
+
+// merge adds every fingerprint of other. The newest filters of both are combined, newest with newest,
+// so the merged fingerprints take up no more space than the bigger of the two.
+// A combined filter can hold more than its capacity, which only makes outputs that copy nothing a little more likely to be rejected.
+func (f *fingerprints) merge(other *fingerprints) {
+	var older []bloomFilter
+	for i := 1; i <= len(other.Filters); i++ {
+		source := other.Filters[len(other.Filters)-i]
+
+		// Filters made with a different size are kept as they are, before every filter of f.
+		if i > len(f.Filters) || len(f.Filters[len(f.Filters)-i].Bits) != len(source.Bits) || f.Filters[len(f.Filters)-i].Hashes != source.Hashes {
+			source.Bits = append([]uint64(nil), source.Bits...)
+			older = append([]bloomFilter{source}, older...)
+			continue
+		}
+
+		destination := &f.Filters[len(f.Filters)-i]
+		for j := range source.Bits {
+			destination.Bits[j] |= source.Bits[j]
+		}
+		destination.Count += source.Count
+		destination.dirty = true
+	}
+
+	// Filters older than every filter of f are numbered again, so they stay in order once written.
+	if len(older) > 0 {
+		f.Filters = append(older, f.Filters...)
+		for i := range f.Filters {
+			f.Filters[i].Number = f.next
+			f.Filters[i].dirty = true
+			f.next++
+		}
+		f.dropped = true
+	}
+
+	f.trim()
+}
+
+// fingerprint hashes the kind and the words joined by the separation key with 64-bit FNV-1a, without joining them.
+func fingerprint(kind byte, words []string, separationKey string) uint64 {
+	const (
+		offset = 14695981039346656037
+		prime  = 1099511628211
+	)
+
+	h := uint64(offset)
+	h = (h ^ uint64(kind)) * prime
+
+	for i, word := range words {
+		if i > 0 {
+			for j := 0; j < len(separationKey); j++ {
+				h = (h ^ uint64(separationKey[j])) * prime
+			}
+		}
+		for j := 0; j < len(word); j++ {
+			h = (h ^ uint64(word[j])) * prime
+		}
+	}
+
+	return h
+}
+
+// addMessage fingerprints a whole message and every run of words in it from minOriginalityWindow to maxOriginalityWindow words long.
+func (f *fingerprints) addMessage(words []string, separationKey string) {
+	f.add(fingerprint('m', words, separationKey))
+
+	for n := minOriginalityWindow; n <= maxOriginalityWindow && n <= len(words); n++ {
+		for i := 0; i+n <= len(words); i++ {
+			f.add(fingerprint('w', words[i:i+n], separationKey))
+		}
+	}
+}
+
+// copies returns whether the output is a whole message, or has a run of n words that is in a message.
+// n is kept between minOriginalityWindow and maxOriginalityWindow.
+func (f *fingerprints) copies(words []string, n int, separationKey string) bool {
+	if f.has(fingerprint('m', words, separationKey)) {
+		return true
+	}
+
+	n = max(minOriginalityWindow, min(n, maxOriginalityWindow))
+	for i := 0; i+n <= len(words); i++ {
+		if f.has(fingerprint('w', words[i:i+n], separationKey)) {
+			return true
+		}
+	}
+	return false
+}
+
+// fingerprintsPath returns the folder a chain's filters are kept in.
+func (e *Engine) fingerprintsPath(name string) string {
+	return e.path("fingerprints", name)
+}
+
+// legacyFingerprintsPath returns where a chain's filters were kept, all in one file, before they were kept apart.
+func (e *Engine) legacyFingerprintsPath(name string) string {
+	return e.path("fingerprints", name+".gob")
+}
+
+func filterFile(number int) string {
+	return strconv.Itoa(number) + ".gob"
+}
+
+// loadFingerprints reads a chain's fingerprints, or starts new ones if the chain has none yet.
+// Fingerprints kept in one file are read too, and are kept apart the next time they are written.
+func (e *Engine) loadFingerprints(name string) (*fingerprints, error) {
+	f := &fingerprints{}
+
+	files, err := os.ReadDir(e.fingerprintsPath(name))
+	if os.IsNotExist(err) {
+		return e.loadLegacyFingerprints(name)
+	}
+	if err != nil {
+		return f, err
+	}
+
+	for _, file := range files {
+		number, err := strconv.Atoi(strings.TrimSuffix(file.Name(), ".gob"))
+		if err != nil || file.Name() != filterFile(number) {
+			continue
+		}
+
+		b, err := os.Open(filepath.Join(e.fingerprintsPath(name), file.Name()))
+		if err != nil {
+			return &fingerprints{}, err
+		}
+
+		var filter bloomFilter
+		err = gob.NewDecoder(b).Decode(&filter)
+		b.Close()
+		if err != nil {
+			return &fingerprints{}, err
+		}
+
+		f.Filters = append(f.Filters, filter)
+		f.next = max(f.next, number+1)
+	}
+
+	sort.Slice(f.Filters, func(i, j int) bool {
+		return f.Filters[i].Number < f.Filters[j].Number
+	})
+	f.trim()
+
+	return f, nil
+}
+
+// loadLegacyFingerprints reads fingerprints kept in one file. Filters bigger than filters are now are dropped, as they could be of any size.
+func (e *Engine) loadLegacyFingerprints(name string) (*fingerprints, error) {
+	f := &fingerprints{}
+
+	file, err := os.Open(e.legacyFingerprintsPath(name))
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return f, err
+	}
+	defer file.Close()
+
+	var legacy struct {
+		Filters []bloomFilter
+	}
+	if err := gob.NewDecoder(file).Decode(&legacy); err != nil {
+		return f, err
+	}
+
+	for _, filter := range legacy.Filters {
+		if filter.Capacity > filterCapacity {
+			continue
+		}
+
+		filter.Number = f.next
+		filter.dirty = true
+		f.Filters = append(f.Filters, filter)
+		f.next++
+	}
+	f.trim()
+	f.dropped = true
+
+	return f, nil
+}
+
+// saveFingerprints writes the filters of a worker that changed since they were last written, and removes the ones that were dropped.
+func (w *worker) saveFingerprints() error {
+	f := w.Fingerprints
+	if f == nil {
+		return nil
+	}
+
+	folder := w.engine.fingerprintsPath(w.Name)
+	kept := make(map[string]bool)
+
+	for i := range f.Filters {
+		filter := &f.Filters[i]
+		kept[filterFile(filter.Number)] = true
+
+		if !filter.dirty {
+			continue
+		}
+		if err := os.MkdirAll(folder, 0755); err != nil {
+			return err
+		}
+		if err := saveFilter(filepath.Join(folder, filterFile(filter.Number)), filter); err != nil {
+			return err
+		}
+		filter.dirty = false
+	}
+
+	if !f.dropped {
+		return nil
+	}
+
+	files, err := os.ReadDir(folder)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, file := range files {
+		if !kept[file.Name()] {
+			os.Remove(filepath.Join(folder, file.Name()))
+		}
+	}
+
+	// Once every filter is kept apart, the file they were kept in before is not needed.
+	if err := os.Remove(w.engine.legacyFingerprintsPath(w.Name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	f.dropped = false
+	return nil
+}
+
+func saveFilter(path string, filter *bloomFilter) error {
+	newPath := path + "_new"
+
+	file, err := os.Create(newPath)
+	if err != nil {
+		return err
+	}
+
+	err = gob.NewEncoder(file).Encode(filter)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = removeAndRename(path, newPath)
+	}
+	if err != nil {
+		os.Remove(newPath)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,219 @@
+package markov
+
+import (
+	"encoding/gob"
+	"errors"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFingerprintsCopies(t *testing.T) {
+	var f fingerprints
+	f.addMessage(strings.Fields("the quick brown fox jumps over the lazy dog"), " ")
+
+	tests := []struct {
+		name   string
+		output string
+		n      int
+		want   bool
+	}{
+		{"whole message", "the quick brown fox jumps over the lazy dog", 8, true},
+		{"four words in a row", "a quick brown fox jumps", 4, true},
+		{"fewer words in a row than asked for", "a quick brown fox jumps", 6, false},
+		{"window kept to the shortest", "a brown fox jumps over", 1, true},
+		{"window kept to the longest", "quick brown fox jumps over the lazy dog too", 20, true},
+		{"nothing copied", "the lazy fox jumps over a quick dog", 4, false},
+		{"shorter than the window", "lazy dog", 4, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := f.copies(strings.Fields(tt.output), tt.n, " "); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	tests := [][]string{
+		nil,
+		{"hello"},
+		{"hello", "there"},
+		{"a", "b", "c", "d"},
+	}
+
+	// Fingerprints hash the same way they did when the words were joined, so filters saved before are still read right.
+	for _, words := range tests {
+		h := fnv.New64a()
+		h.Write([]byte{'w'})
+		h.Write([]byte(strings.Join(words, " ")))
+
+		if got := fingerprint('w', words, " "); got != h.Sum64() {
+			t.Errorf("fingerprint of %q is %x, want %x", words, got, h.Sum64())
+		}
+	}
+
+	var f fingerprints
+	f.addMessage(strings.Fields("the quick brown fox jumps over the lazy dog"), " ")
+	words := strings.Fields("the lazy fox jumps over a quick dog")
+	if allocs := testing.AllocsPerRun(100, func() { f.copies(words, 4, " ") }); allocs != 0 {
+		t.Errorf("looking up fingerprints allocates %v times", allocs)
+	}
+}
+
+func TestFingerprintsWindow(t *testing.T) {
+	var f fingerprints
+	for i := 0; i < maxFilters+2; i++ {
+		// Every fingerprint starts a filter of its own.
+		if len(f.Filters) > 0 {
+			f.Filters[len(f.Filters)-1].Count = f.Filters[len(f.Filters)-1].Capacity
+		}
+		f.add(uint64(i))
+	}
+
+	if len(f.Filters) != maxFilters {
+		t.Fatalf("there are %d filters, want %d", len(f.Filters), maxFilters)
+	}
+	for i := 0; i < maxFilters+2; i++ {
+		if want := i >= 2; f.has(uint64(i)) != want {
+			t.Errorf("has fingerprint %d is %v, want %v", i, !want, want)
+		}
+	}
+	for i, filter := range f.Filters {
+		if filter.Number != i+2 {
+			t.Errorf("filter %d is numbered %d, want %d", i, filter.Number, i+2)
+		}
+	}
+}
+
+func TestFingerprintsMerge(t *testing.T) {
+	var a, b fingerprints
+	a.add(1)
+	for i := 2; i < 5; i++ {
+		if len(b.Filters) > 0 {
+			b.Filters[len(b.Filters)-1].Count = b.Filters[len(b.Filters)-1].Capacity
+		}
+		b.add(uint64(i))
+	}
+
+	a.merge(&b)
+
+	if len(a.Filters) != 3 {
+		t.Errorf("there are %d filters after merging, want the newest of both combined", len(a.Filters))
+	}
+	for i := uint64(1); i < 5; i++ {
+		if !a.has(i) {
+			t.Errorf("fingerprint %d was lost", i)
+		}
+	}
+	for i := 1; i < len(a.Filters); i++ {
+		if a.Filters[i].Number <= a.Filters[i-1].Number {
+			t.Errorf("filters are numbered %d then %d, want them in order", a.Filters[i-1].Number, a.Filters[i].Number)
+		}
+	}
+
+	// b's filters were copied.
+	b.Filters[0].Bits[0] = 0
+	if !a.has(2) {
+		t.Error("changing the source changed the merged fingerprints")
+	}
+}
+
+func TestSaveFingerprints(t *testing.T) {
+	e := newTestEngine(t, StartInstructions{Order: 1})
+	e.In("c", "the quick brown fox jumps over the lazy dog")
+	if err := e.TempTriggerWrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(e.fingerprintsPath("c"), filterFile(0))
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A worker whose fingerprints did not change does not write them again.
+	_, w := e.doesWorkerExist("c")
+	w.ChainMx.Lock()
+	w.Chain.addContent(e.prepareContentForChainProcessing("hello", w.Info), 0)
+	w.ChainMx.Unlock()
+	if err := e.TempTriggerWrite(); err != nil {
+		t.Fatal(err)
+	}
+	if after, err := os.Stat(path); err != nil || !after.ModTime().Equal(before.ModTime()) {
+		t.Errorf("unchanged filter was written again: %v", err)
+	}
+
+	loaded, err := e.loadFingerprints("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.copies(strings.Fields("quick brown fox jumps"), 4, " ") {
+		t.Error("fingerprints were not read back")
+	}
+}
+
+func TestLoadLegacyFingerprints(t *testing.T) {
+	e := newTestEngine(t, StartInstructions{Order: 1})
+
+	var legacy fingerprints
+	legacy.Filters = append(legacy.Filters, newBloomFilter(0, 1<<16, filterErrorRate), newBloomFilter(0, 2*filterCapacity, filterErrorRate))
+	legacy.Filters[0].add(1)
+	legacy.Filters[1].add(2)
+
+	file, err := os.Create(e.legacyFingerprintsPath("c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gob.NewEncoder(file).Encode(legacy); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	// Filters bigger than filters are now are dropped.
+	w := e.getOrCreateWorker("c")
+	if !w.Fingerprints.has(1) || w.Fingerprints.has(2) || len(w.Fingerprints.Filters) != 1 {
+		t.Fatalf("legacy fingerprints were read as %d filters", len(w.Fingerprints.Filters))
+	}
+
+	if err := w.saveFingerprints(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(e.legacyFingerprintsPath("c")); !os.IsNotExist(err) {
+		t.Errorf("legacy fingerprints were kept after writing them apart: %v", err)
+	}
+	if loaded, err := e.loadFingerprints("c"); err != nil || !loaded.has(1) {
+		t.Errorf("fingerprints were not kept apart: %v", err)
+	}
+}
+
+func TestOriginality(t *testing.T) {
+	e := newTestEngine(t, StartInstructions{Order: 1})
+	messages := []string{"the cat sat on the mat today", "the dog sat on the rug today", "a bird sat on the mat"}
+	for _, message := range messages {
+		e.In("c", message)
+	}
+	if err := e.TempTriggerWrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 50; i++ {
+		output, _, err := e.OutWithAttempts(OutputInstructions{Chain: "c", Method: "LikelyBeginning", Originality: 4, MaxAttempts: 50})
+		if errors.Is(err, ErrRejected) {
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, message := range messages {
+			if output == message {
+				t.Fatalf("output %q copies a message", output)
+			}
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package markov
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxGraphDepth is how many hops away from the word a graph can go.
+	maxGraphDepth = 4
+	// maxGraphNeighbours is how many of the most recorded children and grandparents of every parent are followed.
+	maxGraphNeighbours = 8
+	// maxGraphNodes is how many parents a graph can have before it stops growing.
+	maxGraphNodes = 200
+)
+
+// ExportGraph returns the parents around every parent that has the word in it, going depth hops along children and grandparents.
+// Only the most recorded children and grandparents of every parent are followed, and the graph stops growing once it is too big to draw.
+// The word is matched literally, the same as a target. A depth below 1 is 1.
+func (e *Engine) ExportGraph(chainName, word string, depth int) (graph Graph, err error) {
+	if word == "" {
+		return graph, ErrEmptyTarget
+	}
+
+	p, err := e.compilePhrase(word, "")
+	if err != nil {
+		return graph, err
+	}
+
+	depth = max(1, min(depth, maxGraphDepth))
+
+	chainName = e.resolve(chainName)
+	workers, err := e.lockChains(chainName)
+	if err != nil {
+		return graph, err
+	}
+	defer unlockWorkers(workers)
+
+	var matches []string
+	err = e.store.Iterate(chainName, func(parent Parent) error {
+		if p.in(e.words(parent.Word)) {
+			matches = append(matches, parent.Word)
+		}
+		return nil
+	})
+	if err != nil {
+		return graph, e.handleChainError(chainName, fmt.Errorf("exporting graph of chain %s: %w", chainName, err))
+	}
+	if len(matches) == 0 {
+		return graph, fmt.Errorf("%w: [%s] in chain %s", ErrNoMatchingTarget, word, chainName)
+	}
+
+	graph.Chain = chainName
+	graph.Word = word
+
+	nodes := make(map[string]int)
+	edges := make(map[[2]string]int)
+	addNode := func(word string, hops int) bool {
+		if _, exists := nodes[word]; exists {
+			return false
+		}
+		if len(graph.Nodes) == maxGraphNodes {
+			return false
+		}
+
+		node := GraphNode{
+			ID:   "n" + strconv.Itoa(len(graph.Nodes)),
+			Word: word,
+			Hops: hops,
+		}
+		switch word {
+		case e.instructions.StartKey:
+			node.Word, node.Start = "", true
+		case e.instructions.EndKey:
+			node.Word, node.End = "", true
+		}
+
+		nodes[word] = len(graph.Nodes)
+		graph.Nodes = append(graph.Nodes, node)
+		return true
+	}
+	addEdge := func(from, to string, value int) {
+		if _, exists := nodes[from]; !exists {
+			return
+		}
+		if _, exists := nodes[to]; !exists {
+			return
+		}
+
+		// The same edge is recorded as a child of one parent and a grandparent of the other.
+		key := [2]string{from, to}
+		if i, exists := edges[key]; exists {
+			graph.Edges[i].Value = max(graph.Edges[i].Value, value)
+			return
+		}
+
+		edges[key] = len(graph.Edges)
+		graph.Edges = append(graph.Edges, GraphEdge{
+			From:  graph.Nodes[nodes[from]].ID,
+			To:    graph.Nodes[nodes[to]].ID,
+			Value: value,
+		})
+	}
+
+	frontier := matches
+	for _, word := range matches {
+		addNode(word, 0)
+	}
+
+	for hops := 1; hops <= depth && len(frontier) > 0; hops++ {
+		var next []string
+		for _, parentWord := range frontier {
+			if parentWord == e.instructions.StartKey || parentWord == e.instructions.EndKey {
+				continue
+			}
+
+			parent, exists, err := e.getParent(chainName, parentWord)
+			if err != nil {
+				return graph, e.handleChainError(chainName, err)
+			}
+			if !exists {
+				continue
+			}
+
+			for _, c := range topChildren(parent.Children, maxGraphNeighbours) {
+				if addNode(c.Word, hops) {
+					next = append(next, c.Word)
+				}
+				addEdge(parentWord, c.Word, c.Value)
+			}
+
+			for _, g := range topGrandparents(parent.Grandparents, maxGraphNeighbours) {
+				if addNode(g.Word, hops) {
+					next = append(next, g.Word)
+				}
+				addEdge(g.Word, parentWord, g.Value)
+			}
+		}
+		frontier = next
+	}
+
+	return graph, nil
+}
+
+func topChildren(children []Child, n int) []Child {
+	sorted := append([]Child(nil), children...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Value > sorted[j].Value
+	})
+	return sorted[:min(n, len(sorted))]
+}
+
+func topGrandparents(grandparents []Grandparent, n int) []Grandparent {
+	sorted := append([]Grandparent(nil), grandparents...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Value > sorted[j].Value
+	})
+	return sorted[:min(n, len(sorted))]
+}
+
+// DOT returns the graph in the Graphviz DOT language. Edges are thicker the more they were recorded,
+// and the parents with the word in them are highlighted.
+func (g Graph) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph " + strconv.Quote(g.Chain) + " {\n")
+	b.WriteString("\trankdir=LR;\n")
+	b.WriteString("\tnode [shape=box];\n")
+
+	maxValue := 1
+	for _, edge := range g.Edges {
+		maxValue = max(maxValue, edge.Value)
+	}
+
+	for _, node := range g.Nodes {
+		var attributes []string
+		switch {
+		case node.Start:
+			attributes = append(attributes, "label=\"START\"", "shape=circle")
+		case node.End:
+			attributes = append(attributes, "label=\"END\"", "shape=circle")
+		default:
+			attributes = append(attributes, "label="+strconv.Quote(node.Word))
+		}
+		if node.Hops == 0 {
+			attributes = append(attributes, "style=filled", "fillcolor=gold")
+		}
+
+		b.WriteString("\t" + node.ID + " [" + strings.Join(attributes, ", ") + "];\n")
+	}
+
+	for _, edge := range g.Edges {
+		width := 1 + 4*float64(edge.Value)/float64(maxValue)
+		b.WriteString(fmt.Sprintf("\t%s -> %s [label=\"%d\", penwidth=%.1f];\n", edge.From, edge.To, edge.Value, width))
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
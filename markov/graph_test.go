@@ -0,0 +1,127 @@
+package markov
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestExportGraph(t *testing.T) {
+	e := newTestEngine(t, StartInstructions{Order: 1})
+	e.In("c", "the cat sat")
+	if err := e.TempTriggerWrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	oneHop := Graph{
+		Chain: "c",
+		Word:  "cat",
+		Nodes: []GraphNode{{ID: "n0", Word: "cat"}, {ID: "n1", Word: "sat", Hops: 1}, {ID: "n2", Word: "the", Hops: 1}},
+		Edges: []GraphEdge{{From: "n0", To: "n1", Value: 1}, {From: "n2", To: "n0", Value: 1}},
+	}
+	twoHops := oneHop
+	twoHops.Nodes = append(append([]GraphNode(nil), oneHop.Nodes...), GraphNode{ID: "n3", Hops: 2, End: true}, GraphNode{ID: "n4", Hops: 2, Start: true})
+	twoHops.Edges = append(append([]GraphEdge(nil), oneHop.Edges...), GraphEdge{From: "n1", To: "n3", Value: 1}, GraphEdge{From: "n4", To: "n2", Value: 1})
+
+	tests := []struct {
+		name    string
+		chain   string
+		word    string
+		depth   int
+		want    Graph
+		wantErr error
+	}{
+		{name: "one hop", chain: "c", word: "cat", depth: 1, want: oneHop},
+		{name: "depth below 1", chain: "c", word: "cat", depth: 0, want: oneHop},
+		{name: "two hops", chain: "c", word: "cat", depth: 2, want: twoHops},
+		{name: "depth above the most", chain: "c", word: "cat", depth: 100, want: twoHops},
+		{name: "no word", chain: "c", depth: 1, wantErr: ErrEmptyTarget},
+		{name: "word not in the chain", chain: "c", word: "dog", depth: 1, wantErr: ErrNoMatchingTarget},
+		{name: "chain does not exist", chain: "missing", word: "cat", depth: 1, wantErr: ErrChainNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			graph, err := e.ExportGraph(tt.chain, tt.word, tt.depth)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("got %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(graph, tt.want) {
+				t.Errorf("got %+v, want %+v", graph, tt.want)
+			}
+		})
+	}
+}
+
+func TestGraphFormats(t *testing.T) {
+	tests := []struct {
+		name     string
+		graph    Graph
+		wantDOT  string
+		wantJSON string
+	}{
+		{
+			name: "edges",
+			graph: Graph{
+				Chain: "c",
+				Word:  "cat",
+				Nodes: []GraphNode{{ID: "n0", Word: "cat"}, {ID: "n1", Word: "sat", Hops: 1}, {ID: "n2", Word: "the", Hops: 1}},
+				Edges: []GraphEdge{{From: "n0", To: "n1", Value: 4}, {From: "n2", To: "n0", Value: 1}},
+			},
+			wantDOT: "digraph \"c\" {\n" +
+				"\trankdir=LR;\n" +
+				"\tnode [shape=box];\n" +
+				"\tn0 [label=\"cat\", style=filled, fillcolor=gold];\n" +
+				"\tn1 [label=\"sat\"];\n" +
+				"\tn2 [label=\"the\"];\n" +
+				"\tn0 -> n1 [label=\"4\", penwidth=5.0];\n" +
+				"\tn2 -> n0 [label=\"1\", penwidth=2.0];\n" +
+				"}\n",
+			wantJSON: `{"chain":"c","word":"cat","nodes":[{"id":"n0","word":"cat","hops":0},{"id":"n1","word":"sat","hops":1},{"id":"n2","word":"the","hops":1}],` +
+				`"edges":[{"from":"n0","to":"n1","value":4},{"from":"n2","to":"n0","value":1}]}`,
+		},
+		{
+			name: "start, end and quotes",
+			graph: Graph{
+				Chain: "a \"chain\"",
+				Word:  "\"hi\"",
+				Nodes: []GraphNode{{ID: "n0", Word: "\"hi\""}, {ID: "n1", Hops: 1, Start: true}, {ID: "n2", Hops: 1, End: true}},
+				Edges: []GraphEdge{{From: "n1", To: "n0", Value: 2}, {From: "n0", To: "n2", Value: 2}},
+			},
+			wantDOT: "digraph \"a \\\"chain\\\"\" {\n" +
+				"\trankdir=LR;\n" +
+				"\tnode [shape=box];\n" +
+				"\tn0 [label=\"\\\"hi\\\"\", style=filled, fillcolor=gold];\n" +
+				"\tn1 [label=\"START\", shape=circle];\n" +
+				"\tn2 [label=\"END\", shape=circle];\n" +
+				"\tn1 -> n0 [label=\"2\", penwidth=5.0];\n" +
+				"\tn0 -> n2 [label=\"2\", penwidth=5.0];\n" +
+				"}\n",
+			wantJSON: `{"chain":"a \"chain\"","word":"\"hi\"","nodes":[{"id":"n0","word":"\"hi\"","hops":0},{"id":"n1","word":"","hops":1,"start":true},{"id":"n2","word":"","hops":1,"end":true}],` +
+				`"edges":[{"from":"n1","to":"n0","value":2},{"from":"n0","to":"n2","value":2}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.graph.DOT(); got != tt.wantDOT {
+				t.Errorf("DOT is\n%s\nwant\n%s", got, tt.wantDOT)
+			}
+
+			b, err := json.Marshal(tt.graph)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.wantJSON {
+				t.Errorf("JSON is\n%s\nwant\n%s", b, tt.wantJSON)
+			}
+		})
+	}
+}
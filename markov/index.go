@@ -0,0 +1,318 @@
+package markov
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+)
+
+// chainIndex maps every parent word of a chain to its weights and, for chain files, the location of its entry on disk,
+// so that looking up a parent is a single read instead of decoding the whole file.
+type chainIndex struct {
+	Entries map[string]indexEntry
+	Order   []string
+	Sum     int64
+	Info    ChainInfo
+
+	// Tails and Heads map the last and first words of every parent, from one word up to all of them,
+	// to the parents that end or start with those words. They are only kept for the engine's index, for backing off.
+	Tails map[string][]string
+	Heads map[string][]string
+
+	Size    int64
+	ModTime time.Time
+}
+
+type indexEntry struct {
+	Offset            int64
+	Length            int64
+	ChildWeight       int64
+	GrandparentWeight int64
+}
+
+func newChainIndex() *chainIndex {
+	return &chainIndex{
+		Entries: make(map[string]indexEntry),
+	}
+}
+
+func (ci *chainIndex) add(p Parent, offset, length int64) {
+	e := indexEntry{
+		Offset: offset,
+		Length: length,
+	}
+	for _, c := range p.Children {
+		e.ChildWeight += int64(c.Value)
+	}
+	for _, g := range p.Grandparents {
+		e.GrandparentWeight += int64(g.Value)
+	}
+
+	if _, exists := ci.Entries[p.Word]; !exists {
+		ci.Order = append(ci.Order, p.Word)
+	}
+	ci.Entries[p.Word] = e
+	ci.Sum += e.ChildWeight
+}
+
+// update replaces the weights of a parent with those of the parent as it is now.
+// It returns false if the parent is not in the chain anymore, as parents are not taken out of the index; it has to be built again instead.
+func (ci *chainIndex) update(e *Engine, p Parent, now time.Time) bool {
+	if len(p.Children) == 0 && len(p.Grandparents) == 0 {
+		return false
+	}
+
+	old, exists := ci.Entries[p.Word]
+	ci.Sum -= old.ChildWeight
+	ci.add(e.decayParent(p, now), 0, 0)
+	if !exists {
+		e.addBackOffKeys(ci, p.Word)
+	}
+
+	return true
+}
+
+// getIndex returns the weights of every parent in a chain, building them from the store the first time.
+// Writes keep the index up to date from then on, see mergeIntoStore.
+func (e *Engine) getIndex(name string) (*chainIndex, error) {
+	e.indexesMx.Lock()
+	ci, exists := e.indexes[name]
+	e.indexesMx.Unlock()
+
+	// A chain whose stats were dropped has them built again with its index.
+	if _, hasStats := e.chainStatsOf(name); exists && hasStats {
+		return ci, nil
+	}
+	if _, isBlend := e.blendOf(name); exists && isBlend {
+		return ci, nil
+	}
+
+	if blend, isBlend := e.blendOf(name); isBlend {
+		ci, err := e.blendIndex(blend)
+		if err != nil {
+			return nil, err
+		}
+
+		e.indexesMx.Lock()
+		e.indexes[name] = ci
+		e.indexesMx.Unlock()
+
+		return ci, nil
+	}
+
+	ci = newChainIndex()
+	ci.Tails = make(map[string][]string)
+	ci.Heads = make(map[string][]string)
+	// Stats are only built the first time, as writes keep them up to date after that.
+	_, hasStats := e.chainStatsOf(name)
+	stats := newChainStatsBuilder()
+	now := time.Now()
+	err := e.store.Iterate(name, func(p Parent) error {
+		ci.add(e.decayParent(p, now), 0, 0)
+		e.addBackOffKeys(ci, p.Word)
+		if !hasStats {
+			stats.add(e, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !hasStats {
+		e.chainStatsMx.Lock()
+		e.chainStats[name] = stats
+		e.chainStatsMx.Unlock()
+	}
+
+	e.indexesMx.Lock()
+	e.indexes[name] = ci
+	e.indexesMx.Unlock()
+
+	return ci, nil
+}
+
+// addBackOffKeys adds a parent to the index's tails and heads.
+func (e *Engine) addBackOffKeys(ci *chainIndex, parentWord string) {
+	if parentWord == e.instructions.StartKey || parentWord == e.instructions.EndKey {
+		return
+	}
+
+	words := strings.Split(parentWord, e.instructions.SeparationKey)
+	for k := 1; k <= len(words); k++ {
+		tail := strings.Join(words[len(words)-k:], e.instructions.SeparationKey)
+		ci.Tails[tail] = append(ci.Tails[tail], parentWord)
+
+		head := strings.Join(words[:k], e.instructions.SeparationKey)
+		ci.Heads[head] = append(ci.Heads[head], parentWord)
+	}
+}
+
+// cachedIndex returns the index kept for a chain, if there is one.
+func (e *Engine) cachedIndex(name string) (ci *chainIndex, exists bool) {
+	e.indexesMx.Lock()
+	defer e.indexesMx.Unlock()
+
+	ci, exists = e.indexes[name]
+	return ci, exists
+}
+
+// forgetIndex drops the index of a chain and of every blend of it, so they are built again the next time they are needed.
+func (e *Engine) forgetIndex(name string) {
+	e.indexesMx.Lock()
+	delete(e.indexes, name)
+	e.indexesMx.Unlock()
+
+	e.forgetBlendIndexes(name)
+}
+
+// forgetBlendIndexes drops the index of every blend of a chain.
+func (e *Engine) forgetBlendIndexes(name string) {
+	var forget []string
+
+	// Blends are built from the indexes of their chains.
+	e.blendsMx.Lock()
+	for blendName, blend := range e.blends {
+		for _, b := range blend {
+			if b.Chain == name {
+				forget = append(forget, blendName)
+				break
+			}
+		}
+	}
+	e.blendsMx.Unlock()
+
+	e.indexesMx.Lock()
+	for _, name := range forget {
+		delete(e.indexes, name)
+	}
+	e.indexesMx.Unlock()
+}
+
+// index returns the index for a chain file, building it if it does not exist or the chain file has changed since.
+func (s *JSONStore) index(name string) (*chainIndex, error) {
+	path := s.chainPath(name)
+
+	fS, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s.indexesMx.Lock()
+	ci, exists := s.indexes[name]
+	s.indexesMx.Unlock()
+
+	if exists && ci.Size == fS.Size() && ci.ModTime.Equal(fS.ModTime()) {
+		return ci, nil
+	}
+
+	if err := s.checkChainFile(name); err != nil {
+		return nil, err
+	}
+
+	ci, err = buildIndex(path)
+	if err != nil {
+		return nil, err
+	}
+	ci.Size = fS.Size()
+	ci.ModTime = fS.ModTime()
+
+	s.indexesMx.Lock()
+	s.indexes[name] = ci
+	s.indexesMx.Unlock()
+
+	return ci, nil
+}
+
+// buildIndex decodes a chain file once and records where every parent entry is.
+func buildIndex(path string) (*chainIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	_, err = dec.Token()
+	if err != nil {
+		return nil, corruptChainError(path, err)
+	}
+
+	ci := newChainIndex()
+	for dec.More() {
+		var p Parent
+
+		start := dec.InputOffset()
+		err = dec.Decode(&p)
+		if err != nil {
+			return nil, corruptChainError(path, err)
+		}
+
+		ci.add(p, start, dec.InputOffset()-start)
+	}
+
+	if fS, err := f.Stat(); err == nil {
+		if ft, _, exists := readFooter(f, fS.Size()); exists {
+			ci.Info = ft.ChainInfo
+		}
+	}
+
+	return ci, nil
+}
+
+// storeIndex keeps an index that was built while writing a chain file, so it does not have to be rebuilt.
+// The chain file was checked before it was moved into place, so it is marked as checked too.
+func (s *JSONStore) storeIndex(name string, ci *chainIndex) {
+	fS, err := os.Stat(s.chainPath(name))
+	if err != nil {
+		s.forgetIndex(name)
+		return
+	}
+	ci.Size = fS.Size()
+	ci.ModTime = fS.ModTime()
+
+	s.indexesMx.Lock()
+	s.indexes[name] = ci
+	s.checked[name] = checkedFile{Size: fS.Size(), ModTime: fS.ModTime()}
+	s.indexesMx.Unlock()
+}
+
+func (s *JSONStore) forgetIndex(name string) {
+	s.indexesMx.Lock()
+	delete(s.indexes, name)
+	delete(s.checked, name)
+	s.indexesMx.Unlock()
+}
+
+// Parent reads a single parent from a chain file using the chain's index.
+func (s *JSONStore) Parent(name, word string) (p Parent, exists bool, err error) {
+	ci, err := s.index(name)
+	if err != nil {
+		return p, false, notFoundError(name, err)
+	}
+
+	entry, exists := ci.Entries[word]
+	if !exists {
+		return p, false, nil
+	}
+
+	f, err := os.Open(s.chainPath(name))
+	if err != nil {
+		return p, false, err
+	}
+	defer f.Close()
+
+	b := make([]byte, entry.Length)
+	if _, err = f.ReadAt(b, entry.Offset); err != nil {
+		return p, false, err
+	}
+
+	// Entries are separated by commas and newlines that the decoder skipped over.
+	b = bytes.TrimLeft(b, ", \t\r\n")
+	if err = json.Unmarshal(b, &p); err != nil {
+		return p, false, corruptChainError(s.chainPath(name), err)
+	}
+
+	return p, true, nil
+}
@@ -0,0 +1,102 @@
+package markov
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestIndexUpdate(t *testing.T) {
+	tests := []struct {
+		name   string
+		inputs []string
+	}{
+		{"weights change", []string{"hello there"}},
+		{"parents are added", []string{"hello you", "well then"}},
+	}
+
+	for _, store := range testStores() {
+		for _, tt := range tests {
+			t.Run(store.name+"/"+tt.name, func(t *testing.T) {
+				e := newTestEngine(t, StartInstructions{Store: store.open(t), Order: 1})
+				e.In("c", "hello there")
+				if err := e.TempTriggerWrite(); err != nil {
+					t.Fatal(err)
+				}
+				ci, err := e.getIndex("c")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				for _, input := range tt.inputs {
+					e.In("c", input)
+				}
+				if err := e.TempTriggerWrite(); err != nil {
+					t.Fatal(err)
+				}
+
+				// The write updated the index instead of dropping it.
+				updated, exists := e.cachedIndex("c")
+				if !exists || updated != ci {
+					t.Fatal("index was dropped by the write")
+				}
+
+				e.forgetIndex("c")
+				e.forgetChainStats("c")
+				built, err := e.getIndex("c")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(updated.Entries, built.Entries) || updated.Sum != built.Sum {
+					t.Errorf("updated index is %+v, want %+v", updated.Entries, built.Entries)
+				}
+				if !reflect.DeepEqual(sorted(updated.Order), sorted(built.Order)) {
+					t.Errorf("updated index has parents %v, want %v", updated.Order, built.Order)
+				}
+				for key, words := range built.Heads {
+					if !reflect.DeepEqual(sorted(updated.Heads[key]), sorted(words)) {
+						t.Errorf("heads of %s are %v, want %v", key, updated.Heads[key], words)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestIndexRemovedParent(t *testing.T) {
+	e := newTestEngine(t, StartInstructions{Order: 1})
+	e.In("c", "hello there")
+	e.In("c", "well then")
+	if err := e.TempTriggerWrite(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.getIndex("c"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Taking a parent out of the chain drops the index, so it is built again without it.
+	_, w := e.doesWorkerExist("c")
+	w.ChainMx.Lock()
+	err := e.mergeIntoStore("c", w.Info, []Parent{{Word: "well", Children: []Child{{Word: "then", Value: -1}}, Grandparents: []Grandparent{{Word: e.instructions.StartKey, Value: -1}}}})
+	w.ChainMx.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, exists := e.cachedIndex("c"); exists {
+		t.Error("index was kept after a parent was taken out")
+	}
+	ci, err := e.getIndex("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := ci.Entries["well"]; exists {
+		t.Error("parent that was taken out is in the index")
+	}
+}
+
+func sorted(words []string) []string {
+	words = append([]string(nil), words...)
+	sort.Strings(words)
+	return words
+}
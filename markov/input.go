@@ -1,215 +1,153 @@
 package markov
 
 import (
+	"fmt"
 	"strings"
+	"time"
 )
 
 // In adds an entry into a specific chain.
-func In(chainName string, content string) {
+// The entry is still added if it could not be logged, in which case the error is returned.
+func (e *Engine) In(chainName string, content string) error {
 	if content == "" || len(content) <= 0 {
-		return
+		return nil
 	}
 
-	exists, w := doesWorkerExist(chainName)
-	if !exists {
-		w = newWorker(chainName)
-	}
+	chainName = e.resolve(chainName)
+
+	w := e.getOrCreateWorker(chainName)
 
+	arrived := time.Now().Unix()
+
+	// The log is synced after the worker is unlocked, so other inputs are not held up by it.
 	w.ChainMx.Lock()
-	w.addInput(content)
+	logged, err := w.appendToLog(logRecord{Content: content, Arrived: arrived})
+	w.addInput(content, arrived)
 	w.ChainMx.Unlock()
+
+	if err == nil {
+		err = w.syncLog(logged)
+	}
+	if err != nil {
+		return fmt.Errorf("logging input for chain %s: %w", chainName, err)
+	}
+
+	return nil
 }
 
-func (w *worker) addInput(content string) {
-	slice := prepareContentForChainProcessing(content)
-	w.Chain.extractHead(w.Name, slice)
-	w.Chain.extractBody(w.Name, slice)
-	w.Chain.extractTail(w.Name, slice)
+// addInput adds content that arrived at the Unix time arrived. Edges are only stamped with when they were seen if they decay.
+func (w *worker) addInput(content string, arrived int64) {
+	var seen int64
+	if w.engine.decays() {
+		seen = arrived
+	}
+
+	w.Chain.addContent(w.engine.prepareContentForChainProcessing(content, w.Info), seen)
+	w.Fingerprints.addMessage(w.engine.words(content), w.engine.instructions.SeparationKey)
 
 	w.Intake++
-	stats.TotalInputs++
-	stats.SessionInputs++
+	w.engine.statsMx.Lock()
+	w.engine.stats.TotalInputs++
+	w.engine.stats.SessionInputs++
+	w.engine.statsMx.Unlock()
+}
+
+func (c *chain) addContent(slice []string, seen int64) {
+	c.extractHead(slice, seen)
+	c.extractBody(slice, seen)
+	c.extractTail(slice, seen)
 }
 
-func prepareContentForChainProcessing(content string) []string {
+// prepareContentForChainProcessing splits the content into parents of info.Order words, between the start and end key.
+// The last parent is shorter if the words do not divide evenly.
+func (e *Engine) prepareContentForChainProcessing(content string, info ChainInfo) []string {
 	var returnSlice []string
-	returnSlice = append(returnSlice, instructions.StartKey)
-	slice := strings.Split(content, instructions.SeparationKey)
-	for i := 0; i <= len(slice)-1; i += 3 {
-		if len(slice)-1 > i+1 {
-			returnSlice = append(returnSlice, slice[i]+instructions.SeparationKey+slice[i+1]+instructions.SeparationKey+slice[i+2])
-		} else if len(slice)-1 > i {
-			returnSlice = append(returnSlice, slice[i]+instructions.SeparationKey+slice[i+1])
-		} else {
-			returnSlice = append(returnSlice, slice[i])
+	returnSlice = append(returnSlice, e.instructions.StartKey)
+	slice := strings.Split(content, e.instructions.SeparationKey)
+
+	step := info.Order
+	if info.Chunking == "sliding" {
+		step = 1
+	}
+
+	for i := 0; i < len(slice); i += step {
+		end := i + info.Order
+		if end > len(slice) {
+			end = len(slice)
+		}
+
+		returnSlice = append(returnSlice, strings.Join(slice[i:end], e.instructions.SeparationKey))
+		if end == len(slice) {
+			break
 		}
 	}
-	returnSlice = append(returnSlice, instructions.EndKey)
+
+	returnSlice = append(returnSlice, e.instructions.EndKey)
 	return returnSlice
 }
 
-func (c *chain) extractHead(name string, slice []string) {
-	start := slice[0]
-	next := slice[1]
+// newChainInfo returns how new chains are built according to the instructions.
+func (e *Engine) newChainInfo() ChainInfo {
+	return ChainInfo{
+		Order:    e.instructions.Order,
+		Chunking: e.instructions.Chunking,
+	}.withDefaults()
+}
 
-	parentExists := false
-	for i := 0; i < len(c.Parents); i++ {
-		parent := &c.Parents[i]
-		if parent.Word == start {
-			parentExists = true
-
-			childExists := false
-			for i := 0; i < len(parent.Children); i++ {
-				child := &parent.Children[i]
-				if child.Word == next {
-					childExists = true
-					child.Value += 1
-				}
-			}
-
-			if !childExists {
-				child := child{
-					Word:  next,
-					Value: 1,
-				}
-				parent.Children = append(parent.Children, child)
-			}
-		}
+// chainInfo returns how an existing chain was built.
+func (e *Engine) chainInfo(name string) (ChainInfo, error) {
+	// Every chain of a blend is built the same way.
+	if blend, isBlend := e.blendOf(name); isBlend {
+		name = blend[0].Chain
 	}
 
-	if !parentExists {
-		var children []child
-		child := child{
-			Word:  next,
-			Value: 1,
-		}
-		children = append(children, child)
-		parent := parent{
-			Word:     start,
-			Children: children,
-		}
-		c.Parents = append(c.Parents, parent)
+	if exists, w := e.doesWorkerExist(name); exists {
+		return w.Info, nil
 	}
+
+	info, exists, err := e.store.Info(name)
+	if err != nil {
+		return info, err
+	}
+	if !exists {
+		return e.newChainInfo(), nil
+	}
+
+	return info.withDefaults(), nil
+}
+
+// withDefaults fills in what was left blank. The defaults are also how chains were built before chain info existed.
+func (info ChainInfo) withDefaults() ChainInfo {
+	if info.Order <= 0 {
+		info.Order = 3
+	}
+	if info.Chunking != "sliding" {
+		info.Chunking = "chunks"
+	}
+	return info
 }
 
-func (c *chain) extractBody(name string, slice []string) {
+func (c *chain) extractHead(slice []string, seen int64) {
+	start := slice[0]
+	next := slice[1]
+
+	c.addChild(start, next, seen)
+}
+
+func (c *chain) extractBody(slice []string, seen int64) {
 	for i := 0; i < len(slice)-2; i++ {
 		current := slice[i+1]
 		next := slice[i+2]
 		previous := slice[i]
 
-		parentExists := false
-		for i := 0; i < len(c.Parents); i++ {
-			parent := &c.Parents[i]
-			if parent.Word == current {
-				parentExists = true
-
-				// Deal with child
-				childExists := false
-				for i := 0; i < len(parent.Children); i++ {
-					child := &parent.Children[i]
-					if child.Word == next {
-						childExists = true
-						child.Value += 1
-					}
-				}
-
-				if !childExists {
-					child := child{
-						Word:  next,
-						Value: 1,
-					}
-					parent.Children = append(parent.Children, child)
-				}
-
-				// Deal with grandparent
-				grandparentExists := false
-				for i := 0; i < len(parent.Grandparents); i++ {
-					grandparent := &parent.Grandparents[i]
-					if grandparent.Word == previous {
-						grandparentExists = true
-						grandparent.Value += 1
-					}
-				}
-
-				if !grandparentExists {
-					grandparent := grandparent{
-						Word:  previous,
-						Value: 1,
-					}
-					parent.Grandparents = append(parent.Grandparents, grandparent)
-				}
-			}
-		}
-
-		if !parentExists {
-			// Deal with child
-			var children []child
-			child := child{
-				Word:  next,
-				Value: 1,
-			}
-			children = append(children, child)
-
-			// Deal with grandparent
-			var grandparents []grandparent
-			grandparent := grandparent{
-				Word:  previous,
-				Value: 1,
-			}
-			grandparents = append(grandparents, grandparent)
-
-			// Add all to parent
-			parent := parent{
-				Word:         current,
-				Children:     children,
-				Grandparents: grandparents,
-			}
-			c.Parents = append(c.Parents, parent)
-		}
+		c.addChild(current, next, seen)
+		c.addGrandparent(current, previous, seen)
 	}
 }
 
-func (c *chain) extractTail(name string, slice []string) {
+func (c *chain) extractTail(slice []string, seen int64) {
 	end := slice[len(slice)-1]
 	previous := slice[len(slice)-2]
 
-	parentExists := false
-	for i := 0; i < len(c.Parents); i++ {
-		parent := &c.Parents[i]
-		if parent.Word == end {
-			parentExists = true
-
-			grandparentExists := false
-			for i := 0; i < len(parent.Grandparents); i++ {
-				grandparent := &parent.Grandparents[i]
-				if grandparent.Word == previous {
-					grandparentExists = true
-					grandparent.Value += 1
-				}
-			}
-
-			if !grandparentExists {
-				grandparent := grandparent{
-					Word:  previous,
-					Value: 1,
-				}
-				parent.Grandparents = append(parent.Grandparents, grandparent)
-			}
-		}
-	}
-
-	if !parentExists {
-		var grandparents []grandparent
-		grandparent := grandparent{
-			Word:  previous,
-			Value: 1,
-		}
-		grandparents = append(grandparents, grandparent)
-		parent := parent{
-			Word:         end,
-			Grandparents: grandparents,
-		}
-		c.Parents = append(c.Parents, parent)
-	}
+	c.addGrandparent(end, previous, seen)
 }
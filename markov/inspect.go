@@ -0,0 +1,47 @@
+package markov
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Inspect returns every parent in a chain that has the word in it, with its children and grandparents, most recorded first.
+// The word is matched literally, the same as a target. The parents are in the order the store keeps them in.
+func (e *Engine) Inspect(chainName, word string) (parents []Parent, err error) {
+	if word == "" {
+		return nil, ErrEmptyTarget
+	}
+
+	p, err := e.compilePhrase(word, "")
+	if err != nil {
+		return nil, err
+	}
+
+	chainName = e.resolve(chainName)
+	workers, err := e.lockChains(chainName)
+	if err != nil {
+		return nil, err
+	}
+	defer unlockWorkers(workers)
+
+	err = e.store.Iterate(chainName, func(parent Parent) error {
+		if !p.in(e.words(parent.Word)) {
+			return nil
+		}
+
+		sort.SliceStable(parent.Children, func(i, j int) bool {
+			return parent.Children[i].Value > parent.Children[j].Value
+		})
+		sort.SliceStable(parent.Grandparents, func(i, j int) bool {
+			return parent.Grandparents[i].Value > parent.Grandparents[j].Value
+		})
+
+		parents = append(parents, parent)
+		return nil
+	})
+	if err != nil {
+		return nil, e.handleChainError(chainName, fmt.Errorf("inspecting chain %s: %w", chainName, err))
+	}
+
+	return parents, nil
+}
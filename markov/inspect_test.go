@@ -0,0 +1,57 @@
+package markov
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	for _, store := range testStores() {
+		t.Run(store.name, func(t *testing.T) {
+			e := newTestEngine(t, StartInstructions{Store: store.open(t), Order: 1})
+			for _, message := range []string{"the cat sat", "the cat ate", "the cat ate", "a cat! ran"} {
+				e.In("c", message)
+			}
+			if err := e.TempTriggerWrite(); err != nil {
+				t.Fatal(err)
+			}
+
+			tests := []struct {
+				name    string
+				chain   string
+				word    string
+				want    []Parent
+				wantErr error
+			}{
+				{
+					name:  "most recorded first",
+					chain: "c",
+					word:  "cat",
+					want: []Parent{
+						{Word: "cat", Children: []Child{{Word: "ate", Value: 2}, {Word: "sat", Value: 1}}, Grandparents: []Grandparent{{Word: "the", Value: 3}}},
+						{Word: "cat!", Children: []Child{{Word: "ran", Value: 1}}, Grandparents: []Grandparent{{Word: "a", Value: 1}}},
+					},
+				},
+				{name: "not in the chain", chain: "c", word: "dog"},
+				{name: "no word", chain: "c", wantErr: ErrEmptyTarget},
+				{name: "chain does not exist", chain: "missing", word: "cat", wantErr: ErrChainNotFound},
+			}
+
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					parents, err := e.Inspect(tt.chain, tt.word)
+					if tt.wantErr != nil && !errors.Is(err, tt.wantErr) || tt.wantErr == nil && err != nil {
+						t.Fatalf("got %v, want %v", err, tt.wantErr)
+					}
+
+					sort.Slice(parents, func(i, j int) bool { return parents[i].Word < parents[j].Word })
+					if !reflect.DeepEqual(parents, tt.want) {
+						t.Errorf("got %+v, want %+v", parents, tt.want)
+					}
+				})
+			}
+		})
+	}
+}
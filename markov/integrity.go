@@ -0,0 +1,268 @@
+package markov
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func corruptChainError(path string, err error) error {
+	return fmt.Errorf("%w: %s: %v", ErrCorruptChain, path, err)
+}
+
+// quarantineChain sets a chain that cannot be read aside, so that it can be looked at without bringing anything else down.
+// Chains of stores that cannot set chains aside are left as they are, so nothing is lost.
+func (e *Engine) quarantineChain(name string) error {
+	e.forgetIndex(name)
+	e.forgetChainStats(name)
+
+	q, ok := e.store.(quarantiner)
+	if !ok {
+		return fmt.Errorf("chain %s is corrupt and was left as it is, as the store cannot quarantine chains", name)
+	}
+
+	quarantinePath, err := q.Quarantine(name)
+	if err != nil {
+		return fmt.Errorf("quarantining chain %s: %w", name, err)
+	}
+
+	e.reportError(fmt.Errorf("chain %s was quarantined to %s", name, quarantinePath))
+	return nil
+}
+
+// Quarantine moves a chain file into the quarantine folder.
+func (s *JSONStore) Quarantine(name string) (path string, err error) {
+	s.forgetIndex(name)
+
+	if err := os.MkdirAll(filepath.Join(s.directory, "quarantine"), 0755); err != nil {
+		return "", err
+	}
+
+	path = filepath.Join(s.directory, "quarantine", name+"_"+strconv.FormatInt(time.Now().Unix(), 10)+".json")
+	if err := os.Rename(s.chainPath(name), path); err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	return path, nil
+}
+
+// quarantineFile moves a file of the engine that cannot be read into the quarantine folder, returning where it went.
+func (e *Engine) quarantineFile(path string) (string, error) {
+	if err := os.MkdirAll(e.path("quarantine"), 0755); err != nil {
+		return "", err
+	}
+
+	ext := filepath.Ext(path)
+	quarantinePath := e.path("quarantine", strings.TrimSuffix(filepath.Base(path), ext)+"_"+strconv.FormatInt(time.Now().Unix(), 10)+ext)
+	if err := os.Rename(path, quarantinePath); err != nil {
+		return "", err
+	}
+
+	return quarantinePath, nil
+}
+
+// handleChainError quarantines the chain if the error says its file is corrupt and returns the error.
+func (e *Engine) handleChainError(name string, err error) error {
+	// A chain of a blend that is corrupt is handled by the blend as it reads it.
+	if _, isBlend := e.blendOf(name); isBlend {
+		return err
+	}
+
+	if errors.Is(err, ErrCorruptChain) {
+		if qErr := e.quarantineChain(name); qErr != nil {
+			return errors.Join(err, qErr)
+		}
+	}
+	return err
+}
+
+// finishChainFile closes a newly encoded chain file, makes sure it is on disk and intact and then moves it over the chain file.
+// If the new file does not pass the integrity check, it is removed and the chain file is left as it was.
+func (s *JSONStore) finishChainFile(name, newPath string, enc *encode) error {
+	if err := enc.CloseEncoder(); err != nil {
+		return err
+	}
+
+	if err := enc.File.Sync(); err != nil {
+		return err
+	}
+
+	if err := enc.File.Close(); err != nil {
+		return err
+	}
+
+	if err := verifyChainFile(newPath); err != nil {
+		os.Remove(newPath)
+		return fmt.Errorf("new chain file for %s failed integrity check, kept the old one: %v", name, err)
+	}
+
+	if err := removeAndRename(s.chainPath(name), newPath); err != nil {
+		return err
+	}
+	s.storeIndex(name, enc.Index)
+
+	return nil
+}
+
+// verifyChainFile checks a chain file against its footer.
+// Chain files written before footers existed are checked by decoding them in full instead.
+func verifyChainFile(path string) error {
+	hasFooter, err := verifyChecksum(path)
+	if err != nil {
+		return err
+	}
+
+	if !hasFooter {
+		_, err = buildIndex(path)
+	}
+	return err
+}
+
+// verifyChecksum checks a chain file against the length and checksum in its footer, if it has one.
+func verifyChecksum(path string) (hasFooter bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	fS, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	ft, footerLength, hasFooter := readFooter(f, fS.Size())
+	if !hasFooter {
+		return false, nil
+	}
+
+	if ft.Length+footerLength != fS.Size() {
+		return true, corruptChainError(path, fmt.Errorf("file is %s, but its footer says %s", ByteCountSI(fS.Size()), ByteCountSI(ft.Length+footerLength)))
+	}
+
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return true, err
+	}
+
+	h := crc32.NewIEEE()
+	if _, err = io.CopyN(h, f, ft.Length); err != nil {
+		return true, err
+	}
+
+	if h.Sum32() != ft.Checksum {
+		return true, corruptChainError(path, errors.New("file does not match its checksum"))
+	}
+
+	return true, nil
+}
+
+// checkChainFile checks a chain file against its checksum the first time it is read after it changed,
+// so that chains are not all checked at startup. Chain files without a footer are left to the decoder to catch.
+func (s *JSONStore) checkChainFile(name string) error {
+	fS, err := os.Stat(s.chainPath(name))
+	if err != nil {
+		return err
+	}
+
+	s.indexesMx.Lock()
+	v, checked := s.checked[name]
+	s.indexesMx.Unlock()
+
+	if checked && v.Size == fS.Size() && v.ModTime.Equal(fS.ModTime()) {
+		return nil
+	}
+
+	if _, err := verifyChecksum(s.chainPath(name)); err != nil {
+		return err
+	}
+
+	s.indexesMx.Lock()
+	s.checked[name] = checkedFile{Size: fS.Size(), ModTime: fS.ModTime()}
+	s.indexesMx.Unlock()
+
+	return nil
+}
+
+// readFooter reads the footer from the last line of a chain file, returning its length including line breaks.
+func readFooter(f *os.File, size int64) (ft footer, length int64, exists bool) {
+	tailSize := int64(128)
+	if size < tailSize {
+		tailSize = size
+	}
+
+	tail := make([]byte, tailSize)
+	if _, err := f.ReadAt(tail, size-tailSize); err != nil {
+		return ft, 0, false
+	}
+
+	trimmed := bytes.TrimRight(tail, "\n")
+	i := bytes.LastIndexByte(trimmed, '\n')
+	if i < 0 {
+		return ft, 0, false
+	}
+
+	line := trimmed[i+1:]
+	if !bytes.HasPrefix(line, []byte("{")) {
+		return ft, 0, false
+	}
+
+	if err := json.Unmarshal(line, &ft); err != nil {
+		return ft, 0, false
+	}
+
+	return ft, tailSize - int64(i+1), true
+}
+
+// Recover deals with the new chain files left behind by a write that was interrupted, returning a note for everything it did.
+// Chain files themselves are checked as they are first read, not here.
+func (s *JSONStore) Recover() (notes []string, err error) {
+	files, err := os.ReadDir(s.directory)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), "_new.json") {
+			continue
+		}
+
+		name := strings.TrimSuffix(file.Name(), "_new.json")
+		newPath := filepath.Join(s.directory, file.Name())
+		defaultPath := s.chainPath(name)
+
+		if err := verifyChainFile(newPath); err != nil {
+			os.Remove(newPath)
+			notes = append(notes, fmt.Sprintf("Recovery: removed incomplete new chain file for %s (%s)", name, err))
+			continue
+		}
+
+		// The new file is complete, so it is used unless the chain file is valid and newer.
+		// A file that cannot be moved is left for the next start, and the chain is read as it was.
+		newStats, err := os.Stat(newPath)
+		if err != nil {
+			notes = append(notes, fmt.Sprintf("Recovery: could not read new chain file for %s, leaving it (%s)", name, err))
+			continue
+		}
+		if oldStats, err := os.Stat(defaultPath); err == nil && verifyChainFile(defaultPath) == nil && oldStats.ModTime().After(newStats.ModTime()) {
+			os.Remove(newPath)
+			notes = append(notes, fmt.Sprintf("Recovery: kept chain file for %s and removed an older new chain file", name))
+			continue
+		}
+
+		if err := removeAndRename(defaultPath, newPath); err != nil {
+			notes = append(notes, fmt.Sprintf("Recovery: could not replace chain file for %s with the new chain file, leaving it (%s)", name, err))
+			continue
+		}
+		notes = append(notes, fmt.Sprintf("Recovery: replaced chain file for %s with the complete new chain file left by an interrupted write", name))
+	}
+
+	return notes, nil
+}
@@ -0,0 +1,261 @@
+package markov
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// mergeTestChain merges a parent hello with a child world of the value into chain c and returns the chain file afterwards.
+func mergeTestChain(t *testing.T, s *JSONStore, value int) []byte {
+	t.Helper()
+
+	batch := []Parent{
+		{Word: "hello", Children: []Child{{Word: "world", Value: value}}},
+		{Word: "world", Grandparents: []Grandparent{{Word: "hello", Value: value}}},
+	}
+	if err := s.Merge("c", ChainInfo{Order: 1}, batch); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(s.chainPath("c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// helloValue returns the value of the child world of the parent hello in chain c.
+func helloValue(t *testing.T, s ChainStore) int {
+	t.Helper()
+
+	p, exists, err := s.Parent("c", "hello")
+	if err != nil || !exists {
+		t.Fatalf("parent hello is %+v, %v, %v", p, exists, err)
+	}
+	return p.Children[0].Value
+}
+
+func TestVerifyChainFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(b []byte) []byte
+		corrupt bool
+	}{
+		{"intact", func(b []byte) []byte { return b }, false},
+		{"changed value", func(b []byte) []byte {
+			return bytes.Replace(b, []byte(`"Value":3`), []byte(`"Value":7`), 1)
+		}, true},
+		{"cut off", func(b []byte) []byte { return b[:len(b)/2] }, true},
+		{"added byte", func(b []byte) []byte {
+			i := bytes.Index(b, []byte("\n,")) + 1
+			return append(b[:i:i], append([]byte(" "), b[i:]...)...)
+		}, true},
+		{"no footer", func(b []byte) []byte {
+			return b[:bytes.Index(b, []byte("]\n"))+2]
+		}, false},
+		{"no footer, cut off", func(b []byte) []byte {
+			return b[:bytes.Index(b, []byte("\n,"))]
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewJSONStore(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := mergeTestChain(t, s, 3)
+
+			path := s.chainPath("c")
+			if err := os.WriteFile(path, tt.change(b), 0666); err != nil {
+				t.Fatal(err)
+			}
+
+			err = verifyChainFile(path)
+			if tt.corrupt && !errors.Is(err, ErrCorruptChain) {
+				t.Errorf("got %v, want ErrCorruptChain", err)
+			}
+			if !tt.corrupt && err != nil {
+				t.Errorf("got %v, want no error", err)
+			}
+		})
+	}
+}
+
+func TestJSONStoreRecover(t *testing.T) {
+	tests := []struct {
+		name       string
+		newFile    func(b []byte) []byte
+		noChain    bool
+		chainNewer bool
+		want       int
+	}{
+		{"complete new file replaces chain file", func(b []byte) []byte { return b }, false, false, 2},
+		{"cut off new file is removed", func(b []byte) []byte { return b[:len(b)/2] }, false, false, 1},
+		{"new file older than chain file is removed", func(b []byte) []byte { return b }, false, true, 1},
+		{"new file without chain file is used", func(b []byte) []byte { return b }, true, false, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s, err := NewJSONStore(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			old := mergeTestChain(t, s, 1)
+			updated := mergeTestChain(t, s, 1)
+
+			// Leave the store as a write that was interrupted before moving the new file over the chain file would.
+			chainPath, newPath := s.chainPath("c"), s.newChainPath("c")
+			if err := os.WriteFile(chainPath, old, 0666); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(newPath, tt.newFile(updated), 0666); err != nil {
+				t.Fatal(err)
+			}
+
+			chainTime, newTime := time.Now().Add(-time.Hour), time.Now()
+			if tt.chainNewer {
+				chainTime, newTime = newTime, chainTime
+			}
+			os.Chtimes(chainPath, chainTime, chainTime)
+			os.Chtimes(newPath, newTime, newTime)
+			if tt.noChain {
+				os.Remove(chainPath)
+			}
+
+			s, err = NewJSONStore(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			notes, err := s.Recover()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(notes) != 1 {
+				t.Errorf("notes are %q, want one", notes)
+			}
+
+			if _, err := os.Stat(newPath); !os.IsNotExist(err) {
+				t.Error("new chain file was left behind")
+			}
+			if got := helloValue(t, s); got != tt.want {
+				t.Errorf("value is %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONStoreRecoverCannotMove(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewJSONStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated := mergeTestChain(t, s, 1)
+
+	// Nothing can be moved over a folder that is not empty.
+	chainPath, newPath := s.chainPath("c"), s.newChainPath("c")
+	os.Remove(chainPath)
+	if err := os.MkdirAll(filepath.Join(chainPath, "in the way"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(newPath, updated, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	notes, err := s.Recover()
+	if err != nil {
+		t.Fatalf("recovering failed instead of leaving the new file: %v", err)
+	}
+	if len(notes) != 1 {
+		t.Errorf("notes are %q, want one", notes)
+	}
+	if _, err := os.Stat(newPath); err != nil {
+		t.Errorf("new chain file was not left for the next start: %v", err)
+	}
+}
+
+func TestJSONStoreChecksOnRead(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewJSONStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := mergeTestChain(t, s, 3)
+
+	// A changed value still decodes, so only the checksum can tell.
+	b = bytes.Replace(b, []byte(`"Value":3`), []byte(`"Value":7`), 1)
+	if err := os.WriteFile(s.chainPath("c"), b, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = NewJSONStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if notes, err := s.Recover(); err != nil || len(notes) != 0 {
+		t.Fatalf("recover gave %q, %v, want it to leave chain files alone", notes, err)
+	}
+
+	if info, exists, err := s.Info("c"); err != nil || !exists || info.Order != 1 {
+		t.Errorf("info is %+v, %v, %v", info, exists, err)
+	}
+	if _, _, err := s.Parent("c", "hello"); !errors.Is(err, ErrCorruptChain) {
+		t.Errorf("parent gave %v, want ErrCorruptChain", err)
+	}
+	if err := s.Iterate("c", func(Parent) error { return nil }); !errors.Is(err, ErrCorruptChain) {
+		t.Errorf("iterate gave %v, want ErrCorruptChain", err)
+	}
+	if err := s.Merge("c", ChainInfo{Order: 1}, nil); !errors.Is(err, ErrCorruptChain) {
+		t.Errorf("merge gave %v, want ErrCorruptChain", err)
+	}
+
+	if after, _ := os.ReadFile(s.chainPath("c")); !bytes.Equal(after, b) {
+		t.Error("failed merge changed the chain file")
+	}
+	if _, err := os.Stat(s.newChainPath("c")); !os.IsNotExist(err) {
+		t.Error("failed merge left a new chain file behind")
+	}
+}
+
+func TestEngineQuarantinesCorruptChain(t *testing.T) {
+	dir := t.TempDir()
+	e := newTestEngine(t, StartInstructions{Directory: dir, Order: 1})
+	e.In("c", "hello there")
+	e.In("other", "hello there")
+	if err := e.TempTriggerWrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "c.json")
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = bytes.Replace(b, []byte(`"Value":1`), []byte(`"Value":2`), 1)
+	if err := os.WriteFile(path, b, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	e = newTestEngine(t, StartInstructions{Directory: dir, Order: 1})
+	if _, err := e.Out(OutputInstructions{Chain: "c", Method: "LikelyBeginning"}); !errors.Is(err, ErrCorruptChain) {
+		t.Fatalf("got %v, want ErrCorruptChain", err)
+	}
+
+	if chains := e.Chains(); len(chains) != 1 || chains[0] != "other" {
+		t.Errorf("chains are %v, want only other", chains)
+	}
+	quarantined, _ := os.ReadDir(filepath.Join(dir, "quarantine"))
+	if len(quarantined) != 1 {
+		t.Errorf("quarantine has %d files, want 1", len(quarantined))
+	}
+	if _, err := e.Out(OutputInstructions{Chain: "other", Method: "LikelyBeginning"}); err != nil {
+		t.Errorf("other chain: %v", err)
+	}
+}
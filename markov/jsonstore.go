@@ -0,0 +1,318 @@
+package markov
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JSONStore keeps every chain as a JSON file in a directory. Every merge rewrites the chain file in full.
+// It is the store used when StartInstructions has no Store.
+type JSONStore struct {
+	directory string
+
+	indexes   map[string]*chainIndex
+	checked   map[string]checkedFile
+	indexesMx sync.Mutex
+}
+
+// checkedFile is the size and modification time a chain file had when it last passed its checksum.
+type checkedFile struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// NewJSONStore returns a store that keeps chain files in directory, creating it if it does not exist.
+func NewJSONStore(directory string) (*JSONStore, error) {
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return nil, err
+	}
+
+	return &JSONStore{
+		directory: directory,
+		indexes:   make(map[string]*chainIndex),
+		checked:   make(map[string]checkedFile),
+	}, nil
+}
+
+func (s *JSONStore) chainPath(name string) string {
+	return filepath.Join(s.directory, name+".json")
+}
+
+func (s *JSONStore) newChainPath(name string) string {
+	return filepath.Join(s.directory, name+"_new.json")
+}
+
+// Merge writes the existing chain file merged with the batch into a new chain file that replaces the old one.
+func (s *JSONStore) Merge(name string, info ChainInfo, batch []Parent) error {
+	return s.MergeAndWatch(name, info, batch, nil)
+}
+
+// MergeAndWatch merges like Merge, keeping every parent the batch touched until the new chain file is in place.
+func (s *JSONStore) MergeAndWatch(name string, info ChainInfo, batch []Parent, changed func(old, updated Parent)) error {
+	var changes [][2]Parent
+
+	defaultPath := s.chainPath(name)
+	newPath := s.newChainPath(name)
+
+	batchIndex := make(map[string]int, len(batch))
+	for i, p := range batch {
+		if _, exists := batchIndex[p.Word]; !exists {
+			batchIndex[p.Word] = i
+		}
+	}
+	merged := make([]bool, len(batch))
+
+	// Check and open existing chain file
+	if err := s.checkChainFile(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	f, err := os.Open(defaultPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// Create a new chain file and start the new file encoder
+	enc, err := createChainFile(newPath)
+	if err != nil {
+		if f != nil {
+			f.Close()
+		}
+		return err
+	}
+	enc.Info = info
+
+	// If the chain file exists, merge every parent in it with the batch.
+	if f != nil {
+		defer f.Close()
+
+		// Start a new decoder
+		dec := json.NewDecoder(f)
+
+		// Get beginning token
+		if _, err = dec.Token(); err != nil {
+			abandonChainFile(enc, newPath)
+			return corruptChainError(defaultPath, err)
+		}
+
+		for dec.More() {
+			var existingParent Parent
+
+			if err = dec.Decode(&existingParent); err != nil {
+				abandonChainFile(enc, newPath)
+				return corruptChainError(defaultPath, err)
+			}
+
+			updatedParent, keep := existingParent, true
+			if i, exists := batchIndex[existingParent.Word]; exists && !merged[i] {
+				updatedParent, keep = mergeBatch(existingParent, batch, i, merged)
+				if changed != nil {
+					changes = append(changes, [2]Parent{existingParent, updatedParent})
+				}
+			}
+
+			if !keep {
+				continue
+			}
+
+			if err := enc.AddEntry(updatedParent); err != nil {
+				abandonChainFile(enc, newPath)
+				return err
+			}
+		}
+	}
+
+	// Add every new parent that is left over
+	for i, nParent := range batch {
+		if merged[i] {
+			continue
+		}
+
+		updatedParent, keep := mergeBatch(Parent{Word: nParent.Word}, batch, i, merged)
+		if !keep {
+			continue
+		}
+		if changed != nil {
+			changes = append(changes, [2]Parent{{Word: nParent.Word}, updatedParent})
+		}
+
+		if err := enc.AddEntry(updatedParent); err != nil {
+			abandonChainFile(enc, newPath)
+			return err
+		}
+	}
+
+	// Verify the new file and move it over the old one
+	if err := s.finishChainFile(name, newPath, enc); err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		changed(change[0], change[1])
+	}
+	return nil
+}
+
+// mergeBatch merges every parent in the batch from i onwards that has the same word into p, marking them as merged.
+func mergeBatch(p Parent, batch []Parent, i int, merged []bool) (Parent, bool) {
+	keep := true
+	for ; i < len(batch); i++ {
+		if merged[i] || batch[i].Word != p.Word {
+			continue
+		}
+
+		p, keep = mergeParent(p, batch[i])
+		merged[i] = true
+	}
+
+	return p, keep
+}
+
+// Info reads the chain info from the chain file's footer.
+// Chain files written before footers existed have their info read from the chain's index instead.
+func (s *JSONStore) Info(name string) (info ChainInfo, exists bool, err error) {
+	f, err := os.Open(s.chainPath(name))
+	if os.IsNotExist(err) {
+		return info, false, nil
+	}
+	if err != nil {
+		return info, false, err
+	}
+	defer f.Close()
+
+	fS, err := f.Stat()
+	if err != nil {
+		return info, false, err
+	}
+
+	if ft, _, hasFooter := readFooter(f, fS.Size()); hasFooter {
+		return ft.ChainInfo, true, nil
+	}
+
+	ci, err := s.index(name)
+	if os.IsNotExist(err) {
+		return info, false, nil
+	}
+	if err != nil {
+		return info, false, err
+	}
+
+	return ci.Info, true, nil
+}
+
+// Iterate decodes the chain file one parent at a time.
+func (s *JSONStore) Iterate(name string, fn func(p Parent) error) error {
+	path := s.chainPath(name)
+
+	if err := s.checkChainFile(name); err != nil {
+		return notFoundError(name, err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return notFoundError(name, err)
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	if _, err = dec.Token(); err != nil {
+		return corruptChainError(path, err)
+	}
+
+	for dec.More() {
+		var p Parent
+
+		if err = dec.Decode(&p); err != nil {
+			return corruptChainError(path, err)
+		}
+
+		if err = fn(p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Count returns how many parents are in the chain file's index.
+func (s *JSONStore) Count(name string) (parents int, err error) {
+	ci, err := s.index(name)
+	if err != nil {
+		return 0, notFoundError(name, err)
+	}
+
+	return len(ci.Entries), nil
+}
+
+// Stat returns the size and modification time of the chain file.
+func (s *JSONStore) Stat(name string) (size int64, modTime time.Time, err error) {
+	fS, err := os.Stat(s.chainPath(name))
+	if err != nil {
+		return 0, modTime, notFoundError(name, err)
+	}
+
+	return fS.Size(), fS.ModTime(), nil
+}
+
+// Delete removes the chain file.
+func (s *JSONStore) Delete(name string) error {
+	s.forgetIndex(name)
+
+	err := os.Remove(s.chainPath(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// List returns the names of every chain file in the directory.
+func (s *JSONStore) List() (chains []string, err error) {
+	files, err := os.ReadDir(s.directory)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") || strings.HasSuffix(file.Name(), "_new.json") {
+			continue
+		}
+
+		chains = append(chains, strings.TrimSuffix(file.Name(), ".json"))
+	}
+
+	return chains, nil
+}
+
+// notFoundError returns ErrChainNotFound in place of the error for a chain file that does not exist, as every store does for a missing chain.
+func notFoundError(name string, err error) error {
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s", ErrChainNotFound, name)
+	}
+	return err
+}
+
+// createChainFile creates a new chain file and starts an encoder for it.
+func createChainFile(path string) (*encode, error) {
+	fN, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var enc encode
+	if err = StartEncoder(&enc, fN); err != nil {
+		abandonChainFile(&enc, path)
+		return nil, err
+	}
+
+	return &enc, nil
+}
+
+// abandonChainFile closes and removes a new chain file that could not be finished.
+func abandonChainFile(enc *encode, path string) {
+	enc.File.Close()
+	os.Remove(path)
+}
@@ -0,0 +1,124 @@
+package markov
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// phrase is a target split into words, each word being a check for the word in the same place in a parent.
+type phrase []func(word string) bool
+
+// targets are the target and bridge target of an output, compiled once so that they are not compiled for every parent they are matched against.
+type targets struct {
+	target       phrase
+	bridgeTarget phrase
+}
+
+func (e *Engine) compileTargets(oi OutputInstructions) (t targets, err error) {
+	if oi.Target != "" {
+		if t.target, err = e.compilePhrase(oi.Target, oi.Matching); err != nil {
+			return t, err
+		}
+	}
+
+	if oi.BridgeTarget != "" {
+		if t.bridgeTarget, err = e.compilePhrase(oi.BridgeTarget, oi.Matching); err != nil {
+			return t, err
+		}
+	}
+
+	return t, nil
+}
+
+// compilePhrase splits text into words and turns every word into a check for how it should be matched.
+//
+//	"literal": The word has to be the same, apart from punctuation around it, so "game" matches "game!". Default.
+//	"insensitive": Same as literal, but ignoring case.
+//	"regex": The word is a regular expression that has to match the whole word.
+//	"emote": The word has to be exactly the same, punctuation and case included, so "D:" only matches "D:".
+func (e *Engine) compilePhrase(text, matching string) (phrase, error) {
+	var p phrase
+	for _, word := range e.words(text) {
+		word := word // Every check keeps its own word.
+		switch matching {
+		case "", "literal":
+			p = append(p, func(w string) bool {
+				return w == word || trimPunctuation(w) == word
+			})
+		case "insensitive":
+			p = append(p, func(w string) bool {
+				return strings.EqualFold(w, word) || strings.EqualFold(trimPunctuation(w), word)
+			})
+		case "regex":
+			re, err := regexp.Compile("^(?:" + word + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidTarget, err)
+			}
+			p = append(p, re.MatchString)
+		case "emote":
+			p = append(p, func(w string) bool {
+				return w == word
+			})
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrInvalidMatching, matching)
+		}
+	}
+
+	return p, nil
+}
+
+func trimPunctuation(word string) string {
+	return strings.TrimFunc(word, unicode.IsPunct)
+}
+
+// matches returns whether every word matches the word of the phrase in the same place.
+func (p phrase) matches(words []string) bool {
+	if len(words) != len(p) {
+		return false
+	}
+
+	for i, word := range words {
+		if !p[i](word) {
+			return false
+		}
+	}
+	return true
+}
+
+// in returns whether the whole phrase is somewhere in words.
+func (p phrase) in(words []string) bool {
+	for i := 0; i+len(p) <= len(words); i++ {
+		if p.matches(words[i : i+len(p)]) {
+			return true
+		}
+	}
+	return false
+}
+
+// advance works out which beginnings of the phrase the output ends with after words are added to it, and whether the whole phrase is in them.
+// partial has bit k set if the output ended with the first k words of the phrase before the words were added.
+func (p phrase) advance(partial uint64, words []string) (uint64, bool) {
+	found := false
+	for _, word := range words {
+		var next uint64
+		for k := range p {
+			if k > 0 && partial&(1<<k) == 0 {
+				continue
+			}
+			if !p[k](word) {
+				continue
+			}
+
+			if k+1 == len(p) {
+				found = true
+			} else {
+				next |= 1 << (k + 1)
+			}
+		}
+		partial = next
+	}
+
+	return partial, found
+}
@@ -0,0 +1,106 @@
+package markov
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCompilePhrase(t *testing.T) {
+	e := &Engine{instructions: StartInstructions{SeparationKey: " "}}
+
+	tests := []struct {
+		name     string
+		target   string
+		matching string
+		words    string
+		want     bool
+	}{
+		{"literal", "game", "", "game", true},
+		{"literal with punctuation around it", "game", "literal", "game!", true},
+		{"literal keeps case", "game", "", "Game", false},
+		{"literal is not a regular expression", "c++", "", "c++", true},
+		{"literal does not match part of it", "c++", "", "c", false},
+		{"literal of punctuation", "(", "", "(", true},
+		{"insensitive", "game", "insensitive", "GAME,", true},
+		{"emote", "D:", "emote", "D:", true},
+		{"emote keeps case", "D:", "emote", "d:", false},
+		{"emote keeps punctuation", "Kappa", "emote", "Kappa!", false},
+		{"regex", "gam.", "regex", "game", true},
+		{"regex matches the whole word", "gam", "regex", "game", false},
+		{"regex alternatives match the whole word", "a|b", "regex", "ab", false},
+		{"regex alternative", "a|b", "regex", "b", true},
+		{"every word keeps its own check", "good game", "", "good game", true},
+		{"words are not checked against the last word", "good game", "", "game game", false},
+		{"words in another order", "good game", "", "game good", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := e.compilePhrase(tt.target, tt.matching)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := p.matches(strings.Fields(tt.words)); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := e.compilePhrase("c++", "regex"); !errors.Is(err, ErrInvalidTarget) {
+		t.Errorf("got %v for an invalid regular expression, want ErrInvalidTarget", err)
+	}
+	if _, err := e.compilePhrase("game", "fuzzy"); !errors.Is(err, ErrInvalidMatching) {
+		t.Errorf("got %v for an unknown matching, want ErrInvalidMatching", err)
+	}
+}
+
+func TestTargetedMatching(t *testing.T) {
+	e := newTestEngine(t, StartInstructions{Order: 1})
+	for _, message := range []string{"i love c++ so much", "( is a paren", "GG that was a Good game!", "LUL LUL LUL", "lul that is funny"} {
+		e.In("c", message)
+	}
+	if err := e.TempTriggerWrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method   string
+		target   string
+		matching string
+		want     string
+	}{
+		{"TargetedMiddle", "c++", "", "c++"},
+		{"TargetedMiddle", "(", "", "("},
+		{"TargetedMiddle", "good GAME", "insensitive", "Good game!"},
+		{"TargetedBeginning", "LUL", "emote", "LUL"},
+		{"TargetedMiddle", "[Gg][a-z]+", "regex", "Good"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			output, err := e.Out(OutputInstructions{Chain: "c", Method: tt.method, Target: tt.target, Matching: tt.matching, MaxAttempts: 20})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(output, tt.want) {
+				t.Errorf("%q does not have %q", output, tt.want)
+			}
+		})
+	}
+
+	if _, err := e.Out(OutputInstructions{Chain: "c", Method: "TargetedMiddle", Target: "c++", Matching: "regex"}); !errors.Is(err, ErrInvalidTarget) {
+		t.Errorf("got %v, want ErrInvalidTarget", err)
+	}
+
+	// Cleanse matches the same way.
+	if _, err := e.Cleanse("lul", "insensitive"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		output, err := e.Out(OutputInstructions{Chain: "c", Method: "RandomMiddle"})
+		if err == nil && strings.Contains(strings.ToLower(output), "lul") {
+			t.Fatalf("%q was not cleansed", output)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package markov
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps chains in memory only, so everything in it is lost when the program exits.
+// It is meant for tests and short lived engines.
+type MemoryStore struct {
+	chains map[string]*memoryChain
+	mx     sync.RWMutex
+
+	// quarantined keeps chains that were set aside, by the name Quarantine returned for them.
+	quarantined map[string]*memoryChain
+}
+
+type memoryChain struct {
+	parents map[string]Parent
+	order   []string
+	info    ChainInfo
+}
+
+// NewMemoryStore returns an empty store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		chains:      make(map[string]*memoryChain),
+		quarantined: make(map[string]*memoryChain),
+	}
+}
+
+func (s *MemoryStore) Parent(name, word string) (p Parent, exists bool, err error) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	c, exists := s.chains[name]
+	if !exists {
+		return p, false, fmt.Errorf("%w: %s", ErrChainNotFound, name)
+	}
+
+	p, exists = c.parents[word]
+	return copyParent(p), exists, nil
+}
+
+func (s *MemoryStore) Count(name string) (parents int, err error) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	c, exists := s.chains[name]
+	if !exists {
+		return 0, fmt.Errorf("%w: %s", ErrChainNotFound, name)
+	}
+
+	return len(c.parents), nil
+}
+
+func (s *MemoryStore) Info(name string) (info ChainInfo, exists bool, err error) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	c, exists := s.chains[name]
+	if !exists {
+		return info, false, nil
+	}
+
+	return c.info, true, nil
+}
+
+func (s *MemoryStore) Merge(name string, info ChainInfo, batch []Parent) error {
+	return s.MergeAndWatch(name, info, batch, nil)
+}
+
+// MergeAndWatch merges like Merge, passing every parent the batch touched to changed as it goes, as a merge cannot fail partway through.
+func (s *MemoryStore) MergeAndWatch(name string, info ChainInfo, batch []Parent, changed func(old, updated Parent)) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	c, exists := s.chains[name]
+	if !exists {
+		c = &memoryChain{
+			parents: make(map[string]Parent),
+		}
+		s.chains[name] = c
+	}
+	c.info = info
+
+	removed := false
+	for _, p := range batch {
+		existingParent, exists := c.parents[p.Word]
+		if !exists {
+			existingParent = Parent{Word: p.Word}
+		}
+
+		mergedParent, keep := mergeParent(existingParent, p)
+		if changed != nil {
+			changed(existingParent, mergedParent)
+		}
+		switch {
+		case keep && !exists:
+			c.order = append(c.order, p.Word)
+			c.parents[p.Word] = mergedParent
+		case keep:
+			c.parents[p.Word] = mergedParent
+		case exists:
+			delete(c.parents, p.Word)
+			removed = true
+		}
+	}
+
+	if removed {
+		order := c.order[:0]
+		for _, word := range c.order {
+			if _, exists := c.parents[word]; exists {
+				order = append(order, word)
+			}
+		}
+		c.order = order
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) Iterate(name string, fn func(p Parent) error) error {
+	s.mx.RLock()
+	c, exists := s.chains[name]
+	if !exists {
+		s.mx.RUnlock()
+		return fmt.Errorf("%w: %s", ErrChainNotFound, name)
+	}
+
+	parents := make([]Parent, 0, len(c.order))
+	for _, word := range c.order {
+		parents = append(parents, copyParent(c.parents[word]))
+	}
+	s.mx.RUnlock()
+
+	for _, p := range parents {
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) Delete(name string) error {
+	s.mx.Lock()
+	delete(s.chains, name)
+	s.mx.Unlock()
+
+	return nil
+}
+
+func (s *MemoryStore) List() (chains []string, err error) {
+	s.mx.RLock()
+	for name := range s.chains {
+		chains = append(chains, name)
+	}
+	s.mx.RUnlock()
+
+	sort.Strings(chains)
+	return chains, nil
+}
+
+// Quarantine moves a chain out of the store's chains and keeps it aside in memory, under the returned name.
+func (s *MemoryStore) Quarantine(name string) (path string, err error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	c, exists := s.chains[name]
+	if !exists {
+		return "", nil
+	}
+
+	path = "quarantine/" + name + "_" + strconv.FormatInt(time.Now().Unix(), 10)
+	s.quarantined[path] = c
+	delete(s.chains, name)
+
+	return path, nil
+}
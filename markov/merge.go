@@ -0,0 +1,136 @@
+package markov
+
+import "fmt"
+
+// mergeChunkSize is how many parents of a source chain are merged at once.
+var mergeChunkSize = 10000
+
+// Merge adds every parent of the source chains to the destination chain, creating it if it does not exist,
+// as if the destination had been given every message the sources were given. The sources are left as they are.
+// Every chain has to be built the same way. What was merged before an error stays merged, so a source can be partly merged.
+func (e *Engine) Merge(destination string, sources ...string) error {
+	destination = e.resolve(destination)
+	if destination == "" {
+		return fmt.Errorf("%w: destination is empty", ErrChainNotFound)
+	}
+
+	e.busy.Lock()
+	defer e.busy.Unlock()
+	defer e.duration(track("merge duration"))
+
+	var names []string
+	for _, source := range sources {
+		source = e.resolve(source)
+		if source == destination {
+			continue
+		}
+		if !e.DoesChainFileExist(source) {
+			return fmt.Errorf("%w: chain [%s] is not found in directory", ErrChainNotFound, source)
+		}
+		names = append(names, source)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	// A new destination is built the same way as its sources.
+	info, err := e.chainInfo(names[0])
+	if err != nil {
+		return e.handleChainError(names[0], err)
+	}
+	if e.DoesChainFileExist(destination) {
+		if info, err = e.chainInfo(destination); err != nil {
+			return e.handleChainError(destination, err)
+		}
+	}
+
+	for _, source := range names {
+		sourceInfo, err := e.chainInfo(source)
+		if err != nil {
+			return e.handleChainError(source, err)
+		}
+		if sourceInfo != info {
+			return fmt.Errorf("%w: chain %s is not built the same way as chain %s", ErrIncompatibleChains, source, destination)
+		}
+	}
+
+	w := e.getOrCreateWorker(destination)
+
+	w.ChainMx.Lock()
+	defer w.ChainMx.Unlock()
+	w.Info = info
+
+	for _, source := range names {
+		if err := e.mergeChain(w, source); err != nil {
+			return err
+		}
+	}
+
+	if err := w.saveFingerprints(); err != nil {
+		e.debugLog("Failed writing fingerprints for", w.Name, err)
+	}
+
+	return nil
+}
+
+// mergeChain adds every parent of the source chain and its fingerprints to the worker's chain. The worker has to be locked.
+// The source's worker is locked too, and what it has not written yet, which is what its log holds, is merged as well.
+// The source is merged mergeChunkSize parents at a time, so only its parent words are held in memory at once.
+func (e *Engine) mergeChain(w *worker, source string) error {
+	exists, sourceWorker := e.doesWorkerExist(source)
+	if exists {
+		sourceWorker.ChainMx.Lock()
+		defer sourceWorker.ChainMx.Unlock()
+	}
+
+	// Parents are read after iterating, as a store cannot be written to while it is iterated over.
+	var words []string
+	err := e.store.Iterate(source, func(p Parent) error {
+		words = append(words, p.Word)
+		return nil
+	})
+	if err != nil {
+		return e.handleChainError(source, fmt.Errorf("reading chain %s: %w", source, err))
+	}
+
+	merge := func(batch []Parent) error {
+		if err := e.mergeIntoStore(w.Name, w.Info, batch); err != nil {
+			return e.handleChainError(w.Name, fmt.Errorf("merging chain %s into chain %s: %w", source, w.Name, err))
+		}
+		return nil
+	}
+
+	for start := 0; start < len(words); start += mergeChunkSize {
+		batch := make([]Parent, 0, min(mergeChunkSize, len(words)-start))
+		for _, word := range words[start:min(start+mergeChunkSize, len(words))] {
+			p, exists, err := e.store.Parent(source, word)
+			if err != nil {
+				return e.handleChainError(source, fmt.Errorf("reading chain %s: %w", source, err))
+			}
+			if exists {
+				batch = append(batch, p)
+			}
+		}
+
+		if err := merge(batch); err != nil {
+			return err
+		}
+	}
+
+	if !exists {
+		return nil
+	}
+
+	// The source's log is kept, so if markov stops before the source is written, the source gets its input back and the destination already has it.
+	if sourceWorker.Chain.Len() > 0 {
+		if err := merge(sourceWorker.Chain.Parents()); err != nil {
+			return err
+		}
+	}
+
+	if sourceWorker.Fingerprints != nil {
+		w.Fingerprints.merge(sourceWorker.Fingerprints)
+	}
+
+	return nil
+}
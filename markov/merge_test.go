@@ -0,0 +1,120 @@
+package markov
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	e := newTestEngine(t, StartInstructions{Order: 1})
+	e.In("a", "hello there")
+	e.In("a", "hello there")
+	e.In("b", "hello you")
+	if err := e.TempTriggerWrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.Merge("both", "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Merge("a", "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Child{{Word: "there", Value: 2}, {Word: "you", Value: 1}}
+	for _, chain := range []string{"both", "a"} {
+		p, exists, err := e.store.Parent(chain, "hello")
+		if err != nil || !exists {
+			t.Fatalf("parent hello of %s is %+v, %v, %v", chain, p, exists, err)
+		}
+		for i := range p.Children {
+			p.Children[i].LastSeen = 0
+		}
+		if !reflect.DeepEqual(p.Children, want) {
+			t.Errorf("children of hello in %s are %+v, want %+v", chain, p.Children, want)
+		}
+	}
+
+	if p, _, _ := e.store.Parent("b", "hello"); len(p.Children) != 1 || p.Children[0].Value != 1 {
+		t.Errorf("source chain b changed to %+v", p)
+	}
+}
+
+func TestMergeUnwritten(t *testing.T) {
+	for _, chunkSize := range []int{1, 2, 10000} {
+		t.Run(fmt.Sprint(chunkSize), func(t *testing.T) {
+			defer func(size int) { mergeChunkSize = size }(mergeChunkSize)
+			mergeChunkSize = chunkSize
+
+			e := newTestEngine(t, StartInstructions{Order: 1})
+			e.In("a", "hello there")
+			e.In("b", "hello you over there")
+			if err := e.TempTriggerWrite(); err != nil {
+				t.Fatal(err)
+			}
+
+			// The source's unwritten input is merged too.
+			e.In("b", "hello you")
+			if err := e.Merge("a", "b"); err != nil {
+				t.Fatal(err)
+			}
+
+			want := map[string][]Child{
+				"hello": {{Word: "there", Value: 1}, {Word: "you", Value: 2}},
+				"you":   {{Word: "over", Value: 1}, {Word: e.instructions.EndKey, Value: 1}},
+				"over":  {{Word: "there", Value: 1}},
+			}
+			for word, children := range want {
+				p, exists, err := e.store.Parent("a", word)
+				if err != nil || !exists {
+					t.Fatalf("parent %s is %+v, %v, %v", word, p, exists, err)
+				}
+				if !reflect.DeepEqual(p.Children, children) {
+					t.Errorf("children of %s are %+v, want %+v", word, p.Children, children)
+				}
+			}
+
+			// The source still writes its own input.
+			if _, w := e.doesWorkerExist("b"); w.Chain.Len() == 0 {
+				t.Error("source's unwritten input was taken from it")
+			}
+		})
+	}
+}
+
+func TestMergeErrors(t *testing.T) {
+	e := newTestEngine(t, StartInstructions{Order: 1})
+	e.In("a", "hello there")
+	if err := e.TempTriggerWrite(); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.store.Merge("order2", ChainInfo{Order: 2}, []Parent{{Word: "hello there", Children: []Child{{Word: "you", Value: 1}}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		destination string
+		sources     []string
+		want        error
+	}{
+		{"missing source", "a", []string{"missing"}, ErrChainNotFound},
+		{"no destination", "", []string{"a"}, ErrChainNotFound},
+		{"built differently", "a", []string{"order2"}, ErrIncompatibleChains},
+		{"into itself", "a", []string{"a"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := e.Merge(tt.destination, tt.sources...); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	if p, _, _ := e.store.Parent("a", "hello"); len(p.Children) != 1 || p.Children[0].Value != 1 {
+		t.Errorf("chain a changed to %+v", p)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -16,8 +17,19 @@ import (
 //	EndKey: What string can be used to mark the end of a message. (E.g. "-!")
 //	ShouldZip: Whether or not to zip the markov-chains folder every six hours.
 //	DefluffTriggerValue: What value amount is too little to keep and therefore should be defluffed.
+//	ShouldDefluff: Whether or not to defluff every chain once a day. Defluff can always be called on demand.
 //	ErrorTracker: If you want to recieve errors from write operations, provide a channel.
 //	Debug: Print logs of stuffs.
+//	Directory: Where to keep the chains. If left blank, will be "./markov-chains".
+//	Store: Where to keep the chains instead of as JSON files in the directory, such as a BoltStore. The directory is still used for logs and stats.
+//	Order: How many words make up a parent in new chains. If left blank, will be 3.
+//	Chunking: How messages are split into parents in new chains. Existing chains keep what they were built with.
+//		"chunks": Next to each other without overlapping, e.g. "a b c" and "d e f". Default.
+//		"sliding": One word apart, overlapping, e.g. "a b c", "b c d" and "c d e".
+//	IsEmote: Decides which words of a chain are emotes, for chain stats. If left blank, chain stats have no emotes.
+//	HalfLife: How long it takes for a child or grandparent to count half as much, after it was last seen. If left blank, nothing decays.
+//		Decay is applied whenever a chain is read, with weights scaled up 1024 times so decayed edges keep their differences.
+//		Defluffing then goes by decayed values, and edges recorded before last seen times existed start decaying from the first defluff.
 type StartInstructions struct {
 	WriteInterval int
 	IntervalUnit  string
@@ -28,24 +40,199 @@ type StartInstructions struct {
 
 	ShouldZip           bool
 	DefluffTriggerValue int
+	ShouldDefluff       bool
 
 	ErrorChannel chan error
 	Debug        bool
+
+	Directory string
+	Store     ChainStore
+
+	Order    int
+	Chunking string
+
+	IsEmote func(chain, word string) bool
+
+	HalfLife time.Duration
+}
+
+// ChainInfo details how a chain was built, so that it is walked the same way.
+//
+//	Order: How many words make up a parent.
+//	Chunking: How messages were split into parents. "chunks" or "sliding".
+type ChainInfo struct {
+	Order    int    `json:"order,omitempty"`
+	Chunking string `json:"chunking,omitempty"`
 }
 
 // OutputInstructions details instructions on how to make an output.
 //
 //	Chain: What chain to use.
+//	Blend: What chains to walk together instead of Chain, each making up its weight's share of every step.
+//		Weights are relative to each other and count as 1 if left blank. Every chain has to be built the same way.
 //	Method: What method to use.
 //		"LikelyBeginning": Start with a likely beginning word.
 //		"TargetedBeginning": Start with a specific beginning word.
-//		"TargetedMiddle": Generate a message with a specific middle word. (yet to implement)
+//		"TargetedMiddle": Generate a message with a specific middle word.
 //		"TargetedEnding": End with a specific ending word.
 //		"LikelyEnding": End with a likely ending word.
+//		"TargetedBridge": Generate a message with the target and, somewhere after it, the bridge target.
+//		"RandomMiddle": Generate a message around a random parent.
+//	Target: What word or phrase to target, for the targeted methods. A phrase has to be in the message as is.
+//	BridgeTarget: What word or phrase has to come after the target, for TargetedBridge.
+//	Matching: How targets are matched against words. If left blank, will be "literal".
+//		"literal": The same word, apart from punctuation around it.
+//		"insensitive": The same word, apart from punctuation around it and case.
+//		"regex": Every word of the target is a regular expression that has to match a whole word.
+//		"emote": Exactly the same word, punctuation and case included.
+//	Sampling: How to pick each word. If left blank, words are picked as often as they were recorded.
+//	MinWords: The fewest words an output can have. If left blank, there is no minimum.
+//	MaxWords: The most words an output can have. Walks that go past it are given up on early. If left blank, there is no maximum.
+//	MaxAttempts: How many outputs to generate before giving up on one that meets the constraints or ends in a dead end. If left blank, will be 1.
+//	Forbidden: Strings an output cannot contain. Walks that run into one are given up on early.
+//	Originality: Rejects outputs that are a message the chain was given, or that have this many words in a row of one.
+//		Kept between 4 and 8 words. If left blank, outputs can copy messages.
+//		Only the most recent messages given since fingerprints were added are known, and rarely an output that copies nothing is rejected too.
+//	Accept: Decides whether a finished output can be used, after every other constraint is met. It is called with the chain locked,
+//		so it cannot make outputs from the same chain.
+//	BackOff: When the walk reaches a parent that does not exist or has nothing recorded after (or before) it,
+//		continue from a parent that ends (or starts) with the same words instead of failing with ErrDeadEnd.
 type OutputInstructions struct {
+	Chain        string
+	Blend        []BlendChain
+	Method       string
+	Target       string
+	BridgeTarget string
+	Matching     string
+
+	BackOff  bool
+	Sampling Sampling
+
+	MinWords    int
+	MaxWords    int
+	MaxAttempts int
+	Forbidden   []string
+	Originality int
+	Accept      func(output string) bool
+}
+
+// BlendChain is a chain in a blend and its weight.
+type BlendChain struct {
 	Chain  string
-	Method string
-	Target string
+	Weight float64
+}
+
+// Sampling details how words are picked from what the chain recorded.
+//
+//	Temperature: Below 1 makes likely words more likely, above 1 makes unlikely words more likely. If left blank, will be 1.
+//	TopK: Only pick from the k most likely words. If left blank, all words are used.
+//	TopP: Only pick from the most likely words that together make up this share of the weight, between 0 and 1. If left blank, all words are used.
+//	Greedy: Always pick the most likely word.
+//	Seed: What to seed a deterministic random source with when Seeded is set, so the same seed on the same chain gives the same output.
+//	Seeded: Use the seed, which can be any number including 0. If left blank, crypto/rand is used.
+type Sampling struct {
+	Temperature float64
+	TopK        int
+	TopP        float64
+	Greedy      bool
+	Seed        int64
+	Seeded      bool
+}
+
+// ChainScore details how likely a chain is to make a text.
+//
+//	Chain: What chain the text was scored against.
+//	LogLikelihood: The natural log of how likely every step is, added together. Closer to 0 is more likely.
+//	Perplexity: How many parents the chain was choosing between at each step, on average. Lower is more likely.
+//		Unlike LogLikelihood, it can be compared between texts of different lengths and chains of different orders.
+//	Steps: Every step from parent to child, starting at the start key and ending at the end key.
+type ChainScore struct {
+	Chain         string      `json:"chain"`
+	LogLikelihood float64     `json:"log_likelihood"`
+	Perplexity    float64     `json:"perplexity"`
+	Steps         []ScoreStep `json:"steps"`
+}
+
+// ScoreStep is how likely the chain is to go from a parent to a child.
+//
+//	Recorded: Whether the chain recorded the child after the parent at all.
+type ScoreStep struct {
+	Parent      string  `json:"parent"`
+	Child       string  `json:"child"`
+	Probability float64 `json:"probability"`
+	Recorded    bool    `json:"recorded"`
+}
+
+// Continuation is a parent the chain recorded next to a state.
+//
+//	Word: The parent.
+//	Text: The words the parent adds to the state. Blank if Edge.
+//	Edge: Whether the message ends here for Next, or starts here for Previous.
+//	Weight: How many times it was recorded, decayed if the engine has a half-life.
+//	Probability: Its share of the weight of every continuation, between 0 and 1.
+type Continuation struct {
+	Word        string  `json:"word"`
+	Text        string  `json:"text"`
+	Edge        bool    `json:"edge"`
+	Weight      int     `json:"weight"`
+	Probability float64 `json:"probability"`
+}
+
+// ChainStatistics details what is in a chain.
+//
+//	Parents: How many parents the chain has, apart from the start and end key.
+//	EdgeWeight: How many times a child was recorded after a parent, added up over every parent.
+//	Words: How many different words are in the chain's parents.
+//	TopWords: The most recorded words, counted once for every time a parent with the word in it was recorded.
+//	TopPhrases: The most recorded parents.
+//	TopEmotes: The most recorded emotes out of the 1000 most recorded words, decided by StartInstructions.IsEmote.
+//	BranchingEntropy: How many bits of choice there are on average when picking the next parent. 0 means every parent has only one child.
+//	Size: How many bytes the chain takes up in the store, if the store can tell.
+//	LastWrite: When the chain was last written to the store, if the store can tell.
+type ChainStatistics struct {
+	Chain            string      `json:"chain"`
+	Parents          int         `json:"parents"`
+	EdgeWeight       int64       `json:"edge_weight"`
+	Words            int         `json:"words"`
+	TopWords         []Frequency `json:"top_words"`
+	TopPhrases       []Frequency `json:"top_phrases"`
+	TopEmotes        []Frequency `json:"top_emotes"`
+	BranchingEntropy float64     `json:"branching_entropy"`
+	Size             int64       `json:"size"`
+	LastWrite        time.Time   `json:"last_write"`
+}
+
+// Frequency is a word or phrase and how many times it was recorded.
+type Frequency struct {
+	Text  string `json:"text"`
+	Count int64  `json:"count"`
+}
+
+// Graph is the parents around a word and how many times each of them was recorded after another.
+//
+//	Nodes: Every parent in the graph. Parents with the word in them are 0 hops away.
+//	Edges: Every child recorded after a parent in the graph, with how many times it was recorded.
+type Graph struct {
+	Chain string      `json:"chain"`
+	Word  string      `json:"word"`
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// GraphNode is a parent in a graph. The start and end key are left out of Word and marked with Start and End instead.
+type GraphNode struct {
+	ID    string `json:"id"`
+	Word  string `json:"word"`
+	Hops  int    `json:"hops"`
+	Start bool   `json:"start,omitempty"`
+	End   bool   `json:"end,omitempty"`
+}
+
+// GraphEdge goes from a parent to a child recorded after it. Value is decayed if the engine has a half-life.
+type GraphEdge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Value int    `json:"value"`
 }
 
 type worker struct {
@@ -53,26 +240,55 @@ type worker struct {
 	Chain   chain
 	ChainMx sync.Mutex
 	Intake  int
+	Info    ChainInfo
+
+	// Log is set while holding both ChainMx and LogMx, so holding either is enough to read it.
+	// LogMx is held while syncing, so inputs logged during a sync are synced together by the next one.
+	Log        *os.File
+	LogMx      sync.Mutex
+	logWritten atomic.Uint64
+	logSynced  uint64
+
+	// Fingerprints are of the most recent messages the chain was given since fingerprinting was added.
+	Fingerprints *fingerprints
+
+	engine *Engine
 }
 
+// chain is the input a worker has not written yet. Parents, children and grandparents are kept in maps,
+// so adding a word does not have to search through everything added before it.
 type chain struct {
-	Parents []parent
+	parents map[string]*chainParent
+	order   []string
+}
+
+// chainParent is a parent together with where each of its children and grandparents is.
+type chainParent struct {
+	Parent
+	children     map[string]int
+	grandparents map[string]int
 }
 
-type parent struct {
+// Parent is a word in a chain together with the words that came before it (grandparents) and after it (children),
+// each with how many times that happened.
+type Parent struct {
 	Word         string
-	Grandparents []grandparent
-	Children     []child
+	Grandparents []Grandparent
+	Children     []Child
 }
 
-type child struct {
-	Word  string
-	Value int
+// Child is a word that came after a parent. LastSeen is when it was last recorded, in Unix seconds, or 0 if it was recorded before last seen times existed.
+type Child struct {
+	Word     string
+	Value    int
+	LastSeen int64 `json:",omitempty"`
 }
 
-type grandparent struct {
-	Word  string
-	Value int
+// Grandparent is a word that came before a parent. LastSeen is when it was last recorded, in Unix seconds, or 0 if it was recorded before last seen times existed.
+type Grandparent struct {
+	Word     string
+	Value    int
+	LastSeen int64 `json:",omitempty"`
 }
 
 // WorkerStats contains the name of the chain the worker is responsible for and the intake amount in that worker.
@@ -98,6 +314,16 @@ type encode struct {
 	Encoder        *json.Encoder
 	File           *os.File
 	ContinuedEntry bool
+	Offset         int64
+	Checksum       uint32
+	Index          *chainIndex
+	Info           ChainInfo
+}
+
+type footer struct {
+	Length   int64  `json:"length"`
+	Checksum uint32 `json:"crc32"`
+	ChainInfo
 }
 
 type Progress struct {
@@ -1,615 +1,541 @@
 package markov
 
 import (
-	"encoding/json"
-	"errors"
 	"fmt"
-	"os"
-	"regexp"
 	"strings"
+	"time"
 )
 
-var (
-	previousChainSums = make(map[string]int64)
-)
+// maxWalkLength is how many parents a walk goes through before giving up on reaching the start or end key.
+const maxWalkLength = 200
 
 // Out takes output instructions and returns an output and error.
 // If a chain has less than 50 parent values, it will act as if the chain is not found in the directory.
-func Out(oi OutputInstructions) (output string, err error) {
-	name := oi.Chain
-	method := oi.Method
-	target := oi.Target
+func (e *Engine) Out(oi OutputInstructions) (output string, err error) {
+	output, _, err = e.OutWithAttempts(oi)
+	return output, err
+}
 
-	if !DoesChainFileExist(name) {
-		return "", errors.New("chain [" + name + "] is not found in directory")
+// OutWithAttempts is Out, but also returns how many outputs were generated to get one that meets the output instructions' constraints.
+func (e *Engine) OutWithAttempts(oi OutputInstructions) (output string, attempts int, err error) {
+	outputs, attempts, err := e.out(oi, 1)
+	if len(outputs) > 0 {
+		output = outputs[0]
 	}
+	return output, attempts, err
+}
 
-	exists, w := doesWorkerExist(name)
-	if exists {
-		if !w.ChainMx.TryLock() {
-			return
-		}
-		defer w.ChainMx.Unlock()
+// OutMany returns up to n different outputs, locking the chain and preparing the output instructions once for all of them.
+// Every output gets MaxAttempts attempts, shared between them, and an output that was already made counts as rejected.
+// An error is only returned if no outputs could be made, or if something other than the constraints stopped them.
+func (e *Engine) OutMany(oi OutputInstructions, n int) (outputs []string, err error) {
+	if n <= 0 {
+		return nil, nil
 	}
 
-	defer duration(track("output duration"))
+	outputs, _, err = e.out(oi, n)
+	return outputs, err
+}
 
-	switch method {
-	case "LikelyBeginning":
-		output, err = likelyBeginning(name)
-	case "LikelyEnding":
-		output, err = likelyEnding(name)
-	case "TargetedBeginning":
-		output, err = targetedBeginning(name, target)
-	case "TargetedEnding":
-		output, err = targetedEnding(name, target)
-	case "TargetedMiddle":
-		output, err = targetedMiddle(name, target)
-	case "RandomMiddle":
-		output, err = randomMiddle(name)
-	default:
-		return "", errors.New("no correct method provided")
+func (e *Engine) out(oi OutputInstructions, n int) (outputs []string, attempts int, err error) {
+	oi.Chain = e.resolve(oi.Chain)
+
+	// A blend is walked as a chain of its own, made up of its chains.
+	if len(oi.Blend) > 0 {
+		if oi.Chain, err = e.registerBlend(oi.Blend); err != nil {
+			return nil, 0, err
+		}
+		defer e.releaseBlend(oi.Chain)
 	}
+	name := oi.Chain
 
-	if err == nil {
-		stats.TotalOutputs++
-		stats.SessionOutputs++
+	workers, err := e.lockChains(name)
+	if err != nil {
+		return nil, 0, err
 	}
+	defer unlockWorkers(workers)
 
-	return output, err
-}
+	defer e.duration(track("output duration"))
 
-func likelyBeginning(name string) (output string, err error) {
-	var child string
-	var path = "./markov-chains/" + name + ".json"
+	if err = checkConstraints(oi); err != nil {
+		return nil, 0, err
+	}
 
-	parentWord, err := getStartWord(name)
+	s, err := newSampler(oi.Sampling)
 	if err != nil {
-		return "", err
+		return nil, 0, err
 	}
 
-	output = parentWord
-
-	for {
-		f, err := os.Open(path)
-		if err != nil {
-			return "", err
-		}
-		defer f.Close()
-
-		dec := json.NewDecoder(f)
-		_, err = dec.Token()
-		if err != nil {
-			return "", errors.New("EOF (via likelyBeginning) detected in " + path)
-		}
+	t, err := e.compileTargets(oi)
+	if err != nil {
+		return nil, 0, err
+	}
 
-		parentExists := false
-		var currentParent parent
-		for dec.More() {
-			err = dec.Decode(&currentParent)
-			if err != nil {
-				fmt.Println(name)
-				fmt.Println(currentParent)
-				panic(err)
-			}
+	info, err := e.chainInfo(name)
+	if err != nil {
+		return nil, 0, e.handleChainError(name, err)
+	}
 
-			if currentParent.Word == parentWord {
-				parentExists = true
+	maxAttempts := oi.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
 
-				child = getNextWord(currentParent)
+	made := make(map[string]bool, n)
+	for attempts < n*maxAttempts && len(outputs) < n {
+		attempts++
 
-				if child == instructions.EndKey {
-					return output, nil
-				} else {
-					output = output + instructions.SeparationKey + child
+		var output string
+		output, err = e.generate(oi, info, s, t)
 
-					parentWord = child
-					continue
-				}
-			}
+		// A chain file that cannot be read is quarantined instead of failing every output after this one.
+		err = e.handleChainError(name, err)
 
-			currentParent = parent{}
+		if err == nil {
+			err = e.acceptOutput(oi, output)
 		}
 
-		if !parentExists {
-			return output, fmt.Errorf("parent %s does not exist in chain %s", parentWord, name)
+		if err == nil {
+			err = e.acceptOriginalOutput(oi, workers, output)
 		}
-	}
-}
-
-func likelyEnding(name string) (output string, err error) {
-	var grandparent string
-	var path = "./markov-chains/" + name + ".json"
 
-	parentWord, err := getEndWord(name)
-	if err != nil {
-		return "", err
-	}
+		if err == nil && made[output] {
+			err = fmt.Errorf("%w: already made", ErrRejected)
+		}
 
-	output = parentWord
+		if err == nil {
+			made[output] = true
+			outputs = append(outputs, output)
 
-	for {
-		f, err := os.Open(path)
-		if err != nil {
-			return "", err
+			e.statsMx.Lock()
+			e.stats.TotalOutputs++
+			e.stats.SessionOutputs++
+			e.statsMx.Unlock()
+			continue
 		}
-		defer f.Close()
 
-		dec := json.NewDecoder(f)
-		_, err = dec.Token()
-		if err != nil {
-			return "", errors.New("EOF (via likelyEnding) detected in " + path)
+		if !isRetryable(err) {
+			break
 		}
+	}
 
-		parentExists := false
-		var currentParent parent
-		for dec.More() {
-			err = dec.Decode(&currentParent)
-			if err != nil {
-				fmt.Println(name)
-				fmt.Println(currentParent)
-				panic(err)
-			}
+	if len(outputs) > 0 && isRetryable(err) {
+		err = nil
+	}
 
-			if currentParent.Word == parentWord {
-				parentExists = true
+	return outputs, attempts, err
+}
 
-				grandparent = getPreviousWord(currentParent)
+// generate makes a single output with the method in the output instructions.
+func (e *Engine) generate(oi OutputInstructions, info ChainInfo, s *sampler, t targets) (output string, err error) {
+	switch oi.Method {
+	case "LikelyBeginning":
+		return e.likelyBeginning(oi, info, s)
+	case "LikelyEnding":
+		return e.likelyEnding(oi, info, s)
+	case "TargetedBeginning":
+		return e.targetedBeginning(oi, info, s, t)
+	case "TargetedEnding":
+		return e.targetedEnding(oi, info, s, t)
+	case "TargetedMiddle":
+		return e.targetedMiddle(oi, info, s, t)
+	case "TargetedBridge":
+		return e.targetedBridge(oi, info, s, t)
+	case "RandomMiddle":
+		return e.randomMiddle(oi, info, s)
+	default:
+		return "", fmt.Errorf("%w: %s", ErrInvalidMethod, oi.Method)
+	}
+}
 
-				if grandparent == instructions.StartKey {
-					return output, nil
-				} else {
-					output = grandparent + instructions.SeparationKey + output
+func (e *Engine) likelyBeginning(oi OutputInstructions, info ChainInfo, s *sampler) (output string, err error) {
+	name := oi.Chain
 
-					parentWord = grandparent
-					continue
-				}
-			}
+	parentWord, err := e.getStartWord(name, s)
+	if err != nil {
+		return "", err
+	}
 
-			currentParent = parent{}
-		}
+	return e.walkForward(oi, info, s, parentWord, parentWord)
+}
 
-		if !parentExists {
-			return output, fmt.Errorf("parent %s does not exist in chain %s", parentWord, name)
-		}
+func (e *Engine) likelyEnding(oi OutputInstructions, info ChainInfo, s *sampler) (output string, err error) {
+	name := oi.Chain
+
+	parentWord, err := e.getEndWord(name, s)
+	if err != nil {
+		return "", err
 	}
+
+	return e.walkBackward(oi, info, s, parentWord, parentWord)
 }
 
-func targetedBeginning(name, target string) (output string, err error) {
-	var path = "./markov-chains/" + name + ".json"
+func (e *Engine) targetedBeginning(oi OutputInstructions, info ChainInfo, s *sampler, t targets) (output string, err error) {
+	name := oi.Chain
+	target := oi.Target
 
 	if target == "" {
-		return "", errors.New("target is empty for TargetedBeginning")
+		return "", fmt.Errorf("%w for TargetedBeginning", ErrEmptyTarget)
 	}
 
-	if len(strings.Split(target, instructions.SeparationKey)) > 1 {
-		return "", fmt.Errorf("you can only have 1 target")
+	startParent, exists, err := e.getParent(name, e.instructions.StartKey)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", fmt.Errorf("%w: parent %s does not exist in chain %s", ErrEmptyChain, e.instructions.StartKey, name)
 	}
 
-	var parentWord string
-	var childChosen string
 	var initialList []Choice
+	for _, child := range startParent.Children {
+		if _, _, match := matchPhraseForward(e.words(child.Word), t.target); match {
+			initialList = append(initialList, Choice{
+				Word:   child.Word,
+				Weight: child.Value,
+			})
+		}
+	}
 
-	f, err := os.Open(path)
+	if len(initialList) <= 0 {
+		return "", fmt.Errorf("%w: %s does not contain parents that match: %s", ErrNoMatchingTarget, name, target)
+	}
+
+	parentWord, err := s.weightedRandom(initialList)
 	if err != nil {
 		return "", err
 	}
-	defer f.Close()
 
-	dec := json.NewDecoder(f)
-	_, err = dec.Token()
+	_, remaining, _ := matchPhraseForward(e.words(parentWord), t.target)
+	parentWord, output, err = e.walkForwardThrough(oi, info, s, parentWord, parentWord, remaining)
 	if err != nil {
-		return "", errors.New("EOF (via targetedBeginning) detected in " + path)
+		return output, err
 	}
 
-	var currentChild child
-	for dec.More() {
+	return e.walkForward(oi, info, s, parentWord, output)
+}
 
-		err = dec.Decode(&currentChild)
-		if err != nil {
-			panic(err)
-		}
+func (e *Engine) targetedEnding(oi OutputInstructions, info ChainInfo, s *sampler, t targets) (output string, err error) {
+	name := oi.Chain
+	target := oi.Target
 
-		if match, _ := regexp.MatchString("\\b"+target+"\\b", currentChild.Word); match {
+	if target == "" {
+		return "", fmt.Errorf("%w for TargetedEnding", ErrEmptyTarget)
+	}
+
+	endParent, exists, err := e.getParent(name, e.instructions.EndKey)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", fmt.Errorf("%w: parent %s does not exist in chain %s", ErrEmptyChain, e.instructions.EndKey, name)
+	}
+
+	var initialList []Choice
+	for _, grandparent := range endParent.Grandparents {
+		if _, _, match := matchPhraseBackward(e.words(grandparent.Word), t.target); match {
 			initialList = append(initialList, Choice{
-				Word:   currentChild.Word,
-				Weight: currentChild.Value,
+				Word:   grandparent.Word,
+				Weight: grandparent.Value,
 			})
 		}
-
-		currentChild = child{}
 	}
 
 	if len(initialList) <= 0 {
-		return "", fmt.Errorf("%s does not contain parents that match: %s", name, target)
+		return "", fmt.Errorf("%w: %s does not contain parents that match: %s", ErrNoMatchingTarget, name, target)
 	}
 
-	parentWord, err = weightedRandom(initialList)
+	parentWord, err := s.weightedRandom(initialList)
 	if err != nil {
 		return "", err
 	}
-	output = parentWord
 
-	for {
-		f, err := os.Open(path)
-		if err != nil {
-			panic(err)
-		}
-		defer f.Close()
-
-		dec := json.NewDecoder(f)
-		_, err = dec.Token()
-		if err != nil {
-			panic(err)
-		}
-
-		var currentParent parent
-		parentExists := false
-		for dec.More() {
-
-			err = dec.Decode(&currentParent)
-			if err != nil {
-				panic(err)
-			}
-
-			if currentParent.Word == parentWord {
-				parentExists = true
-				childChosen = getNextWord(currentParent)
-
-				if childChosen == instructions.EndKey {
-					return output, nil
-				} else {
-					output = output + instructions.SeparationKey + childChosen
-					parentWord = childChosen
-					continue
-				}
-			}
-
-			currentParent = parent{}
-		}
-
-		if !parentExists {
-			return output, fmt.Errorf("parent %s does not exist in chain %s", parentWord, name)
-		}
+	_, remaining, _ := matchPhraseBackward(e.words(parentWord), t.target)
+	parentWord, output, err = e.walkBackwardThrough(oi, info, s, parentWord, parentWord, remaining)
+	if err != nil {
+		return output, err
 	}
+
+	return e.walkBackward(oi, info, s, parentWord, output)
 }
 
-func targetedEnding(name, target string) (output string, err error) {
-	var path = "./markov-chains/" + name + ".json"
+func (e *Engine) targetedMiddle(oi OutputInstructions, info ChainInfo, s *sampler, t targets) (output string, err error) {
+	target := oi.Target
 
 	if target == "" {
-		return "", errors.New("target is empty for TargetedEnding")
-	}
-
-	if len(strings.Split(target, instructions.SeparationKey)) > 1 {
-		return "", fmt.Errorf("you can only have 1 target")
+		return "", fmt.Errorf("%w for TargetedMiddle", ErrEmptyTarget)
 	}
 
-	var parentWord string
-	var grandparentChosen string
-	var initialList []Choice
-
-	f, err := os.Open(path)
+	parentWord, err := e.getParentWithPhrase(oi, s, t.target)
 	if err != nil {
 		return "", err
 	}
-	defer f.Close()
 
-	dec := json.NewDecoder(f)
-	_, err = dec.Token()
+	_, remaining, _ := matchPhraseForward(e.words(parentWord), t.target)
+	return e.walkBothWays(oi, info, s, parentWord, remaining)
+}
+
+// getParentWithPhrase picks a parent that the phrase starts in, weighted by how often the parent was used.
+func (e *Engine) getParentWithPhrase(oi OutputInstructions, s *sampler, p phrase) (parentWord string, err error) {
+	name := oi.Chain
+
+	ci, err := e.getIndex(name)
 	if err != nil {
-		return "", errors.New("EOF (via targetedEnding) detected in " + path)
+		return "", err
 	}
 
-	var currentGrandparent grandparent
-
-	for dec.More() {
-		err = dec.Decode(&currentGrandparent)
-		if err != nil {
-			panic(err)
+	var initialList []Choice
+	for _, word := range ci.Order {
+		if word == e.instructions.StartKey || word == e.instructions.EndKey {
+			continue
 		}
 
-		if match, _ := regexp.MatchString("\\b"+target+"\\b", currentGrandparent.Word); match {
+		if _, _, match := matchPhraseForward(e.words(word), p); match {
+			entry := ci.Entries[word]
 			initialList = append(initialList, Choice{
-				Word:   currentGrandparent.Word,
-				Weight: currentGrandparent.Value,
+				Word:   word,
+				Weight: int(entry.ChildWeight + entry.GrandparentWeight),
 			})
 		}
-
-		currentGrandparent = grandparent{}
 	}
 
 	if len(initialList) <= 0 {
-		return "", fmt.Errorf("%s does not contain parents that match: %s", name, target)
+		return "", fmt.Errorf("%w: %s does not contain parents that match: %s", ErrNoMatchingTarget, name, oi.Target)
 	}
 
-	parentWord, err = weightedRandom(initialList)
+	return s.weightedRandom(initialList)
+}
+
+func (e *Engine) randomMiddle(oi OutputInstructions, info ChainInfo, s *sampler) (output string, err error) {
+	name := oi.Chain
+
+	// Get a random parent
+	parentWord, err := e.getRandomParent(name, s)
 	if err != nil {
 		return "", err
 	}
-	output = parentWord
 
-	for {
-		f, err := os.Open(path)
-		if err != nil {
-			panic(err)
+	return e.walkBothWays(oi, info, s, parentWord, nil)
+}
+
+// walkForward appends children to the output, starting from parentWord, until the end key is chosen.
+func (e *Engine) walkForward(oi OutputInstructions, info ChainInfo, s *sampler, parentWord, output string) (string, error) {
+	name := oi.Chain
+
+	for steps := 0; ; steps++ {
+		if steps == maxWalkLength {
+			return output, fmt.Errorf("%w: gave up after %d parents in chain %s", ErrNoEnd, maxWalkLength, name)
 		}
-		defer f.Close()
 
-		dec := json.NewDecoder(f)
-		_, err = dec.Token()
+		currentParent, exists, err := e.getParent(name, parentWord)
 		if err != nil {
-			panic(err)
+			return output, err
 		}
 
-		parentExists := false
-		var currentParent parent
-		for dec.More() {
-			err = dec.Decode(&currentParent)
+		if oi.BackOff && (!exists || len(currentParent.Children) == 0) {
+			p, found, err := e.backOff(name, parentWord, true, s)
 			if err != nil {
-				panic(err)
+				return output, err
 			}
-
-			if currentParent.Word == parentWord {
-				parentExists = true
-				grandparentChosen = getPreviousWord(currentParent)
-
-				if grandparentChosen == instructions.StartKey {
-					return output, nil
-				} else {
-					output = grandparentChosen + instructions.SeparationKey + output
-					parentWord = grandparentChosen
-					continue
-				}
+			if found {
+				currentParent, exists = p, true
 			}
+		}
 
-			currentParent = parent{}
+		if !exists {
+			return output, fmt.Errorf("%w: parent %s does not exist in chain %s", ErrDeadEnd, parentWord, name)
 		}
 
-		if !parentExists {
-			return output, fmt.Errorf("parent %s does not exist in chain %s", parentWord, name)
+		if len(currentParent.Children) == 0 {
+			return output, fmt.Errorf("%w: parent %s has no children in chain %s, most likely due to chain being defluffed", ErrDeadEnd, parentWord, name)
 		}
-	}
-}
 
-func targetedMiddle(name, target string) (output string, err error) {
-	var path = "./markov-chains/" + name + ".json"
+		childChosen := s.getNextWord(currentParent)
+		if childChosen == e.instructions.EndKey {
+			return output, nil
+		}
 
-	if target == "" {
-		return "", errors.New("target is empty for TargetedMiddle")
-	}
+		output = e.appendParent(info, output, childChosen)
+		parentWord = childChosen
 
-	if len(strings.Split(target, instructions.SeparationKey)) > 1 {
-		return "", fmt.Errorf("you can only have 1 target")
+		if err := e.acceptPartialOutput(oi, output); err != nil {
+			return output, err
+		}
 	}
+}
 
-	var parentWord string
-	var childChosen string
-	var grandparentChosen string
-
-	var initialList []Choice
-
-	f, err := os.Open(path)
-	if err != nil {
-		return "", err
-	}
-	defer f.Close()
+// walkBackward prepends grandparents to the output, starting from parentWord, until the start key is chosen.
+func (e *Engine) walkBackward(oi OutputInstructions, info ChainInfo, s *sampler, parentWord, output string) (string, error) {
+	name := oi.Chain
 
-	dec := json.NewDecoder(f)
-	_, err = dec.Token()
-	if err != nil {
-		return "", errors.New("EOF (via targetedMiddle) detected in " + path)
-	}
+	for steps := 0; ; steps++ {
+		if steps == maxWalkLength {
+			return output, fmt.Errorf("%w: gave up after %d parents in chain %s", ErrNoEnd, maxWalkLength, name)
+		}
 
-	var currentParent parent
-	for dec.More() {
-		err = dec.Decode(&currentParent)
+		currentParent, exists, err := e.getParent(name, parentWord)
 		if err != nil {
-			panic(err)
+			return output, err
 		}
 
-		if strings.Contains(currentParent.Word, instructions.SeparationKey+target+instructions.SeparationKey) {
-			var totalWeight int
-
-			for _, child := range currentParent.Children {
-				totalWeight += child.Value
+		if oi.BackOff && (!exists || len(currentParent.Grandparents) == 0) {
+			p, found, err := e.backOff(name, parentWord, false, s)
+			if err != nil {
+				return output, err
 			}
-
-			for _, grandparent := range currentParent.Grandparents {
-				totalWeight += grandparent.Value
+			if found {
+				currentParent, exists = p, true
 			}
-
-			initialList = append(initialList, Choice{
-				Word:   currentParent.Word,
-				Weight: totalWeight,
-			})
 		}
 
-		currentParent = parent{}
-	}
+		if !exists {
+			return output, fmt.Errorf("%w: parent %s does not exist in chain %s", ErrDeadEnd, parentWord, name)
+		}
 
-	if len(initialList) <= 0 {
-		return "", fmt.Errorf("%s does not contain parents that match: %s", name, target)
-	}
+		if len(currentParent.Grandparents) == 0 {
+			return output, fmt.Errorf("%w: parent %s has no grandparents in chain %s, most likely due to chain being defluffed", ErrDeadEnd, parentWord, name)
+		}
 
-	parentWord, err = weightedRandom(initialList)
-	if err != nil {
-		return "", err
-	}
-	output = parentWord
-	originalParentWord := parentWord
+		grandparentChosen := s.getPreviousWord(currentParent)
+		if grandparentChosen == e.instructions.StartKey {
+			return output, nil
+		}
 
-	var forwardComplete bool
+		output = e.prependParent(info, grandparentChosen, output)
+		parentWord = grandparentChosen
 
-goThroughBody:
-	f, err = os.Open(path)
-	if err != nil {
-		panic(err)
+		if err := e.acceptPartialOutput(oi, output); err != nil {
+			return output, err
+		}
 	}
-	defer f.Close()
+}
 
-	dec = json.NewDecoder(f)
-	_, err = dec.Token()
+// backOff finds a parent to continue the walk from when parentWord does not exist or has nothing recorded after it
+// (or before it, walking backward). It picks a parent that ends (or starts) with the same words as parentWord,
+// dropping one word at a time until one is found, so the walk continues from the words it already has.
+func (e *Engine) backOff(name, parentWord string, forward bool, s *sampler) (p Parent, found bool, err error) {
+	ci, err := e.getIndex(name)
 	if err != nil {
-		panic(err)
+		return p, false, err
 	}
 
-	parentExists := false
-	for dec.More() {
-		err = dec.Decode(&currentParent)
-		if err != nil {
-			panic(err)
+	words := strings.Split(parentWord, e.instructions.SeparationKey)
+	for k := len(words); k > 0; k-- {
+		var candidates []string
+		if forward {
+			candidates = ci.Tails[strings.Join(words[len(words)-k:], e.instructions.SeparationKey)]
+		} else {
+			candidates = ci.Heads[strings.Join(words[:k], e.instructions.SeparationKey)]
 		}
 
-		if currentParent.Word == parentWord {
-
-			if !forwardComplete {
-				parentExists = true
-				childChosen = getNextWord(currentParent)
-
-				if childChosen == instructions.EndKey {
-					forwardComplete = true
-					parentWord = originalParentWord
-					goto goThroughBody
-				} else {
-					output = output + instructions.SeparationKey + childChosen
-
-					parentWord = childChosen
-					goto goThroughBody
-				}
+		var choices []Choice
+		for _, word := range candidates {
+			if word == parentWord {
+				continue
 			}
 
-			if forwardComplete {
-				parentExists = true
-				grandparentChosen = getPreviousWord(currentParent)
+			weight := ci.Entries[word].GrandparentWeight
+			if forward {
+				weight = ci.Entries[word].ChildWeight
+			}
+			if weight > 0 {
+				choices = append(choices, Choice{
+					Word:   word,
+					Weight: int(weight),
+				})
+			}
+		}
 
-				if grandparentChosen == instructions.StartKey {
-					return output, nil
-				} else {
-					output = grandparentChosen + instructions.SeparationKey + output
+		if len(choices) == 0 {
+			continue
+		}
 
-					parentWord = grandparentChosen
-					goto goThroughBody
-				}
-			}
+		word, err := s.weightedRandom(choices)
+		if err != nil {
+			return p, false, err
 		}
 
-		currentParent = parent{}
+		e.debugLog("Backed off from", parentWord, "to", word, "in", name)
+		return e.getParent(name, word)
 	}
 
-	if !parentExists {
-		return output, fmt.Errorf("parent %s does not exist in chain %s", parentWord, name)
+	return p, false, nil
+}
+
+// appendParent adds what the next parent adds to the end of the output.
+// With a sliding window, the next parent overlaps the one before it, so only its last word is new.
+func (e *Engine) appendParent(info ChainInfo, output, parentWord string) string {
+	if info.Chunking == "sliding" {
+		words := strings.Split(parentWord, e.instructions.SeparationKey)
+		parentWord = words[len(words)-1]
 	}
 
-	return "", errors.New("internal error - code should not reach this point, most likely due to chain being defluffed or being empty  - TargetedMiddle - " + path)
+	return output + e.instructions.SeparationKey + parentWord
 }
 
-func getStartWord(name string) (phrase string, err error) {
-	var path = "./markov-chains/" + name + ".json"
-	var sum int64
-	if s, exists := previousChainSums[name]; !exists {
-		calculatedSum, err := getSum(name)
-		if err != nil {
-			panic(err)
-		}
-		sum = calculatedSum
-	} else {
-		sum = s
-		go getSum(name)
+// prependParent adds what the previous parent adds to the start of the output.
+// With a sliding window, the previous parent overlaps the one after it, so only its first word is new.
+func (e *Engine) prependParent(info ChainInfo, parentWord, output string) string {
+	if info.Chunking == "sliding" {
+		parentWord, _, _ = strings.Cut(parentWord, e.instructions.SeparationKey)
 	}
 
-	r, err := randomNumber(0, sum)
-	if err != nil {
-		return "", err
-	}
+	return parentWord + e.instructions.SeparationKey + output
+}
 
-	f, err := os.Open(path)
+// walkBothWays builds a sentence around parentWord by walking forward to the end key and then backward to the start key.
+// The walk forward first goes through the remaining words of a phrase that starts in parentWord, if there are any.
+func (e *Engine) walkBothWays(oi OutputInstructions, info ChainInfo, s *sampler, parentWord string, remaining phrase) (output string, err error) {
+	lastWord, output, err := e.walkForwardThrough(oi, info, s, parentWord, parentWord, remaining)
 	if err != nil {
-		return "", err
+		return output, err
 	}
-	defer f.Close()
-	dec := json.NewDecoder(f)
-	_, err = dec.Token()
+
+	output, err = e.walkForward(oi, info, s, lastWord, output)
 	if err != nil {
-		panic(err)
+		return output, err
 	}
-	for dec.More() {
-		var parent parent
 
-		err = dec.Decode(&parent)
-		if err != nil {
-			panic(err)
-		}
+	return e.walkBackward(oi, info, s, parentWord, output)
+}
 
-		if parent.Word == instructions.StartKey {
-			for _, child := range parent.Children {
-				r -= int64(child.Value)
+func (e *Engine) getParent(name, word string) (p Parent, exists bool, err error) {
+	if blend, isBlend := e.blendOf(name); isBlend {
+		return e.blendParent(blend, word)
+	}
 
-				if r < 0 {
-					return child.Word, nil
-				}
-			}
-		}
+	p, exists, err = e.store.Parent(name, word)
+	if err != nil || !exists {
+		return p, exists, err
 	}
 
-	return "", errors.New("internal error - code should not reach this point, most likely due to chain being defluffed or being empty  - getStartWord - " + path)
+	return e.decayParent(p, time.Now()), true, nil
 }
 
-func getEndWord(name string) (phrase string, err error) {
-	var path = "./markov-chains/" + name + ".json"
-	var sum int64
-
-	if s, exists := previousChainSums[name]; !exists {
-		calculatedSum, err := getSum(name)
-		if err != nil {
-			panic(err)
-		}
-		sum = calculatedSum
-	} else {
-		sum = s
-		go getSum(name)
-	}
-
-	r, err := randomNumber(0, sum)
+func (e *Engine) getStartWord(name string, s *sampler) (phrase string, err error) {
+	startParent, exists, err := e.getParent(name, e.instructions.StartKey)
 	if err != nil {
 		return "", err
 	}
-
-	f, err := os.Open(path)
-	if err != nil {
-		return "", err
+	if !exists || len(startParent.Children) == 0 {
+		return "", fmt.Errorf("%w: no beginnings, most likely due to chain being defluffed or being empty - getStartWord - %s", ErrEmptyChain, name)
 	}
-	defer f.Close()
 
-	dec := json.NewDecoder(f)
-	_, err = dec.Token()
+	return s.getNextWord(startParent), nil
+}
+
+func (e *Engine) getEndWord(name string, s *sampler) (phrase string, err error) {
+	endParent, exists, err := e.getParent(name, e.instructions.EndKey)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
-
-	for dec.More() {
-		var parent parent
-
-		err = dec.Decode(&parent)
-		if err != nil {
-			panic(err)
-		}
-
-		if parent.Word == instructions.EndKey {
-			for _, grandparent := range parent.Grandparents {
-				r -= int64(grandparent.Value)
-
-				if r < 0 {
-					return grandparent.Word, nil
-				}
-			}
-		}
+	if !exists || len(endParent.Grandparents) == 0 {
+		return "", fmt.Errorf("%w: no endings, most likely due to chain being defluffed or being empty - getEndWord - %s", ErrEmptyChain, name)
 	}
 
-	return "", errors.New("internal error - code should not reach this point, most likely due to chain being defluffed or being empty  - getEndWord - " + path)
+	return s.getPreviousWord(endParent), nil
 }
 
-func getNextWord(parent parent) (child string) {
+func (s *sampler) getNextWord(parent Parent) (child string) {
 	var wrS []Choice
 	for _, word := range parent.Children {
 		w := word.Word
@@ -620,12 +546,12 @@ func getNextWord(parent parent) (child string) {
 		}
 		wrS = append(wrS, item)
 	}
-	child, _ = weightedRandom(wrS)
+	child, _ = s.weightedRandom(wrS)
 
 	return child
 }
 
-func getPreviousWord(parent parent) (grandparent string) {
+func (s *sampler) getPreviousWord(parent Parent) (grandparent string) {
 	var wrS []Choice
 	for _, word := range parent.Grandparents {
 		w := word.Word
@@ -636,168 +562,49 @@ func getPreviousWord(parent parent) (grandparent string) {
 		}
 		wrS = append(wrS, item)
 	}
-	grandparent, _ = weightedRandom(wrS)
+	grandparent, _ = s.weightedRandom(wrS)
 
 	return grandparent
 }
 
-func getSum(name string) (sum int64, err error) {
-	var path = "./markov-chains/" + name + ".json"
-	f, err := os.Open(path)
-	if err != nil {
-		return sum, err
-	}
-	defer f.Close()
-	dec := json.NewDecoder(f)
-	_, err = dec.Token()
+// getRandomParent picks a parent weighted by how many children it has, without reading the chain file.
+func (e *Engine) getRandomParent(name string, s *sampler) (parentToReturn string, err error) {
+	ci, err := e.getIndex(name)
 	if err != nil {
-		return sum, errors.New("EOF (via getRandomParent) detected in " + path)
+		return "", err
 	}
 
-	var Parent parent
-	for dec.More() {
-		err = dec.Decode(&Parent)
-		if err != nil {
-			panic(err)
-		}
-
-		for _, child := range Parent.Children {
-			sum += int64(child.Value)
-		}
-
-		Parent = parent{}
+	// The start and end keys are not words, so they cannot be the middle of a message.
+	isWord := func(word string) bool {
+		return word != e.instructions.StartKey && word != e.instructions.EndKey
 	}
 
-	previousChainSums[name] = sum
-
-	return sum, err
-}
-
-func getRandomParent(name string) (parentToReturn string, err error) {
-	var path = "./markov-chains/" + name + ".json"
 	var sum int64
-
-	if s, exists := previousChainSums[name]; !exists {
-		calculatedSum, err := getSum(name)
-		if err != nil {
-			panic(err)
-		}
-		sum = calculatedSum
-	} else {
-		sum = s
-		go getSum(name)
-	}
-
-	r, err := randomNumber(0, sum)
-	if err != nil {
-		return
-	}
-
-	f, err := os.Open(path)
-	if err != nil {
-		return
-	}
-	defer f.Close()
-	dec := json.NewDecoder(f)
-	_, err = dec.Token()
-	if err != nil {
-		panic(err)
-	}
-	var Parent parent
-	for dec.More() {
-		err = dec.Decode(&Parent)
-		if err != nil {
-			panic(err)
+	for _, word := range ci.Order {
+		if isWord(word) {
+			sum += ci.Entries[word].ChildWeight
 		}
-
-		for _, child := range Parent.Children {
-			r -= int64(child.Value)
-
-			if r < 0 {
-				return Parent.Word, nil
-			}
-		}
-
-		Parent = parent{}
-	}
-
-	return parentToReturn, errors.New("internal error - code should not reach this point, most likely due to chain being defluffed or being empty - getRandomParent - " + path)
-}
-
-func randomMiddle(name string) (output string, err error) {
-	// Get a random parent
-	originalParentWord, err := getRandomParent(name)
-	if err != nil {
-		return
 	}
 
-	output = originalParentWord
-	parentWord := originalParentWord
-
-	var path = "./markov-chains/" + name + ".json"
-	var forwardComplete bool
-	var childChosen string
-	var grandparentChosen string
-
-goThroughBody:
-	f, err := os.Open(path)
-	if err != nil {
-		panic(err)
+	if sum <= 0 {
+		return "", fmt.Errorf("%w: no parents, most likely due to chain being defluffed or being empty - getRandomParent - %s", ErrEmptyChain, name)
 	}
-	defer f.Close()
 
-	dec := json.NewDecoder(f)
-	_, err = dec.Token()
+	r, err := s.number(sum)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
-	var currentParent parent
-	parentExists := false
-	for dec.More() {
-		err = dec.Decode(&currentParent)
-		if err != nil {
-			panic(err)
+	for _, word := range ci.Order {
+		if !isWord(word) {
+			continue
 		}
+		r -= ci.Entries[word].ChildWeight
 
-		if currentParent.Word == parentWord {
-			if !forwardComplete {
-				parentExists = true
-				childChosen = getNextWord(currentParent)
-
-				if childChosen == instructions.EndKey {
-					forwardComplete = true
-					parentWord = originalParentWord
-					goto goThroughBody
-				} else {
-					output = output + instructions.SeparationKey + childChosen
-
-					parentWord = childChosen
-					goto goThroughBody
-				}
-			}
-
-			if forwardComplete {
-				parentExists = true
-				grandparentChosen = getPreviousWord(currentParent)
-
-				if grandparentChosen == instructions.StartKey {
-					return output, nil
-				} else {
-					output = grandparentChosen + instructions.SeparationKey + output
-
-					parentWord = grandparentChosen
-					goto goThroughBody
-				}
-			}
+		if r < 0 {
+			return word, nil
 		}
-
-		currentParent = parent{}
-	}
-
-	if !parentExists {
-		return output, fmt.Errorf("parent %s does not exist in chain %s", parentWord, name)
 	}
 
-	return "", errors.New("internal error - code should not reach this point, most likely due to chain being defluffed or being empty  - randomMiddle - " + path)
+	return parentToReturn, fmt.Errorf("%w: no parents, most likely due to chain being defluffed or being empty - getRandomParent - %s", ErrEmptyChain, name)
 }
@@ -0,0 +1,57 @@
+package markov
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestOutMany(t *testing.T) {
+	e := newTestEngine(t, StartInstructions{Order: 1})
+	for _, message := range []string{"the cat sat on the mat", "the dog sat on the rug", "the cat ate the fish", "a bird ate the worm"} {
+		e.In("many", message)
+	}
+	e.In("one", "hello there friend")
+	if err := e.TempTriggerWrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		oi      OutputInstructions
+		n       int
+		want    int
+		wantErr error
+	}{
+		{"none asked for", OutputInstructions{Chain: "many", Method: "LikelyBeginning"}, 0, 0, nil},
+		{"all made", OutputInstructions{Chain: "many", Method: "LikelyBeginning", MaxAttempts: 20}, 6, 6, nil},
+		{"fewer can be made", OutputInstructions{Chain: "one", Method: "LikelyBeginning", MaxAttempts: 3}, 5, 1, nil},
+		{"none met the constraints", OutputInstructions{Chain: "many", Method: "LikelyBeginning", MaxAttempts: 3, Forbidden: []string{"the"}}, 2, 0, ErrRejected},
+		{"chain does not exist", OutputInstructions{Chain: "missing", Method: "LikelyBeginning"}, 2, 0, ErrChainNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := e.Stats().TotalOutputs
+
+			outputs, err := e.OutMany(tt.oi, tt.n)
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) || tt.wantErr == nil && err != nil {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if len(outputs) != tt.want {
+				t.Fatalf("got %d outputs %v, want %d", len(outputs), outputs, tt.want)
+			}
+
+			made := make(map[string]bool)
+			for _, output := range outputs {
+				if made[output] {
+					t.Errorf("%q was made twice", output)
+				}
+				made[output] = true
+			}
+
+			if outputs := e.Stats().TotalOutputs - before; outputs != tt.want {
+				t.Errorf("%d outputs were counted, want %d", outputs, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package markov
+
+import (
+	"fmt"
+	"strings"
+)
+
+// words splits a parent or an output into its words.
+func (e *Engine) words(s string) []string {
+	return strings.Split(s, e.instructions.SeparationKey)
+}
+
+// newWords returns the words a parent adds to the output when walking forward (or backward), the same as appendParent (or prependParent).
+func (e *Engine) newWords(info ChainInfo, parentWord string, forward bool) []string {
+	words := e.words(parentWord)
+	if info.Chunking != "sliding" {
+		return words
+	}
+
+	if forward {
+		return words[len(words)-1:]
+	}
+	return words[:1]
+}
+
+// matchPhraseForward finds where a phrase starts in words.
+// The phrase can run past the end of words, in which case remaining is what is left of it.
+// A phrase that fits in words is preferred over one that runs past the end.
+func matchPhraseForward(words []string, p phrase) (start int, remaining phrase, match bool) {
+	for i := range words {
+		n := min(len(words)-i, len(p))
+		if !p[:n].matches(words[i : i+n]) {
+			continue
+		}
+
+		if n == len(p) {
+			return i, nil, true
+		}
+		if !match {
+			start, remaining, match = i, p[n:], true
+		}
+	}
+
+	return start, remaining, match
+}
+
+// matchPhraseBackward finds where a phrase ends in words.
+// The phrase can start before the beginning of words, in which case remaining is what is left of it.
+// A phrase that fits in words is preferred over one that starts before the beginning.
+func matchPhraseBackward(words []string, p phrase) (end int, remaining phrase, match bool) {
+	for j := len(words); j > 0; j-- {
+		n := min(j, len(p))
+		if !p[len(p)-n:].matches(words[j-n : j]) {
+			continue
+		}
+
+		if n == len(p) {
+			return j, nil, true
+		}
+		if !match {
+			end, remaining, match = j, p[:len(p)-n], true
+		}
+	}
+
+	return end, remaining, match
+}
+
+// continuesForward returns whether adding newWords after the output keeps the remaining words of a phrase going,
+// and what is left of the phrase after them.
+func continuesForward(newWords []string, remaining phrase) (left phrase, continues bool) {
+	n := min(len(newWords), len(remaining))
+	if !remaining[:n].matches(newWords[:n]) {
+		return remaining, false
+	}
+
+	return remaining[n:], true
+}
+
+// continuesBackward returns whether adding newWords before the output keeps the remaining words of a phrase going,
+// and what is left of the phrase before them.
+func continuesBackward(newWords []string, remaining phrase) (left phrase, continues bool) {
+	n := min(len(newWords), len(remaining))
+	if !remaining[len(remaining)-n:].matches(newWords[len(newWords)-n:]) {
+		return remaining, false
+	}
+
+	return remaining[:len(remaining)-n], true
+}
+
+// walkForwardThrough appends children to the output like walkForward, but only children that continue the remaining words of a phrase,
+// and stops once the whole phrase is in the output. It returns the parent it stopped at.
+func (e *Engine) walkForwardThrough(oi OutputInstructions, info ChainInfo, s *sampler, parentWord, output string, remaining phrase) (string, string, error) {
+	name := oi.Chain
+
+	for len(remaining) > 0 {
+		currentParent, exists, err := e.getParent(name, parentWord)
+		if err != nil {
+			return parentWord, output, err
+		}
+		if !exists {
+			return parentWord, output, fmt.Errorf("%w: parent %s does not exist in chain %s", ErrDeadEnd, parentWord, name)
+		}
+
+		var choices []Choice
+		for _, child := range currentParent.Children {
+			if child.Word == e.instructions.EndKey {
+				continue
+			}
+
+			if _, continues := continuesForward(e.newWords(info, child.Word, true), remaining); continues {
+				choices = append(choices, Choice{
+					Word:   child.Word,
+					Weight: child.Value,
+				})
+			}
+		}
+
+		if len(choices) == 0 {
+			return parentWord, output, fmt.Errorf("%w: parent %s is never followed by the rest of %s in chain %s", ErrDeadEnd, parentWord, oi.Target, name)
+		}
+
+		childChosen, err := s.weightedRandom(choices)
+		if err != nil {
+			return parentWord, output, err
+		}
+
+		remaining, _ = continuesForward(e.newWords(info, childChosen, true), remaining)
+		output = e.appendParent(info, output, childChosen)
+		parentWord = childChosen
+
+		if err := e.acceptPartialOutput(oi, output); err != nil {
+			return parentWord, output, err
+		}
+	}
+
+	return parentWord, output, nil
+}
+
+// walkBackwardThrough prepends grandparents to the output like walkBackward, but only grandparents that continue the remaining words of a phrase,
+// and stops once the whole phrase is in the output. It returns the parent it stopped at.
+func (e *Engine) walkBackwardThrough(oi OutputInstructions, info ChainInfo, s *sampler, parentWord, output string, remaining phrase) (string, string, error) {
+	name := oi.Chain
+
+	for len(remaining) > 0 {
+		currentParent, exists, err := e.getParent(name, parentWord)
+		if err != nil {
+			return parentWord, output, err
+		}
+		if !exists {
+			return parentWord, output, fmt.Errorf("%w: parent %s does not exist in chain %s", ErrDeadEnd, parentWord, name)
+		}
+
+		var choices []Choice
+		for _, grandparent := range currentParent.Grandparents {
+			if grandparent.Word == e.instructions.StartKey {
+				continue
+			}
+
+			if _, continues := continuesBackward(e.newWords(info, grandparent.Word, false), remaining); continues {
+				choices = append(choices, Choice{
+					Word:   grandparent.Word,
+					Weight: grandparent.Value,
+				})
+			}
+		}
+
+		if len(choices) == 0 {
+			return parentWord, output, fmt.Errorf("%w: parent %s is never preceded by the rest of %s in chain %s", ErrDeadEnd, parentWord, oi.Target, name)
+		}
+
+		grandparentChosen, err := s.weightedRandom(choices)
+		if err != nil {
+			return parentWord, output, err
+		}
+
+		remaining, _ = continuesBackward(e.newWords(info, grandparentChosen, false), remaining)
+		output = e.prependParent(info, grandparentChosen, output)
+		parentWord = grandparentChosen
+
+		if err := e.acceptPartialOutput(oi, output); err != nil {
+			return parentWord, output, err
+		}
+	}
+
+	return parentWord, output, nil
+}
@@ -0,0 +1,204 @@
+package markov
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	mathrand "math/rand"
+	"sort"
+)
+
+// sampler picks words for a single output according to its Sampling.
+type sampler struct {
+	Sampling
+
+	// rng is only set when the sampling is seeded. Otherwise crypto/rand is used.
+	rng *mathrand.Rand
+}
+
+func newSampler(sm Sampling) (*sampler, error) {
+	switch {
+	case sm.Temperature < 0:
+		return nil, fmt.Errorf("%w: temperature cannot be negative", ErrInvalidSampling)
+	case sm.TopK < 0:
+		return nil, fmt.Errorf("%w: top-k cannot be negative", ErrInvalidSampling)
+	case sm.TopP < 0 || sm.TopP > 1:
+		return nil, fmt.Errorf("%w: top-p has to be between 0 and 1", ErrInvalidSampling)
+	}
+
+	s := &sampler{
+		Sampling: sm,
+	}
+	if sm.Seeded {
+		s.rng = mathrand.New(mathrand.NewSource(sm.Seed))
+	}
+
+	return s, nil
+}
+
+// number returns a random integer from 0 up to, but not including, max.
+func (s *sampler) number(max int64) (int64, error) {
+	if s.rng == nil {
+		return randomNumber(0, max)
+	}
+	if max <= 0 {
+		return 0, nil
+	}
+
+	return s.rng.Int63n(max), nil
+}
+
+// fraction returns a random number from 0 up to, but not including, 1.
+func (s *sampler) fraction() (float64, error) {
+	if s.rng != nil {
+		return s.rng.Float64(), nil
+	}
+
+	n, err := randomNumber(0, 1<<53)
+	if err != nil {
+		return 0, err
+	}
+
+	return float64(n) / (1 << 53), nil
+}
+
+// weightedRandom used weighted random selection to return one of the supplied
+// choices. Weights of 0 are never selected. All other weight values are
+// relative. E.g. if you have two choices both weighted 3, they will be
+// returned equally often; and each will be returned 3 times as often as a
+// choice weighted 1.
+// The choices are narrowed down and reweighted by the sampler's strategy first.
+func (s *sampler) weightedRandom(choices []Choice) (string, error) {
+	// Based on this algorithm:
+	// http://eli.thegreenplace.net/2010/01/22/weighted-random-generation-in-python/
+	if len(choices) == 0 {
+		return "", errors.New("no choices provided - weightedRandom")
+	}
+	if len(choices) == 1 {
+		return choices[0].Word, nil
+	}
+
+	if s.Greedy {
+		return mostLikely(choices), nil
+	}
+
+	choices = s.truncate(choices)
+
+	if s.Temperature != 0 && s.Temperature != 1 {
+		return s.weightedRandomWithTemperature(choices)
+	}
+
+	var sum int64
+	for _, c := range choices {
+		sum += int64(c.Weight)
+	}
+	r, err := s.number(sum)
+	if err != nil {
+		return "", err
+	}
+	for _, c := range choices {
+		r -= int64(c.Weight)
+		if r < 0 {
+			return c.Word, nil
+		}
+	}
+	return "", errors.New("internal error - code should not reach this point - weightedRandom")
+}
+
+// weightedRandomWithTemperature raises every weight to the power of 1/temperature before picking,
+// which makes likely choices more likely below a temperature of 1 and less likely above it.
+func (s *sampler) weightedRandomWithTemperature(choices []Choice) (string, error) {
+	weights := make([]float64, len(choices))
+	var sum float64
+	for i, c := range choices {
+		if c.Weight <= 0 {
+			continue
+		}
+
+		weights[i] = math.Pow(float64(c.Weight), 1/s.Temperature)
+		sum += weights[i]
+	}
+
+	// A very low temperature can push every weight out of range, which leaves only the most likely choice.
+	if sum == 0 || math.IsInf(sum, 0) || math.IsNaN(sum) {
+		return mostLikely(choices), nil
+	}
+
+	f, err := s.fraction()
+	if err != nil {
+		return "", err
+	}
+
+	r := f * sum
+	for i, c := range choices {
+		r -= weights[i]
+		if r < 0 && weights[i] > 0 {
+			return c.Word, nil
+		}
+	}
+
+	// Rounding can leave a little over at the end.
+	for i := len(choices) - 1; i >= 0; i-- {
+		if weights[i] > 0 {
+			return choices[i].Word, nil
+		}
+	}
+	return "", errors.New("internal error - code should not reach this point - weightedRandomWithTemperature")
+}
+
+// truncate keeps only the top-k choices and then only the most likely choices that make up top-p of the total weight.
+// The choices are returned in the order they were given.
+func (s *sampler) truncate(choices []Choice) []Choice {
+	topP := s.TopP > 0 && s.TopP < 1
+	if !topP && (s.TopK == 0 || s.TopK >= len(choices)) {
+		return choices
+	}
+
+	ranked := make([]int, len(choices))
+	for i := range ranked {
+		ranked[i] = i
+	}
+	sort.SliceStable(ranked, func(a, b int) bool {
+		return choices[ranked[a]].Weight > choices[ranked[b]].Weight
+	})
+
+	if s.TopK > 0 && s.TopK < len(ranked) {
+		ranked = ranked[:s.TopK]
+	}
+
+	if topP {
+		var total int64
+		for _, i := range ranked {
+			total += int64(choices[i].Weight)
+		}
+
+		var kept int64
+		for n, i := range ranked {
+			kept += int64(choices[i].Weight)
+			if float64(kept) >= s.TopP*float64(total) {
+				ranked = ranked[:n+1]
+				break
+			}
+		}
+	}
+
+	sort.Ints(ranked)
+	truncated := make([]Choice, 0, len(ranked))
+	for _, i := range ranked {
+		truncated = append(truncated, choices[i])
+	}
+
+	return truncated
+}
+
+// mostLikely returns the choice with the highest weight, the first one if several are tied.
+func mostLikely(choices []Choice) string {
+	best := choices[0]
+	for _, c := range choices[1:] {
+		if c.Weight > best.Weight {
+			best = c
+		}
+	}
+
+	return best.Word
+}
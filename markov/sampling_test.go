@@ -0,0 +1,134 @@
+package markov
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNewSampler(t *testing.T) {
+	tests := []struct {
+		name     string
+		sampling Sampling
+		wantErr  bool
+		seeded   bool
+	}{
+		{"blank", Sampling{}, false, false},
+		{"seed without seeded", Sampling{Seed: 7}, false, false},
+		{"seeded with 0", Sampling{Seeded: true}, false, true},
+		{"seeded", Sampling{Seed: 7, Seeded: true}, false, true},
+		{"negative temperature", Sampling{Temperature: -1}, true, false},
+		{"negative top-k", Sampling{TopK: -1}, true, false},
+		{"top-p above 1", Sampling{TopP: 1.5}, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newSampler(tt.sampling)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidSampling) {
+					t.Errorf("got %v, want ErrInvalidSampling", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if seeded := s.rng != nil; seeded != tt.seeded {
+				t.Errorf("seeded is %v, want %v", seeded, tt.seeded)
+			}
+		})
+	}
+}
+
+func TestWeightedRandom(t *testing.T) {
+	choices := []Choice{{5, "a"}, {3, "b"}, {1, "c"}, {1, "d"}}
+
+	tests := []struct {
+		name     string
+		sampling Sampling
+		want     map[string]bool
+	}{
+		{"every choice", Sampling{}, map[string]bool{"a": true, "b": true, "c": true, "d": true}},
+		{"greedy", Sampling{Greedy: true}, map[string]bool{"a": true}},
+		{"top-k", Sampling{TopK: 2}, map[string]bool{"a": true, "b": true}},
+		{"top-p", Sampling{TopP: 0.6}, map[string]bool{"a": true, "b": true}},
+		{"low temperature", Sampling{Temperature: 0.01}, map[string]bool{"a": true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.sampling.Seeded = true
+			s, err := newSampler(tt.sampling)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			picked := make(map[string]bool)
+			for i := 0; i < 2000; i++ {
+				word, err := s.weightedRandom(choices)
+				if err != nil {
+					t.Fatal(err)
+				}
+				picked[word] = true
+			}
+
+			for word := range picked {
+				if !tt.want[word] {
+					t.Errorf("picked %s", word)
+				}
+			}
+			if len(picked) != len(tt.want) {
+				t.Errorf("picked %v, want %v", picked, tt.want)
+			}
+		})
+	}
+}
+
+func TestSeededOutput(t *testing.T) {
+	e := newTestEngine(t, StartInstructions{Order: 1})
+	for _, message := range []string{"the cat sat on the mat", "the dog sat on the rug", "the cat ate the fish", "a cat sat"} {
+		e.In("c", message)
+	}
+	if err := e.TempTriggerWrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		seed   int64
+		method string
+		want   string
+	}{
+		{0, "LikelyBeginning", "the cat sat"},
+		{0, "LikelyEnding", "the rug"},
+		{7, "LikelyBeginning", "a cat sat on the dog sat"},
+		{7, "LikelyEnding", "a cat ate the dog sat on the cat sat"},
+		{42, "LikelyBeginning", "a cat sat on the fish"},
+		{42, "LikelyEnding", "a cat ate the cat sat"},
+	}
+
+	for _, tt := range tests {
+		// Every output with the same seed is the same, a seed of 0 included.
+		for i := 0; i < 3; i++ {
+			output, err := e.Out(OutputInstructions{Chain: "c", Method: tt.method, Sampling: Sampling{Seed: tt.seed, Seeded: true}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output != tt.want {
+				t.Errorf("seed %d, %s: got %q, want %q", tt.seed, tt.method, output, tt.want)
+			}
+		}
+	}
+
+	// Without Seeded, a seed of 0 is not a seed.
+	outputs := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		output, err := e.Out(OutputInstructions{Chain: "c", Method: "LikelyBeginning"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs[output] = true
+	}
+	if len(outputs) < 2 {
+		t.Errorf("unseeded outputs are all %v", outputs)
+	}
+}
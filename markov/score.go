@@ -0,0 +1,121 @@
+package markov
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// Score returns how likely a chain is to make the text, going from parent to parent the same way the text would be added to the chain.
+// Every step is smoothed, so a step the chain never recorded is unlikely instead of impossible.
+func (e *Engine) Score(chainName, text string) (score ChainScore, err error) {
+	if text == "" {
+		return score, ErrEmptyText
+	}
+
+	chainName = e.resolve(chainName)
+	workers, err := e.lockChains(chainName)
+	if err != nil {
+		return score, err
+	}
+	defer unlockWorkers(workers)
+
+	defer e.duration(track("score duration"))
+
+	score, err = e.score(chainName, text)
+	return score, e.handleChainError(chainName, err)
+}
+
+func (e *Engine) score(chainName, text string) (score ChainScore, err error) {
+	info, err := e.chainInfo(chainName)
+	if err != nil {
+		return score, err
+	}
+
+	// Every parent in the chain is a word that could come next.
+	count, err := e.countParents(chainName)
+	if err != nil {
+		return score, err
+	}
+	vocabulary := float64(count)
+	unit := float64(e.unitWeight())
+
+	score.Chain = chainName
+	parents := e.prepareContentForChainProcessing(text, info)
+	for i := 0; i < len(parents)-1; i++ {
+		step := ScoreStep{
+			Parent: parents[i],
+			Child:  parents[i+1],
+		}
+
+		p, exists, err := e.getParent(chainName, step.Parent)
+		if err != nil {
+			return score, err
+		}
+
+		var total, value int
+		if exists {
+			for _, c := range p.Children {
+				total += c.Value
+				if c.Word == step.Child {
+					value = c.Value
+				}
+			}
+		}
+
+		step.Recorded = value > 0
+		step.Probability = (float64(value) + unit) / (float64(total) + unit*vocabulary)
+
+		score.LogLikelihood += math.Log(step.Probability)
+		score.Steps = append(score.Steps, step)
+	}
+
+	score.Perplexity = math.Exp(-score.LogLikelihood / float64(len(score.Steps)))
+	return score, nil
+}
+
+// countParents returns how many parents a chain has. Scoring only needs the count, so the chain's index is only built
+// if neither it nor the store already has it, as Classify scores every chain.
+func (e *Engine) countParents(name string) (int, error) {
+	if ci, exists := e.cachedIndex(name); exists {
+		return len(ci.Entries), nil
+	}
+
+	if c, ok := e.store.(counter); ok {
+		if _, isBlend := e.blendOf(name); !isBlend {
+			return c.Count(name)
+		}
+	}
+
+	ci, err := e.getIndex(name)
+	if err != nil {
+		return 0, err
+	}
+	return len(ci.Entries), nil
+}
+
+// Classify scores the text against every chain and returns them from most to least likely to have made it, by perplexity.
+// Chains that are busy are left out.
+func (e *Engine) Classify(text string) (scores []ChainScore, err error) {
+	if text == "" {
+		return nil, ErrEmptyText
+	}
+
+	for _, chainName := range e.Chains() {
+		score, err := e.Score(chainName, text)
+		if errors.Is(err, ErrChainBusy) || errors.Is(err, ErrChainNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		scores = append(scores, score)
+	}
+
+	sort.SliceStable(scores, func(i, j int) bool {
+		return scores[i].Perplexity < scores[j].Perplexity
+	})
+
+	return scores, nil
+}
@@ -0,0 +1,96 @@
+package markov
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestScore(t *testing.T) {
+	e := newTestEngine(t, StartInstructions{Order: 1})
+	e.In("c", "a b")
+	if err := e.TempTriggerWrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The chain has 4 parents: the start key, a, b and the end key.
+	tests := []struct {
+		name       string
+		text       string
+		want       []float64
+		recorded   []bool
+		perplexity float64
+		err        error
+	}{
+		{"recorded", "a b", []float64{0.4, 0.4, 0.4}, []bool{true, true, true}, 2.5, nil},
+		{"unrecorded step", "a c", []float64{0.4, 0.2, 0.25}, []bool{true, false, false}, math.Pow(0.4*0.2*0.25, -1.0/3), nil},
+		{"empty", "", nil, nil, 0, ErrEmptyText},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, err := e.Score("c", tt.text)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+			if len(score.Steps) != len(tt.want) {
+				t.Fatalf("got %d steps, want %d", len(score.Steps), len(tt.want))
+			}
+			for i, step := range score.Steps {
+				if math.Abs(step.Probability-tt.want[i]) > 1e-9 || step.Recorded != tt.recorded[i] {
+					t.Errorf("step %d is %+v, want probability %v and recorded %v", i, step, tt.want[i], tt.recorded[i])
+				}
+			}
+			if math.Abs(score.Perplexity-tt.perplexity) > 1e-9 {
+				t.Errorf("perplexity is %v, want %v", score.Perplexity, tt.perplexity)
+			}
+		})
+	}
+
+	if _, err := e.Score("missing", "a b"); !errors.Is(err, ErrChainNotFound) {
+		t.Errorf("scoring a missing chain: got %v, want %v", err, ErrChainNotFound)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	for _, store := range testStores() {
+		t.Run(store.name, func(t *testing.T) {
+			e := newTestEngine(t, StartInstructions{Store: store.open(t), Order: 1})
+			for i := 0; i < 5; i++ {
+				e.In("cats", "the cat sat on the mat")
+				e.In("cats", "the cat ate the fish")
+				e.In("dogs", "my dog chased the ball")
+				e.In("dogs", "a dog barked at the mailman")
+			}
+			if err := e.TempTriggerWrite(); err != nil {
+				t.Fatal(err)
+			}
+
+			tests := []struct {
+				text string
+				want string
+			}{
+				{"the cat sat on the mat", "cats"},
+				{"the dog chased the ball", "dogs"},
+				{"a cat ate the fish", "cats"},
+			}
+
+			for _, tt := range tests {
+				scores, err := e.Classify(tt.text)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(scores) != 2 || scores[0].Chain != tt.want {
+					t.Errorf("%q is classified as %+v, want %s first", tt.text, scores, tt.want)
+				}
+			}
+
+			// Classifying only counts parents, so it builds no indexes.
+			for _, chain := range []string{"cats", "dogs"} {
+				if _, exists := e.cachedIndex(chain); exists {
+					t.Errorf("classifying built an index of %s", chain)
+				}
+			}
+		})
+	}
+}
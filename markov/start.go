@@ -1,49 +1,116 @@
 package markov
 
 import (
-	"sync"
+	"context"
+	"errors"
+	"io"
 	"time"
 )
 
 var (
-	instructions  StartInstructions
-	writeInterval = 10 * time.Minute
-	zipInterval   = 6 * time.Hour
-
-	busy         sync.Mutex
-	stats        Statistics
-	errorChannel chan error
+	zipInterval     = 6 * time.Hour
+	defluffInterval = 24 * time.Hour
 )
 
-// Start starts markov based on instructions pDuration
-func Start(sI StartInstructions) {
-	instructions = sI
-
-	createFolders()
-	loadStats()
-	loadChains()
-	go tickerLoops()
-}
-
-func TempTriggerWrite() {
-	writeLoop()
+func (e *Engine) TempTriggerWrite() error {
+	return e.writeLoop()
 }
 
-func tickerLoops() {
+func (e *Engine) tickerLoops() {
 	var writingTicker *time.Ticker
 	var zippingTicker *time.Ticker
+	var defluffingTicker *time.Ticker
 
-	writingTicker = writeTicker()
+	writingTicker = e.writeTicker()
+	defer writingTicker.Stop()
 
 	zippingTicker = time.NewTicker(zipInterval)
-	stats.NextZipTime = time.Now().Add(zipInterval)
+	defer zippingTicker.Stop()
+	if e.instructions.ShouldZip {
+		e.statsMx.Lock()
+		e.stats.NextZipTime = time.Now().Add(zipInterval)
+		e.statsMx.Unlock()
+	}
+
+	defluffingTicker = time.NewTicker(defluffInterval)
+	defer defluffingTicker.Stop()
+	if e.instructions.ShouldDefluff {
+		e.statsMx.Lock()
+		e.stats.NextDefluffTime = time.Now().Add(defluffInterval)
+		e.statsMx.Unlock()
+	}
 
 	for {
 		select {
 		case <-writingTicker.C:
-			//go writeLoop()
+			go func() {
+				if err := e.writeLoop(); err != nil {
+					e.reportError(err)
+				}
+			}()
 		case <-zippingTicker.C:
-			//go zipChains()
+			go func() {
+				if err := e.zipChains(); err != nil {
+					e.reportError(err)
+				}
+			}()
+		case <-defluffingTicker.C:
+			if !e.instructions.ShouldDefluff {
+				continue
+			}
+			go func() {
+				if _, err := e.Defluff(); err != nil {
+					e.reportError(err)
+				}
+			}()
+		case <-e.stopTickers:
+			return
+		}
+	}
+}
+
+// Shutdown stops the write, zip and defluff schedule, waits for any running cycle to finish, writes every worker that still has unwritten input and closes the store.
+// If the context is done before everything is written, the remaining workers are skipped and the context's error is returned.
+func (e *Engine) Shutdown(ctx context.Context) error {
+	e.stopTickersOnce.Do(func() {
+		close(e.stopTickers)
+	})
+
+	for !e.busy.TryLock() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
 		}
 	}
+	defer e.busy.Unlock()
+	defer e.duration(track("shutdown duration"))
+
+	var errs []error
+	for _, w := range e.workers() {
+		if err := ctx.Err(); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+
+		if err := w.writeChainHeader(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// The logs are closed once everything in them is written, and reopened by the next input if markov keeps running.
+	for _, w := range e.workers() {
+		if err := w.closeLog(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	e.saveStats()
+
+	if c, ok := e.store.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
 }
@@ -0,0 +1,24 @@
+package markov
+
+import (
+	"context"
+	"testing"
+)
+
+func TestShutdown(t *testing.T) {
+	e := newTestEngine(t, StartInstructions{Order: 1})
+	e.In("c", "hello there")
+
+	if err := e.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if p, exists, err := e.store.Parent("c", "hello"); err != nil || !exists || p.Children[0].Value != 1 {
+		t.Errorf("parent hello is %+v, %v, %v after shutting down, want it written", p, exists, err)
+	}
+
+	_, w := e.doesWorkerExist("c")
+	if w.Log != nil {
+		t.Error("log is still open after shutting down")
+	}
+}
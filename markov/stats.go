@@ -6,94 +6,125 @@ import (
 	"time"
 )
 
-func Stats() (statistics Statistics) {
-	stats.SessionUptime = time.Since(stats.SessionStartTime)
-	stats.TimeUntilWrite = time.Until(stats.NextWriteTime)
-	stats.TimeUntilZip = time.Until(stats.NextZipTime)
-	stats.TimeUntilDefluff = time.Until(stats.NextDefluffTime)
-	stats.Workers = len(CurrentWorkers())
-	return stats
+// Stats returns a copy of the engine's statistics.
+func (e *Engine) Stats() (statistics Statistics) {
+	workers := len(e.CurrentWorkers())
+
+	e.statsMx.Lock()
+	defer e.statsMx.Unlock()
+
+	e.stats.SessionUptime = time.Since(e.stats.SessionStartTime)
+	e.stats.TimeUntilWrite = time.Until(e.stats.NextWriteTime)
+	e.stats.TimeUntilZip = time.Until(e.stats.NextZipTime)
+	e.stats.TimeUntilDefluff = time.Until(e.stats.NextDefluffTime)
+	e.stats.Workers = workers
+
+	statistics = e.stats
+	statistics.Durations = append([]report(nil), e.stats.Durations...)
+	return statistics
 }
 
-func updateTotalUptime() {
-	for range time.Tick(1 * time.Second) {
-		stats.TotalUptime = stats.TotalUptime + (1 * time.Second)
+func (e *Engine) updateTotalUptime() {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			e.statsMx.Lock()
+			e.stats.TotalUptime = e.stats.TotalUptime + (1 * time.Second)
+			e.statsMx.Unlock()
+		case <-e.stopTickers:
+			return
+		}
 	}
 }
 
-func saveStats() {
-	Stats()
-
-	statsData, err := json.MarshalIndent(stats, "", " ")
+func (e *Engine) saveStats() {
+	statsData, err := json.MarshalIndent(e.Stats(), "", " ")
 	if err != nil {
-		debugLog(err)
+		e.debugLog(err)
 	}
 
-	f, err := os.OpenFile("./markov-chains/stats/stats.json", os.O_CREATE, 0666)
+	f, err := os.OpenFile(e.path("stats", "stats.json"), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
 	if err != nil {
-		debugLog(err)
+		e.debugLog(err)
+		return
 	}
 
 	_, err = f.Write(statsData)
 	defer f.Close()
 
 	if err != nil {
-		debugLog(err)
+		e.debugLog(err)
 	}
 }
 
-func loadStats() {
-	f, err := os.OpenFile("./markov-chains/stats/stats.json", os.O_CREATE, 0666)
+func (e *Engine) loadStats() {
+	e.statsMx.Lock()
+	defer e.statsMx.Unlock()
+
+	f, err := os.OpenFile(e.path("stats", "stats.json"), os.O_CREATE, 0666)
 	if err != nil {
-		debugLog("Failed reading stats:", err)
+		e.debugLog("Failed reading stats:", err)
+		e.stats.TotalStartTime = time.Now()
+		e.stats.SessionStartTime = time.Now()
+		return
 	}
 	defer f.Close()
 
-	fS, _ := f.Stat()
-	if fS.Size() == 0 {
-		stats.TotalStartTime = time.Now()
-		stats.SessionStartTime = time.Now()
+	fS, err := f.Stat()
+	if err != nil || fS.Size() == 0 {
+		e.stats.TotalStartTime = time.Now()
+		e.stats.SessionStartTime = time.Now()
 		return
 	}
 
-	err = json.NewDecoder(f).Decode(&stats)
+	err = json.NewDecoder(f).Decode(&e.stats)
 	if err != nil {
-		debugLog("Error when unmarshalling stats:", "\n", err)
+		e.debugLog("Error when unmarshalling stats:", "\n", err)
 	}
 
-	stats.SessionStartTime = time.Now()
-	stats.SessionInputs = 0
-	stats.SessionOutputs = 0
-	stats.Durations = nil
+	e.stats.SessionStartTime = time.Now()
+	e.stats.SessionInputs = 0
+	e.stats.SessionOutputs = 0
+	e.stats.Durations = nil
 
-	go updateTotalUptime()
+	go e.updateTotalUptime()
 }
 
 func track(process string) (string, time.Time) {
 	return process, time.Now()
 }
 
-func duration(process string, start time.Time) {
+func (e *Engine) duration(process string, start time.Time) {
 	duration := time.Since(start).Round(1 * time.Second)
-	//debugLog(process + ": " + duration.String())
+	//e.debugLog(process + ": " + duration.String())
+
+	e.statsMx.Lock()
+	defer e.statsMx.Unlock()
 
 	var exists bool
 
-	for _, d := range stats.Durations {
-		if d.ProcessName == process {
+	for i := range e.stats.Durations {
+		if e.stats.Durations[i].ProcessName == process {
 			exists = true
-			d.Duration = duration.String()
+			e.stats.Durations[i].Duration = duration.String()
 		}
 	}
 
 	if !exists {
-		stats.Durations = append(stats.Durations, report{
+		e.stats.Durations = append(e.stats.Durations, report{
 			ProcessName: process,
 			Duration:    duration.String(),
 		})
 	}
 }
 
-func ReportDurations() []report {
-	return stats.Durations
+// ReportDurations returns a copy of how long each process took the last time it ran.
+func (e *Engine) ReportDurations() []report {
+	e.statsMx.Lock()
+	defer e.statsMx.Unlock()
+
+	return append([]report(nil), e.stats.Durations...)
 }
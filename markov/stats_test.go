@@ -0,0 +1,45 @@
+package markov
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestStatsConcurrent(t *testing.T) {
+	e := newTestEngine(t, StartInstructions{Order: 1})
+	e.In("c", "hello there")
+	if err := e.TempTriggerWrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				e.In("c", "hello you")
+				e.Out(OutputInstructions{Chain: "c", Method: "LikelyBeginning"})
+				e.TempTriggerWrite()
+				e.Stats()
+				e.ReportDurations()
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats := e.Stats()
+	if stats.SessionInputs != 101 {
+		t.Errorf("session inputs are %d, want 101", stats.SessionInputs)
+	}
+
+	// What is returned is a copy, so changing it does not change the engine's statistics.
+	durations := e.ReportDurations()
+	if len(durations) == 0 {
+		t.Fatal("no durations were reported")
+	}
+	durations[0].Duration = "changed"
+	if e.ReportDurations()[0].Duration == "changed" {
+		t.Error("durations are not a copy")
+	}
+}
@@ -0,0 +1,196 @@
+package markov
+
+// ChainStore is where chains are kept between write cycles.
+//
+//	Parent: Returns a single parent of a chain and whether it exists.
+//	Info: Returns how a chain was built and whether the chain exists. Chains built before chain info existed return an empty ChainInfo.
+//	Merge: Adds the values of every parent in the batch to the chain, creating the chain and any parents that do not exist yet,
+//		and records info as how the chain was built.
+//		Children and grandparents that end up with a value of 0 or less are removed, as are parents that are left with neither.
+//		A merge is all or nothing, so a failed merge leaves the chain as it was.
+//	Iterate: Calls fn for every parent of a chain, stopping at the first error fn returns. fn cannot write to the store.
+//	Delete: Removes a chain.
+//	List: Returns the names of all chains.
+//
+// Parent and Iterate, and Count and Stat of stores that have them, return an error wrapping ErrChainNotFound for a chain that is not in the store.
+// Info returns that it does not exist instead, and Delete does nothing.
+type ChainStore interface {
+	Parent(chain, word string) (p Parent, exists bool, err error)
+	Info(chain string) (info ChainInfo, exists bool, err error)
+	Merge(chain string, info ChainInfo, batch []Parent) error
+	Iterate(chain string, fn func(p Parent) error) error
+	Delete(chain string) error
+	List() (chains []string, err error)
+}
+
+// quarantiner is implemented by stores that can set a chain that cannot be read aside. Chains of other stores are left as they are.
+type quarantiner interface {
+	Quarantine(chain string) (path string, err error)
+}
+
+// changeWatcher is implemented by stores that can tell what a merge changed, so that what is worked out from a chain can be kept up to date without reading it again.
+// MergeAndWatch merges like Merge and then, if the merge went through, calls changed for every parent it touched with the parent as it was and as it is now.
+// A parent that did not exist before, or does not anymore, is passed without children and grandparents.
+type changeWatcher interface {
+	MergeAndWatch(chain string, info ChainInfo, batch []Parent, changed func(old, updated Parent)) error
+}
+
+// counter is implemented by stores that can tell how many parents a chain has without reading the chain.
+type counter interface {
+	Count(chain string) (parents int, err error)
+}
+
+// recoverer is implemented by stores that have to clean up after an interrupted write when markov starts.
+type recoverer interface {
+	Recover() (notes []string, err error)
+}
+
+// mergeParent adds the values of update's children and grandparents to existing, keeping the latest time each was last seen.
+// keep is false if the merged parent is left without children and grandparents.
+func mergeParent(existing, update Parent) (merged Parent, keep bool) {
+	merged.Word = existing.Word
+
+	childValues := make(map[string]int, len(update.Children))
+	childSeen := make(map[string]int64, len(update.Children))
+	var newChildren []string
+	for _, c := range update.Children {
+		if _, exists := childValues[c.Word]; !exists {
+			newChildren = append(newChildren, c.Word)
+		}
+		childValues[c.Word] += c.Value
+		childSeen[c.Word] = max(childSeen[c.Word], c.LastSeen)
+	}
+
+	for _, c := range existing.Children {
+		value, exists := childValues[c.Word]
+		if exists {
+			c.Value += value
+			c.LastSeen = max(c.LastSeen, childSeen[c.Word])
+			delete(childValues, c.Word)
+		}
+		if c.Value > 0 {
+			merged.Children = append(merged.Children, c)
+		}
+	}
+
+	for _, word := range newChildren {
+		if value, exists := childValues[word]; exists && value > 0 {
+			merged.Children = append(merged.Children, Child{
+				Word:     word,
+				Value:    value,
+				LastSeen: childSeen[word],
+			})
+		}
+	}
+
+	grandparentValues := make(map[string]int, len(update.Grandparents))
+	grandparentSeen := make(map[string]int64, len(update.Grandparents))
+	var newGrandparents []string
+	for _, g := range update.Grandparents {
+		if _, exists := grandparentValues[g.Word]; !exists {
+			newGrandparents = append(newGrandparents, g.Word)
+		}
+		grandparentValues[g.Word] += g.Value
+		grandparentSeen[g.Word] = max(grandparentSeen[g.Word], g.LastSeen)
+	}
+
+	for _, g := range existing.Grandparents {
+		value, exists := grandparentValues[g.Word]
+		if exists {
+			g.Value += value
+			g.LastSeen = max(g.LastSeen, grandparentSeen[g.Word])
+			delete(grandparentValues, g.Word)
+		}
+		if g.Value > 0 {
+			merged.Grandparents = append(merged.Grandparents, g)
+		}
+	}
+
+	for _, word := range newGrandparents {
+		if value, exists := grandparentValues[word]; exists && value > 0 {
+			merged.Grandparents = append(merged.Grandparents, Grandparent{
+				Word:     word,
+				Value:    value,
+				LastSeen: grandparentSeen[word],
+			})
+		}
+	}
+
+	return merged, len(merged.Children) > 0 || len(merged.Grandparents) > 0
+}
+
+// parentDifference returns what has to be merged into old to turn it into updated.
+// Last seen times can only be moved forward by a merge, so an earlier one in updated is not a difference.
+// changed is false if they are the same.
+func parentDifference(old, updated Parent) (difference Parent, changed bool) {
+	difference.Word = old.Word
+
+	childValues := make(map[string]int, len(updated.Children))
+	childSeen := make(map[string]int64, len(updated.Children))
+	for _, c := range updated.Children {
+		childValues[c.Word] += c.Value
+		childSeen[c.Word] = max(childSeen[c.Word], c.LastSeen)
+	}
+	for _, c := range old.Children {
+		value := childValues[c.Word] - c.Value
+		seen := childSeen[c.Word]
+		if value != 0 || seen > c.LastSeen {
+			difference.Children = append(difference.Children, Child{
+				Word:     c.Word,
+				Value:    value,
+				LastSeen: seen,
+			})
+		}
+		delete(childValues, c.Word)
+	}
+	for _, c := range updated.Children {
+		if value, exists := childValues[c.Word]; exists && value != 0 {
+			difference.Children = append(difference.Children, Child{
+				Word:     c.Word,
+				Value:    value,
+				LastSeen: childSeen[c.Word],
+			})
+			delete(childValues, c.Word)
+		}
+	}
+
+	grandparentValues := make(map[string]int, len(updated.Grandparents))
+	grandparentSeen := make(map[string]int64, len(updated.Grandparents))
+	for _, g := range updated.Grandparents {
+		grandparentValues[g.Word] += g.Value
+		grandparentSeen[g.Word] = max(grandparentSeen[g.Word], g.LastSeen)
+	}
+	for _, g := range old.Grandparents {
+		value := grandparentValues[g.Word] - g.Value
+		seen := grandparentSeen[g.Word]
+		if value != 0 || seen > g.LastSeen {
+			difference.Grandparents = append(difference.Grandparents, Grandparent{
+				Word:     g.Word,
+				Value:    value,
+				LastSeen: seen,
+			})
+		}
+		delete(grandparentValues, g.Word)
+	}
+	for _, g := range updated.Grandparents {
+		if value, exists := grandparentValues[g.Word]; exists && value != 0 {
+			difference.Grandparents = append(difference.Grandparents, Grandparent{
+				Word:     g.Word,
+				Value:    value,
+				LastSeen: grandparentSeen[g.Word],
+			})
+			delete(grandparentValues, g.Word)
+		}
+	}
+
+	return difference, len(difference.Children) > 0 || len(difference.Grandparents) > 0
+}
+
+// copyParent returns a parent that does not share its children and grandparents with p.
+func copyParent(p Parent) Parent {
+	return Parent{
+		Word:         p.Word,
+		Children:     append([]Child(nil), p.Children...),
+		Grandparents: append([]Grandparent(nil), p.Grandparents...),
+	}
+}
@@ -0,0 +1,357 @@
+package markov
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// testStores returns a way to open an empty store of every kind.
+func testStores() []struct {
+	name string
+	open func(t *testing.T) ChainStore
+} {
+	return []struct {
+		name string
+		open func(t *testing.T) ChainStore
+	}{
+		{"json", func(t *testing.T) ChainStore {
+			s, err := NewJSONStore(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		}},
+		{"bolt", func(t *testing.T) ChainStore {
+			return openTestBoltStore(t, filepath.Join(t.TempDir(), "chains.db"))
+		}},
+		{"memory", func(t *testing.T) ChainStore {
+			return NewMemoryStore()
+		}},
+	}
+}
+
+// newTestEngine starts an engine in a temporary directory, filling in the keys if they are left blank, and shuts it down after the test.
+func newTestEngine(t *testing.T, sI StartInstructions) *Engine {
+	t.Helper()
+
+	if sI.Directory == "" {
+		sI.Directory = t.TempDir()
+	}
+	if sI.SeparationKey == "" {
+		sI.SeparationKey = " "
+	}
+	if sI.StartKey == "" {
+		sI.StartKey = "b5G(n1$I!4g"
+	}
+	if sI.EndKey == "" {
+		sI.EndKey = "e1$D(n7"
+	}
+
+	e, err := New(sI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { e.Shutdown(context.Background()) })
+
+	return e
+}
+
+func TestStoreMerge(t *testing.T) {
+	info := ChainInfo{Order: 2, Chunking: "sliding"}
+
+	tests := []struct {
+		name    string
+		batches [][]Parent
+		want    map[string]*Parent
+	}{
+		{
+			name: "new chain",
+			batches: [][]Parent{{
+				{Word: "a", Children: []Child{{Word: "b", Value: 1}}},
+				{Word: "b", Grandparents: []Grandparent{{Word: "a", Value: 1}}},
+			}},
+			want: map[string]*Parent{
+				"a": {Word: "a", Children: []Child{{Word: "b", Value: 1}}},
+				"b": {Word: "b", Grandparents: []Grandparent{{Word: "a", Value: 1}}},
+			},
+		},
+		{
+			name: "values add up",
+			batches: [][]Parent{
+				{{Word: "a", Children: []Child{{Word: "b", Value: 1}}}},
+				{{Word: "a", Children: []Child{{Word: "b", Value: 2}, {Word: "c", Value: 1}}}},
+			},
+			want: map[string]*Parent{
+				"a": {Word: "a", Children: []Child{{Word: "b", Value: 3}, {Word: "c", Value: 1}}},
+			},
+		},
+		{
+			name: "same parent twice in a batch",
+			batches: [][]Parent{{
+				{Word: "a", Children: []Child{{Word: "b", Value: 1}}},
+				{Word: "a", Children: []Child{{Word: "b", Value: 1}}},
+			}},
+			want: map[string]*Parent{
+				"a": {Word: "a", Children: []Child{{Word: "b", Value: 2}}},
+			},
+		},
+		{
+			name: "children at zero are removed",
+			batches: [][]Parent{
+				{{Word: "a", Children: []Child{{Word: "b", Value: 1}, {Word: "c", Value: 1}}}},
+				{{Word: "a", Children: []Child{{Word: "b", Value: -1}}}},
+			},
+			want: map[string]*Parent{
+				"a": {Word: "a", Children: []Child{{Word: "c", Value: 1}}},
+			},
+		},
+		{
+			name: "parents left empty are removed",
+			batches: [][]Parent{
+				{
+					{Word: "a", Children: []Child{{Word: "b", Value: 1}}},
+					{Word: "b", Grandparents: []Grandparent{{Word: "a", Value: 1}}},
+				},
+				{{Word: "a", Children: []Child{{Word: "b", Value: -1}}}},
+			},
+			want: map[string]*Parent{
+				"a": nil,
+				"b": {Word: "b", Grandparents: []Grandparent{{Word: "a", Value: 1}}},
+			},
+		},
+		{
+			name: "latest last seen is kept",
+			batches: [][]Parent{
+				{{Word: "a", Children: []Child{{Word: "b", Value: 1, LastSeen: 20}}}},
+				{{Word: "a", Children: []Child{{Word: "b", Value: 1, LastSeen: 10}}}},
+			},
+			want: map[string]*Parent{
+				"a": {Word: "a", Children: []Child{{Word: "b", Value: 2, LastSeen: 20}}},
+			},
+		},
+	}
+
+	for _, store := range testStores() {
+		for _, tt := range tests {
+			t.Run(store.name+"/"+tt.name, func(t *testing.T) {
+				s := store.open(t)
+				for _, batch := range tt.batches {
+					if err := s.Merge("c", info, batch); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				if got, exists, err := s.Info("c"); err != nil || !exists || got != info {
+					t.Errorf("info is %+v, %v, %v", got, exists, err)
+				}
+
+				for word, want := range tt.want {
+					got, exists, err := s.Parent("c", word)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if want == nil {
+						if exists {
+							t.Errorf("parent %s is %+v, want it removed", word, got)
+						}
+						continue
+					}
+					if !exists || !reflect.DeepEqual(got, *want) {
+						t.Errorf("parent %s is %+v, want %+v", word, got, *want)
+					}
+				}
+
+				iterated := make(map[string]Parent)
+				if err := s.Iterate("c", func(p Parent) error {
+					iterated[p.Word] = p
+					return nil
+				}); err != nil {
+					t.Fatal(err)
+				}
+				for word, want := range tt.want {
+					got, exists := iterated[word]
+					if exists != (want != nil) || (exists && !reflect.DeepEqual(got, *want)) {
+						t.Errorf("iterated parent %s is %+v, want %+v", word, got, want)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestStoreMergeAndWatch(t *testing.T) {
+	for _, store := range testStores() {
+		t.Run(store.name, func(t *testing.T) {
+			s := store.open(t)
+			if err := s.Merge("c", ChainInfo{}, []Parent{{Word: "a", Children: []Child{{Word: "b", Value: 1}}}}); err != nil {
+				t.Fatal(err)
+			}
+
+			w, ok := s.(changeWatcher)
+			if !ok {
+				t.Skip("store does not tell what a merge changed")
+			}
+
+			changes := make(map[string][2]Parent)
+			batch := []Parent{
+				{Word: "a", Children: []Child{{Word: "b", Value: 1}}},
+				{Word: "c", Children: []Child{{Word: "d", Value: 1}}},
+			}
+			if err := w.MergeAndWatch("c", ChainInfo{}, batch, func(old, updated Parent) {
+				changes[updated.Word] = [2]Parent{old, updated}
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			want := map[string][2]Parent{
+				"a": {{Word: "a", Children: []Child{{Word: "b", Value: 1}}}, {Word: "a", Children: []Child{{Word: "b", Value: 2}}}},
+				"c": {{Word: "c"}, {Word: "c", Children: []Child{{Word: "d", Value: 1}}}},
+			}
+			if !reflect.DeepEqual(changes, want) {
+				t.Errorf("changes are %+v, want %+v", changes, want)
+			}
+		})
+	}
+}
+
+func TestStoreDelete(t *testing.T) {
+	for _, store := range testStores() {
+		t.Run(store.name, func(t *testing.T) {
+			s := store.open(t)
+			for _, name := range []string{"b", "a"} {
+				if err := s.Merge(name, ChainInfo{}, []Parent{{Word: "x", Children: []Child{{Word: "y", Value: 1}}}}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			chains, err := s.List()
+			sort.Strings(chains)
+			if err != nil || !reflect.DeepEqual(chains, []string{"a", "b"}) {
+				t.Fatalf("chains are %v, %v", chains, err)
+			}
+
+			if err := s.Delete("a"); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Delete("missing"); err != nil {
+				t.Errorf("deleting a chain that does not exist: %v", err)
+			}
+
+			if chains, _ := s.List(); !reflect.DeepEqual(chains, []string{"b"}) {
+				t.Errorf("chains are %v after deleting a, want [b]", chains)
+			}
+			if _, exists, _ := s.Info("a"); exists {
+				t.Error("deleted chain still has info")
+			}
+		})
+	}
+}
+
+func TestStoreChainNotFound(t *testing.T) {
+	for _, store := range testStores() {
+		t.Run(store.name, func(t *testing.T) {
+			s := store.open(t)
+
+			if _, _, err := s.Parent("missing", "a"); !errors.Is(err, ErrChainNotFound) {
+				t.Errorf("parent: got %v, want ErrChainNotFound", err)
+			}
+			if err := s.Iterate("missing", func(Parent) error { return nil }); !errors.Is(err, ErrChainNotFound) {
+				t.Errorf("iterate: got %v, want ErrChainNotFound", err)
+			}
+			if c, ok := s.(counter); ok {
+				if _, err := c.Count("missing"); !errors.Is(err, ErrChainNotFound) {
+					t.Errorf("count: got %v, want ErrChainNotFound", err)
+				}
+			}
+			if c, ok := s.(sizer); ok {
+				if _, _, err := c.Stat("missing"); !errors.Is(err, ErrChainNotFound) {
+					t.Errorf("stat: got %v, want ErrChainNotFound", err)
+				}
+			}
+			if _, exists, err := s.Info("missing"); exists || err != nil {
+				t.Errorf("info: got %v, %v, want it not to exist", exists, err)
+			}
+		})
+	}
+}
+
+func TestStoreQuarantine(t *testing.T) {
+	for _, store := range testStores() {
+		t.Run(store.name, func(t *testing.T) {
+			s := store.open(t)
+			q, ok := s.(quarantiner)
+			if !ok {
+				t.Skip("store cannot quarantine chains")
+			}
+
+			for _, name := range []string{"c", "other"} {
+				if err := s.Merge(name, ChainInfo{}, []Parent{{Word: "x", Children: []Child{{Word: "y", Value: 1}}}}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			path, err := q.Quarantine("c")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if path == "" {
+				t.Error("quarantine did not say where the chain went")
+			}
+
+			if chains, _ := s.List(); !reflect.DeepEqual(chains, []string{"other"}) {
+				t.Errorf("chains are %v after quarantining c, want [other]", chains)
+			}
+			if _, exists, _ := s.Info("c"); exists {
+				t.Error("quarantined chain is still in the store")
+			}
+			if _, ok := s.(*MemoryStore); !ok {
+				if _, err := os.Stat(path); err != nil {
+					t.Errorf("quarantined chain is not at %s: %v", path, err)
+				}
+			}
+		})
+	}
+}
+
+func TestParentDifference(t *testing.T) {
+	old := Parent{
+		Word:         "a",
+		Children:     []Child{{Word: "b", Value: 2, LastSeen: 10}},
+		Grandparents: []Grandparent{{Word: "z", Value: 1, LastSeen: 10}},
+	}
+
+	tests := []struct {
+		name    string
+		updated Parent
+		changed bool
+	}{
+		{"same", old, false},
+		{"value changed", Parent{Word: "a", Children: []Child{{Word: "b", Value: 5, LastSeen: 10}}, Grandparents: old.Grandparents}, true},
+		{"child added", Parent{Word: "a", Children: []Child{{Word: "b", Value: 2, LastSeen: 10}, {Word: "c", Value: 1, LastSeen: 20}}, Grandparents: old.Grandparents}, true},
+		{"grandparent removed", Parent{Word: "a", Children: old.Children}, true},
+		{"seen later", Parent{Word: "a", Children: []Child{{Word: "b", Value: 2, LastSeen: 20}}, Grandparents: old.Grandparents}, true},
+		{"seen earlier", Parent{Word: "a", Children: []Child{{Word: "b", Value: 2, LastSeen: 5}}, Grandparents: old.Grandparents}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			difference, changed := parentDifference(old, tt.updated)
+			if changed != tt.changed {
+				t.Fatalf("changed is %v, want %v", changed, tt.changed)
+			}
+			if !changed {
+				return
+			}
+
+			// Merging the difference into old has to give updated.
+			if merged, _ := mergeParent(old, difference); !reflect.DeepEqual(merged, tt.updated) {
+				t.Errorf("old merged with %+v is %+v, want %+v", difference, merged, tt.updated)
+			}
+		})
+	}
+}
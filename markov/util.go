@@ -5,63 +5,75 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"log"
 	"math/big"
 	"os"
-	"strings"
+	"path/filepath"
 	"time"
 )
 
-func debugLog(v ...any) {
-	if instructions.Debug {
+func (e *Engine) debugLog(v ...any) {
+	if e.instructions.Debug {
 		log.Println(v...)
 	}
 }
 
-// loadChains gets a list of current chains found in the directory and deletes corrupted chains.
-func loadChains() {
-	files, err := os.ReadDir("./markov-chains/")
-	if err != nil {
-		panic(err)
+// reportError sends the error to the error channel if one was provided.
+func (e *Engine) reportError(err error) {
+	e.debugLog(err)
+	if e.errorChannel != nil {
+		go func() {
+			e.errorChannel <- err
+		}()
 	}
+}
 
-	for _, file := range files {
-		if file.Name() == "stats" {
-			continue
+// loadChains lets the store recover from an interrupted write and makes a worker for every chain in the store.
+func (e *Engine) loadChains() error {
+	if r, ok := e.store.(recoverer); ok {
+		notes, err := r.Recover()
+		for _, note := range notes {
+			e.reportError(errors.New(note))
 		}
-
-		if strings.Contains(file.Name(), "_new") {
-			err = os.Remove("./markov-chains/" + file.Name())
-			if err != nil {
-				panic(err)
-			}
-			continue
+		if err != nil {
+			return fmt.Errorf("recovering chains: %w", err)
 		}
-
-		newWorker(file.Name()[:len(file.Name())-5])
 	}
-}
 
-// Chains gets a list of current chains found in the directory.
-func Chains() (chains []string) {
-	files, err := os.ReadDir("./markov-chains/")
+	chains, err := e.store.List()
 	if err != nil {
-		return chains
+		return err
 	}
 
-	for _, file := range files {
-		if file.Name() == "stats" {
-			continue
-		}
+	for _, chain := range chains {
+		e.newWorker(chain)
+	}
+
+	return nil
+}
+
+// Chains gets a list of current chains found in the store.
+func (e *Engine) Chains() (chains []string) {
+	if e.store == nil {
+		return nil
+	}
 
-		chains = append(chains, file.Name()[:len(file.Name())-5])
+	chains, err := e.store.List()
+	if err != nil {
+		e.debugLog("Failed listing chains:", err)
 	}
 
 	return chains
 }
 
-func DoesChainFileExist(name string) (exists bool) {
-	for _, chain := range Chains() {
+func (e *Engine) DoesChainFileExist(name string) (exists bool) {
+	return e.chainExists(e.resolve(name))
+}
+
+// chainExists is DoesChainFileExist without following aliases.
+func (e *Engine) chainExists(name string) bool {
+	for _, chain := range e.Chains() {
 		if chain == name {
 			return true
 		}
@@ -70,10 +82,10 @@ func DoesChainFileExist(name string) (exists bool) {
 }
 
 // One use case is to simply see if the chain is in use while writing/outputting/etc to not have concurrency issues.
-func doesWorkerExist(name string) (exists bool, w *worker) {
-	workerMapMx.Lock()
-	defer workerMapMx.Unlock()
-	w, exists = workerMap[name]
+func (e *Engine) doesWorkerExist(name string) (exists bool, w *worker) {
+	e.workerMapMx.Lock()
+	defer e.workerMapMx.Unlock()
+	w, exists = e.workerMap[name]
 	return
 }
 
@@ -85,88 +97,44 @@ func PrettyPrint(v interface{}) {
 }
 
 // CurrentWorkers returns the names of all workers that have been made.
-func CurrentWorkers() []string {
-	workerMapMx.Lock()
+func (e *Engine) CurrentWorkers() []string {
+	e.workerMapMx.Lock()
 	var s []string
-	for chain := range workerMap {
+	for chain := range e.workerMap {
 		s = append(s, chain)
 	}
-	workerMapMx.Unlock()
+	e.workerMapMx.Unlock()
 	return s
 }
 
 // NextWriteTime returns what time the next write cycle will happen.
-func NextWriteTime() time.Time {
-	return stats.NextWriteTime
+func (e *Engine) NextWriteTime() time.Time {
+	e.statsMx.Lock()
+	defer e.statsMx.Unlock()
+
+	return e.stats.NextWriteTime
 }
 
 // PeakIntake returns the highest intake across all workers per session and at what time it happened.
-func PeakIntake() PeakIntakeStruct {
-	return stats.PeakChainIntake
-}
+func (e *Engine) PeakIntake() PeakIntakeStruct {
+	e.statsMx.Lock()
+	defer e.statsMx.Unlock()
 
-// weightedRandom used weighted random selection to return one of the supplied
-// choices. Weights of 0 are never selected. All other weight values are
-// relative. E.g. if you have two choices both weighted 3, they will be
-// returned equally often; and each will be returned 3 times as often as a
-// choice weighted 1.
-func weightedRandom(choices []Choice) (string, error) {
-	// Based on this algorithm:
-	// http://eli.thegreenplace.net/2010/01/22/weighted-random-generation-in-python/
-	if len(choices) == 0 {
-		return "", errors.New("no choices provided - weightedRandom")
-	}
-	if len(choices) == 1 {
-		return choices[0].Word, nil
-	}
-	var sum int64
-	for _, c := range choices {
-		sum += int64(c.Weight)
-	}
-	r, err := randomNumber(0, sum)
-	if err != nil {
-		return "", err
-	}
-	for _, c := range choices {
-		r -= int64(c.Weight)
-		if r < 0 {
-			return c.Word, nil
-		}
-	}
-	return "", errors.New("internal error - code should not reach this point - weightedRandom")
+	return e.stats.PeakChainIntake
 }
 
-func createFolders() {
-	_, err := os.Stat("./markov-chains")
-	if os.IsNotExist(err) {
-		err := os.MkdirAll("./markov-chains", 0755)
-		if err != nil {
-			panic(err)
-		}
-	}
-
-	_, err = os.Stat("./markov-chains/stats")
-	if os.IsNotExist(err) {
-		err := os.MkdirAll("./markov-chains/stats", 0755)
-		if err != nil {
-			panic(err)
+func (e *Engine) createFolders() error {
+	for _, folder := range []string{e.directory, e.path("stats"), e.path("logs"), e.path("fingerprints")} {
+		_, err := os.Stat(folder)
+		if os.IsNotExist(err) {
+			err := os.MkdirAll(folder, 0755)
+			if err != nil {
+				return err
+			}
 		}
 	}
-}
-
-func (p *parent) removeGrandparent(i int) {
-	p.Grandparents[i] = p.Grandparents[len(p.Grandparents)-1]
-	p.Grandparents = p.Grandparents[:len(p.Grandparents)-1]
-}
 
-func (p *parent) removeChild(i int) {
-	p.Children[i] = p.Children[len(p.Children)-1]
-	p.Children = p.Children[:len(p.Children)-1]
-}
-
-func (c *chain) removeParent(i int) {
-	c.Parents[i] = c.Parents[len(c.Parents)-1]
-	c.Parents = c.Parents[:len(c.Parents)-1]
+	return nil
 }
 
 // randomNumber returns a random integer in the range from min to max.
@@ -189,62 +157,87 @@ func randomNumber(min, max int64) (result int64, err error) {
 }
 
 func StartEncoder(enc *encode, file *os.File) (err error) {
-	if _, err = file.Write([]byte{'['}); err != nil {
+	enc.File = file
+	enc.Index = newChainIndex()
+
+	if _, err = enc.Write([]byte{'['}); err != nil {
 		return err
 	}
 
-	encoder := json.NewEncoder(file)
-
-	enc.Encoder = encoder
-	enc.File = file
+	enc.Encoder = json.NewEncoder(enc)
 
 	return nil
 }
 
+// Write writes to the encoder's file while keeping track of the offset and checksum, so that entries can be indexed and the file verified.
+func (enc *encode) Write(b []byte) (n int, err error) {
+	n, err = enc.File.Write(b)
+	enc.Offset += int64(n)
+	enc.Checksum = crc32.Update(enc.Checksum, crc32.IEEETable, b[:n])
+	return n, err
+}
+
 func (enc *encode) AddEntry(entry interface{}) (err error) {
 	if enc.ContinuedEntry {
-		if _, err = enc.File.Write([]byte{','}); err != nil {
+		if _, err = enc.Write([]byte{','}); err != nil {
 			return err
 		}
 	}
 
+	start := enc.Offset
 	if err := enc.Encoder.Encode(entry); err != nil {
 		return err
 	}
 
+	if p, ok := entry.(Parent); ok {
+		enc.Index.add(p, start, enc.Offset-start)
+	}
+
 	enc.ContinuedEntry = true
 
 	return nil
 }
 
+// CloseEncoder ends the chain and adds a footer after it with the length and checksum of everything before it.
 func (enc *encode) CloseEncoder() (err error) {
-	if _, err = enc.File.Write([]byte{']'}); err != nil {
-		panic(err)
+	if _, err = enc.Write([]byte{']', '\n'}); err != nil {
+		return err
 	}
 
-	return nil
+	enc.Index.Info = enc.Info
+	footerData, err := json.Marshal(footer{
+		Length:    enc.Offset,
+		Checksum:  enc.Checksum,
+		ChainInfo: enc.Info,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = enc.File.Write(append(footerData, '\n'))
+	return err
 }
 
-// IsMarkovBusy returns false if not writing, zipping, or defluffing. Returns true otherwise.
-func IsMarkovBusy() bool {
-	if !busy.TryLock() {
+// IsBusy returns false if not writing, zipping, or defluffing. Returns true otherwise.
+func (e *Engine) IsBusy() bool {
+	if !e.busy.TryLock() {
 		return true
 	}
-	busy.Unlock()
+	e.busy.Unlock()
 
 	return false
 }
 
-func ChainIntake(chain string) int {
-	exists, w := doesWorkerExist(chain)
+func (e *Engine) ChainIntake(chain string) int {
+	exists, w := e.doesWorkerExist(e.resolve(chain))
 	if !exists {
 		return -1
 	}
 	return w.Intake
 }
 
-func IsChainBusy(chain string) bool {
-	exists, w := doesWorkerExist(chain)
+func (e *Engine) IsChainBusy(chain string) bool {
+	exists, w := e.doesWorkerExist(e.resolve(chain))
 	if !exists {
 		return false
 	}
@@ -258,36 +251,23 @@ func IsChainBusy(chain string) bool {
 	return false
 }
 
-func removeAndRename(defaultPath, newPath string) {
-	err := os.Remove(defaultPath)
-	if err != nil {
-		panic(err)
-	}
-
-	err = os.Rename(newPath, defaultPath)
-	if err != nil {
-		panic(err)
-	}
-}
-
-// compareSizes will compare the size of an old write file and a new write file and return an error if old is bigger than new. lol
-func compareSizes(old, new *os.File) error {
-	oldStats, err := old.Stat()
+// removeAndRename replaces the file at defaultPath with the file at newPath.
+// The rename is atomic, so at any point either the old or the new file is found at defaultPath.
+func removeAndRename(defaultPath, newPath string) error {
+	err := os.Rename(newPath, defaultPath)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	newStats, err := new.Stat()
+	// Make sure the rename itself is on disk
+	dir, err := os.Open(filepath.Dir(defaultPath))
 	if err != nil {
-		panic(err)
+		return err
 	}
+	defer dir.Close()
 
-	oldSize := oldStats.Size()
-	newSize := newStats.Size()
-
-	if newSize < oldSize {
-		return errors.New("Old file size is bigger than the new file size!\n" + old.Name() + ": " + ByteCountSI(oldSize) + "\n" + new.Name() + ": " + ByteCountSI(newSize))
-	}
+	// Not every platform can sync a directory, which does not make the rename itself fail.
+	dir.Sync()
 
 	return nil
 }
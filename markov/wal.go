@@ -0,0 +1,181 @@
+package markov
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// logPath returns where a chain's log is kept. Every input is appended to its chain's log before it is added to the worker,
+// so that input which has not been written into the chain file yet survives a crash.
+// The log is replayed when markov starts and emptied after every successful write.
+func (e *Engine) logPath(name string) string {
+	return e.path("logs", name+".log")
+}
+
+// logRecord is a line of a chain's log. Arrived is when the input arrived, in Unix seconds, so replayed input is seen at the time it arrived.
+// Logs written before records existed have the content on its own, which is read as having arrived when it is replayed.
+type logRecord struct {
+	Content string
+	Arrived int64
+}
+
+// appendToLog appends the record to the worker's log, opening the log if needed. It has to be called while holding ChainMx.
+// The returned number has to be passed to syncLog once ChainMx is released, so the input is on disk once In returns.
+func (w *worker) appendToLog(record logRecord) (uint64, error) {
+	if w.Log == nil {
+		f, err := os.OpenFile(w.engine.logPath(w.Name), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+		if err != nil {
+			return 0, err
+		}
+		w.LogMx.Lock()
+		w.Log = f
+		w.LogMx.Unlock()
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err = w.Log.Write(append(line, '\n')); err != nil {
+		return 0, err
+	}
+
+	return w.logWritten.Add(1), nil
+}
+
+// syncLog syncs the log unless the input numbered logged was already synced by another input's sync.
+// Inputs keep being logged while a sync runs, and are all synced by the sync after it.
+func (w *worker) syncLog(logged uint64) error {
+	w.LogMx.Lock()
+	defer w.LogMx.Unlock()
+
+	if w.logSynced >= logged || w.Log == nil {
+		return nil
+	}
+
+	written := w.logWritten.Load()
+	if err := w.Log.Sync(); err != nil {
+		return err
+	}
+	w.logSynced = written
+
+	return nil
+}
+
+// closeLog syncs and closes the worker's log if it is open.
+func (w *worker) closeLog() error {
+	w.ChainMx.Lock()
+	defer w.ChainMx.Unlock()
+	w.LogMx.Lock()
+	defer w.LogMx.Unlock()
+
+	if w.Log == nil {
+		return nil
+	}
+
+	err := errors.Join(w.Log.Sync(), w.Log.Close())
+	w.Log = nil
+	w.logSynced = w.logWritten.Load()
+	return err
+}
+
+// truncateLog empties the worker's log once everything in it has been written into the chain file.
+func (w *worker) truncateLog() error {
+	err := os.Truncate(w.engine.logPath(w.Name), 0)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// replayLogs adds every input left over in the logs back into its worker.
+func (e *Engine) replayLogs() error {
+	files, err := os.ReadDir(e.path("logs"))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".log") {
+			continue
+		}
+
+		name := strings.TrimSuffix(file.Name(), ".log")
+
+		w := e.getOrCreateWorker(name)
+
+		w.ChainMx.Lock()
+		replayed, err := w.replayLog()
+		w.ChainMx.Unlock()
+
+		// A log that cannot be read to the end is set aside, so the rest of it is not emptied by the next write.
+		if err != nil {
+			err = fmt.Errorf("replaying log for %s: %w", name, err)
+			path, qErr := e.quarantineFile(e.logPath(name))
+			if qErr != nil {
+				return errors.Join(err, qErr)
+			}
+			e.reportError(fmt.Errorf("%w, quarantined it to %s", err, path))
+		}
+
+		if replayed > 0 {
+			e.debugLog("Replayed", replayed, "inputs for", name)
+		}
+	}
+
+	return nil
+}
+
+func (w *worker) replayLog() (replayed int, err error) {
+	err = w.engine.readLog(w.Name, func(record logRecord) {
+		w.addInput(record.Content, record.Arrived)
+		replayed++
+	})
+
+	return replayed, err
+}
+
+func (e *Engine) readLog(name string, fn func(record logRecord)) error {
+	f, err := os.Open(e.logPath(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Lines are read whole however long they are, so only failing to read the file stops the replay.
+	reader := bufio.NewReader(f)
+	replayed := time.Now().Unix()
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		var record logRecord
+
+		// A line that cannot be read was cut off by the crash and is skipped.
+		if jsonErr := json.Unmarshal(line, &record); jsonErr != nil {
+			if jsonErr := json.Unmarshal(line, &record.Content); jsonErr != nil {
+				record.Content = ""
+			}
+			record.Arrived = replayed
+		}
+		if record.Content != "" {
+			fn(record)
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
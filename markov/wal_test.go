@@ -0,0 +1,89 @@
+package markov
+
+import (
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestReplayLogs(t *testing.T) {
+	tests := []struct {
+		name string
+		tail string
+	}{
+		{"unwritten inputs", ""},
+		{"input cut off by the crash", `"hello th`},
+		{"empty line", "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			// The first engine crashes before its inputs are written into the chain.
+			crashed := newTestEngine(t, StartInstructions{Directory: dir, Order: 1})
+			for i := 0; i < 2; i++ {
+				if err := crashed.In("c", "hello there"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			f, err := os.OpenFile(crashed.logPath("c"), os.O_APPEND|os.O_WRONLY, 0666)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.WriteString(tt.tail)
+			f.Close()
+
+			e := newTestEngine(t, StartInstructions{Directory: dir, Order: 1})
+			exists, w := e.doesWorkerExist("c")
+			if !exists || w.Intake != 2 {
+				t.Fatalf("worker exists %v with intake %d after replaying, want 2", exists, w.Intake)
+			}
+
+			if err := e.TempTriggerWrite(); err != nil {
+				t.Fatal(err)
+			}
+			p, exists, err := e.store.Parent("c", "hello")
+			if err != nil || !exists || p.Children[0].Value != 2 {
+				t.Errorf("parent hello is %+v, %v, %v", p, exists, err)
+			}
+
+			// Once written, the inputs are not replayed again.
+			e = newTestEngine(t, StartInstructions{Directory: dir, Order: 1})
+			if _, w := e.doesWorkerExist("c"); w.Intake != 0 {
+				t.Errorf("intake is %d after restarting, want the written inputs left out", w.Intake)
+			}
+		})
+	}
+}
+
+func TestLogConcurrentInputs(t *testing.T) {
+	dir := t.TempDir()
+	crashed := newTestEngine(t, StartInstructions{Directory: dir, Order: 1})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				if err := crashed.In("c", "hello there"); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	_, w := crashed.doesWorkerExist("c")
+	if synced, written := w.logSynced, w.logWritten.Load(); synced != written {
+		t.Errorf("%d of %d logged inputs were synced", synced, written)
+	}
+
+	// Every input is replayed, however the syncs were grouped.
+	e := newTestEngine(t, StartInstructions{Directory: dir, Order: 1})
+	if _, w := e.doesWorkerExist("c"); w.Intake != 200 {
+		t.Errorf("intake is %d after replaying, want 200", w.Intake)
+	}
+}
@@ -1,37 +1,75 @@
 package markov
 
-import (
-	"sync"
-)
+import "fmt"
 
-var (
-	workerMap   = make(map[string]*worker)
-	workerMapMx sync.Mutex
-)
+// getOrCreateWorker returns the chain's worker, making one if it does not exist yet.
+func (e *Engine) getOrCreateWorker(name string) *worker {
+	if exists, w := e.doesWorkerExist(name); exists {
+		return w
+	}
+
+	return e.newWorker(name)
+}
 
-func newWorker(name string) *worker {
+// newWorker makes a worker for the chain. If another worker was made for the chain in the meantime, that one is returned instead,
+// so that a chain never has two workers.
+func (e *Engine) newWorker(name string) *worker {
 	w := worker{
-		Name:  name,
-		Chain: chain{},
+		Name:   name,
+		Chain:  chain{},
+		Info:   e.newChainInfo(),
+		engine: e,
+	}
+
+	// An existing chain keeps being built the way it was started.
+	if e.store != nil {
+		info, exists, err := e.store.Info(name)
+		if err != nil {
+			e.debugLog("Failed reading chain info for", name, err)
+		}
+		if exists {
+			w.Info = info.withDefaults()
+		}
 	}
 
-	workerMapMx.Lock()
-	workerMap[name] = &w
-	workerMapMx.Unlock()
+	fingerprints, err := e.loadFingerprints(name)
+	if err != nil {
+		e.reportError(fmt.Errorf("reading fingerprints of chain %s, starting new ones: %w", name, err))
+	}
+	w.Fingerprints = fingerprints
+
+	e.workerMapMx.Lock()
+	defer e.workerMapMx.Unlock()
+
+	if existing, exists := e.workerMap[name]; exists {
+		return existing
+	}
+	e.workerMap[name] = &w
 
 	return &w
 }
 
+// workers returns every worker there is right now.
+func (e *Engine) workers() (workers []*worker) {
+	e.workerMapMx.Lock()
+	defer e.workerMapMx.Unlock()
+
+	for _, w := range e.workerMap {
+		workers = append(workers, w)
+	}
+	return workers
+}
+
 // WorkersStats returns a slice of type WorkerStats.
-func WorkersStats() (slice []WorkerStats) {
-	workerMapMx.Lock()
-	for _, w := range workerMap {
-		e := WorkerStats{
+func (e *Engine) WorkersStats() (slice []WorkerStats) {
+	e.workerMapMx.Lock()
+	for _, w := range e.workerMap {
+		ws := WorkerStats{
 			ChainResponsibleFor: w.Name,
 			Intake:              w.Intake,
 		}
-		slice = append(slice, e)
+		slice = append(slice, ws)
 	}
-	workerMapMx.Unlock()
+	e.workerMapMx.Unlock()
 	return slice
 }
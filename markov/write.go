@@ -1,23 +1,19 @@
 package markov
 
 import (
-	"encoding/json"
-	"os"
-	"sync"
+	"errors"
+	"fmt"
 	"time"
 )
 
-var (
-	unit time.Duration
-)
-
-func writeTicker() *time.Ticker {
-	if instructions.WriteInterval == 0 && instructions.IntervalUnit == "" {
-		stats.NextWriteTime = time.Now().Add(writeInterval)
-		return time.NewTicker(writeInterval)
+func (e *Engine) writeTicker() *time.Ticker {
+	if e.instructions.WriteInterval <= 0 {
+		e.setNextWriteTime()
+		return time.NewTicker(e.writeInterval)
 	}
 
-	switch instructions.IntervalUnit {
+	var unit time.Duration
+	switch e.instructions.IntervalUnit {
 	default:
 		unit = time.Minute
 	case "seconds":
@@ -28,222 +24,106 @@ func writeTicker() *time.Ticker {
 		unit = time.Hour
 	}
 
-	writeInterval = time.Duration(instructions.WriteInterval) * unit
-	stats.NextWriteTime = time.Now().Add(writeInterval)
-	return time.NewTicker(writeInterval)
+	e.writeInterval = time.Duration(e.instructions.WriteInterval) * unit
+	e.setNextWriteTime()
+	return time.NewTicker(e.writeInterval)
 }
 
-func writeLoop() {
-	if !busy.TryLock() {
-		return
-	}
-	defer busy.Unlock()
-	defer duration(track("writing duration"))
-
-	var wg sync.WaitGroup
-	workerMapMx.Lock()
-	for _, w := range workerMap {
-		wg.Add(1)
-		w.writeChainHeader(&wg)
-	}
-	workerMapMx.Unlock()
-	wg.Wait()
-
-	saveStats()
-	stats.NextWriteTime = time.Now().Add(writeInterval)
+func (e *Engine) setNextWriteTime() {
+	e.statsMx.Lock()
+	e.stats.NextWriteTime = time.Now().Add(e.writeInterval)
+	e.statsMx.Unlock()
 }
 
-func (w *worker) writeChainHeader(wg *sync.WaitGroup) {
-	defer wg.Done()
-
-	if len(w.Chain.Parents) == 0 {
-		return
+func (e *Engine) writeLoop() (err error) {
+	if !e.busy.TryLock() {
+		return nil
 	}
+	defer e.busy.Unlock()
+	defer e.duration(track("writing duration"))
 
-	w.ChainMx.Lock()
-
-	// Find new peak intake chain
-	if w.Intake > stats.PeakChainIntake.Amount {
-		stats.PeakChainIntake.Chain = w.Name
-		stats.PeakChainIntake.Amount = w.Intake
-		stats.PeakChainIntake.Time = time.Now()
+	// The workers are written without holding the worker map, as outputs hold a worker while looking up others.
+	var errs []error
+	for _, w := range e.workers() {
+		if err := w.writeChainHeader(); err != nil {
+			errs = append(errs, err)
+		}
 	}
 
-	w.writeBody()
+	e.saveStats()
+	e.setNextWriteTime()
 
-	w.Chain.Parents = nil
-	w.Intake = 0
-
-	w.ChainMx.Unlock()
+	return errors.Join(errs...)
 }
 
-func (w *worker) writeBody() {
-	defaultPath := "./markov-chains/" + w.Name + ".json"
-	newPath := "./markov-chains/" + w.Name + "_new.json"
-
-	// Open existing chain file
-	f, err := os.Open(defaultPath)
+func (w *worker) writeChainHeader() error {
+	w.ChainMx.Lock()
+	defer w.ChainMx.Unlock()
 
-	// If chain file does not exist, create it and write the data to it.
-	if err != nil {
-		f, err = os.Create(defaultPath)
-		if err != nil {
-			panic(err)
-		}
-		chainData, _ := json.Marshal(w.Chain.Parents)
-		_, err = f.Write(chainData)
-		if err != nil {
-			panic(err)
-		}
-		f.Close()
-		return
+	if w.Chain.Len() == 0 {
+		return nil
 	}
 
-	// Start a new decoder
-	dec := json.NewDecoder(f)
+	e := w.engine
 
-	// Get beginning token
-	_, err = dec.Token()
-	if err != nil {
-		panic(err)
+	// Find new peak intake chain
+	e.statsMx.Lock()
+	if w.Intake > e.stats.PeakChainIntake.Amount {
+		e.stats.PeakChainIntake.Chain = w.Name
+		e.stats.PeakChainIntake.Amount = w.Intake
+		e.stats.PeakChainIntake.Time = time.Now()
 	}
+	e.statsMx.Unlock()
 
-	// Create a new chain file
-	fN, err := os.Create(newPath)
+	err := e.mergeIntoStore(w.Name, w.Info, w.Chain.Parents())
 	if err != nil {
-		panic(err)
+		// A chain that cannot be read is moved out of the way, so the next cycle starts a new one.
+		// The worker keeps its chain and tries again next cycle.
+		return e.handleChainError(w.Name, fmt.Errorf("writing chain %s: %w", w.Name, err))
 	}
 
-	// Start the new file encoder
-	var enc encode
-	if err = StartEncoder(&enc, fN); err != nil {
-		panic(err)
+	// Fingerprints are written before the log is truncated, so a crash in between only adds the logged messages to them again.
+	if err := w.saveFingerprints(); err != nil {
+		e.debugLog("Failed writing fingerprints for", w.Name, err)
 	}
 
-	// For every new item in the existing chain
-	for dec.More() {
-		var existingParent parent
-
-		err = dec.Decode(&existingParent)
-		if err != nil {
-			panic(err)
-		}
-
-		parentMatch := false
-		// Find newParent in existingParents
-		for nPIndex, newParent := range w.Chain.Parents {
-
-			if newParent.Word == existingParent.Word {
-				parentMatch = true
-
-				uParent := parent{
-					Word: newParent.Word,
-				}
-
-				// Do for every parent except end key
-				if newParent.Word != instructions.EndKey {
-					// Do for child
-					// combine values and set into updatedChain
-					for _, existingChild := range existingParent.Children {
-						childMatch := false
-
-						for nCIndex, newChild := range newParent.Children {
-
-							if newChild.Word == existingChild.Word {
-								childMatch = true
-
-								uParent.Children = append(uParent.Children, child{
-									Word:  newChild.Word,
-									Value: newChild.Value + existingChild.Value,
-								})
-
-								newParent.removeChild(nCIndex)
-								break
-							}
-						}
-
-						if !childMatch {
-							uParent.Children = append(uParent.Children, existingChild)
-						}
-					}
-
-					uParent.Children = append(uParent.Children, newParent.Children...)
-				}
-
-				// Do for every parent except start key
-				if newParent.Word != instructions.StartKey {
-					// Do for grandparent
-					// combine values and set into updatedChain
-					for _, existingGrandparent := range existingParent.Grandparents {
-						grandparentMatch := false
-
-						for nPIndex, newGrandparent := range newParent.Grandparents {
-
-							if newGrandparent.Word == existingGrandparent.Word {
-								grandparentMatch = true
-
-								uParent.Grandparents = append(uParent.Grandparents, grandparent{
-									Word:  newGrandparent.Word,
-									Value: newGrandparent.Value + existingGrandparent.Value,
-								})
-
-								newParent.removeGrandparent(nPIndex)
-								break
-							}
-						}
-
-						if !grandparentMatch {
-							uParent.Grandparents = append(uParent.Grandparents, existingGrandparent)
-						}
-					}
-
-					uParent.Grandparents = append(uParent.Grandparents, newParent.Grandparents...)
-				}
+	if err := w.truncateLog(); err != nil {
+		e.debugLog("Failed truncating log for", w.Name, err)
+	}
 
-				if err := enc.AddEntry(uParent); err != nil {
-					panic(err)
-				}
+	w.Chain = chain{}
+	w.Intake = 0
 
-				w.Chain.removeParent(nPIndex)
-				break
-			}
-		}
+	return nil
+}
 
-		if !parentMatch {
-			if err := enc.AddEntry(existingParent); err != nil {
-				panic(err)
-			}
-		}
+// rewriteChain passes every parent of a chain through fn and merges the difference between the parents fn returns and the chain into the store.
+// Parents that fn does not keep are removed.
+func (e *Engine) rewriteChain(name string, fn func(p Parent) (updated Parent, keep bool)) error {
+	info, err := e.chainInfo(name)
+	if err != nil {
+		return err
 	}
 
-	// Add every new parent that is left over
-	for _, nParent := range w.Chain.Parents {
-		if err := enc.AddEntry(nParent); err != nil {
-			panic(err)
+	var batch []Parent
+	err = e.store.Iterate(name, func(existingParent Parent) error {
+		updatedParent, keep := fn(existingParent)
+		if !keep {
+			updatedParent = Parent{Word: existingParent.Word}
 		}
-	}
 
-	// Close the new file encoder
-	if err := enc.CloseEncoder(); err != nil {
-		panic(err)
-	}
-
-	// Verify if new file size is larger than old file size
-	err = compareSizes(f, fN)
-	if err != nil && errorChannel != nil {
-		errorChannel <- err
-	}
-
-	err = f.Close()
+		if difference, changed := parentDifference(existingParent, updatedParent); changed {
+			batch = append(batch, difference)
+		}
+		return nil
+	})
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	err = fN.Close()
-	if err != nil {
-		panic(err)
+	if len(batch) == 0 {
+		return nil
 	}
 
-	// Remove the old file and rename the new file with the old file name
-	removeAndRename(defaultPath, newPath)
+	return e.mergeIntoStore(name, info, batch)
 }
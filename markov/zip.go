@@ -2,84 +2,104 @@ package markov
 
 import (
 	"archive/zip"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 )
 
-func zipChains() {
-	if !instructions.ShouldZip {
-		return
+func (e *Engine) zipChains() error {
+	if !e.instructions.ShouldZip {
+		return nil
 	}
-	busy.Lock()
-	defer busy.Unlock()
-	defer duration(track("zipping duration"))
+	e.busy.Lock()
+	defer e.busy.Unlock()
+	defer e.duration(track("zipping duration"))
 
-	defaultPath := "./markov-chains.zip"
-	newPath := "./markov-chains_new.zip"
+	defaultPath := e.directory + ".zip"
+	newPath := e.directory + "_new.zip"
 
 	archive, err := os.Create(newPath)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("zipping chains: %w", err)
 	}
-	defer archive.Close()
 
 	zipWriter := zip.NewWriter(archive)
-	if err := addDirectoryToZip(zipWriter, "./markov-chains/"); err != nil {
-		panic(err)
+	if err := e.addDirectoryToZip(zipWriter, e.directory, filepath.Base(e.directory)); err != nil {
+		archive.Close()
+		os.Remove(newPath)
+		return fmt.Errorf("zipping chains: %w", err)
 	}
 
-	removeAndRename(defaultPath, newPath)
-
-	zipWriter.Close()
-	stats.NextZipTime = time.Now().Add(zipInterval)
-}
+	if err := zipWriter.Close(); err != nil {
+		archive.Close()
+		os.Remove(newPath)
+		return fmt.Errorf("zipping chains: %w", err)
+	}
 
-func addDirectoryToZip(zipWriter *zip.Writer, path string) error {
-	if !strings.HasPrefix(path, "./") {
-		path = "./" + path
+	if err := archive.Close(); err != nil {
+		os.Remove(newPath)
+		return fmt.Errorf("zipping chains: %w", err)
 	}
-	if !strings.HasSuffix(path, "/") {
-		path += "/"
+
+	if err := removeAndRename(defaultPath, newPath); err != nil {
+		return fmt.Errorf("zipping chains: %w", err)
 	}
 
-	files, err := os.ReadDir(path)
+	e.statsMx.Lock()
+	e.stats.NextZipTime = time.Now().Add(zipInterval)
+	e.statsMx.Unlock()
+
+	return nil
+}
+
+// addDirectoryToZip adds every file in dir to the archive, naming them after prefix and their path inside dir.
+func (e *Engine) addDirectoryToZip(zipWriter *zip.Writer, dir, prefix string) error {
+	files, err := os.ReadDir(dir)
 	if err != nil {
 		return err
 	}
 
 	for _, file := range files {
-		filePath := path + file.Name()
+		filePath := filepath.Join(dir, file.Name())
+		zipPath := prefix + "/" + file.Name()
 
 		if file.IsDir() {
-			if err := addDirectoryToZip(zipWriter, filePath); err != nil {
+			if err := e.addDirectoryToZip(zipWriter, filePath, zipPath); err != nil {
 				return err
 			}
 			continue
 		}
 
-		exists, w := doesWorkerExist(file.Name())
-		if exists {
-			w.ChainMx.Lock()
-			defer w.ChainMx.Unlock()
-		}
-
-		f2, err := os.Open(filePath)
-		if err != nil {
-			return err
-		}
-		defer f2.Close()
-
-		filePath = strings.TrimPrefix(filePath, "./")
-		w2, err := zipWriter.Create(filePath)
-		if err != nil {
-			return err
-		}
-		if _, err := io.Copy(w2, f2); err != nil {
+		if err := e.addFileToZip(zipWriter, filePath, zipPath); err != nil {
 			return err
 		}
 	}
 
 	return nil
 }
+
+// addFileToZip copies a file into the archive. If the file is a chain file, its worker is locked only while it is copied.
+func (e *Engine) addFileToZip(zipWriter *zip.Writer, filePath, zipPath string) error {
+	exists, w := e.doesWorkerExist(strings.TrimSuffix(filepath.Base(filePath), ".json"))
+	if exists {
+		w.ChainMx.Lock()
+		defer w.ChainMx.Unlock()
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zf, err := zipWriter.Create(zipPath)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(zf, f)
+	return err
+}
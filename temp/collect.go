@@ -91,7 +91,9 @@ func StatusManager() {
 
 			if len(readyChannels) >= totalChannels {
 				print.InfoNoTime("writing")
-				markov.TempTriggerWrite()
+				if err := markov.TempTriggerWrite(); err != nil {
+					print.Warning("Temp write failed.\nError: " + err.Error())
+				}
 				for _, channel := range readyChannels {
 					for s, mutex := range streamers {
 						if s == channel {